@@ -0,0 +1,83 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package nft
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// IPAddress returns the expression of the given IPv4 or IPv6 address, or address prefix (CIDR notation).
+// The address is normalized to its canonical form (e.g. `2001:db8::1` for `2001:0db8:0:0:0:0:0:1`),
+// such that it compares equal to the address as read from the system.
+// A prefix is normalized to its network address, clearing the host bits.
+// An IPv4-mapped IPv6 address is kept as an IPv6 address (e.g. `::ffff:192.0.2.1`).
+// Addresses with a zone identifier (e.g. `fe80::1%eth0`) are rejected, nft not supporting zones:
+// The interface of a link-local address is matched separately, e.g. by the input interface name.
+func IPAddress(address string) (schema.Expression, error) {
+	if strings.Contains(address, "%") {
+		return schema.Expression{}, fmt.Errorf("invalid IP address %q: zone identifiers are not supported by nft", address)
+	}
+
+	if strings.Contains(address, "/") {
+		ip, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return schema.Expression{}, fmt.Errorf("invalid IP address prefix %q: %v", address, err)
+		}
+		length, _ := network.Mask.Size()
+		isIPv6 := ip.To4() == nil || strings.Contains(address, ":")
+		return schema.Expression{Prefix: &schema.Prefix{Addr: canonicalIP(network.IP, isIPv6), Len: length}}, nil
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return schema.Expression{}, fmt.Errorf("invalid IP address %q", address)
+	}
+	canonical := canonicalIP(ip, strings.Contains(address, ":"))
+	return schema.Expression{String: &canonical}, nil
+}
+
+// canonicalIP returns the canonical text form of the address,
+// in the IPv6 form if the address is given as an IPv6 one (including an IPv4-mapped address).
+func canonicalIP(ip net.IP, isIPv6 bool) string {
+	if ip4 := ip.To4(); ip4 != nil && isIPv6 {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// MACAddress returns the expression of the given Ethernet (EUI-48) address, as matched or set in the ether header.
+// The address is accepted in the forms of net.ParseMAC (e.g. `02-00-5E-10-00-01`, `0200.5e10.0001`),
+// and normalized to the lowercase colon-separated form, as read from the system.
+// Addresses of other lengths (e.g. EUI-64) are rejected.
+func MACAddress(address string) (schema.Expression, error) {
+	mac, err := net.ParseMAC(address)
+	if err != nil {
+		return schema.Expression{}, fmt.Errorf("invalid MAC address %q: %v", address, err)
+	}
+	if len(mac) != 6 {
+		return schema.Expression{}, fmt.Errorf("invalid MAC address %q: expected an Ethernet (EUI-48) address", address)
+	}
+	canonical := mac.String()
+	return schema.Expression{String: &canonical}, nil
+}
@@ -25,7 +25,7 @@ import (
 
 type ChainType string
 type ChainHook string
-type ChainPolicy string
+type ChainPolicy = schema.ChainPolicy
 
 // Chain Types
 const (
@@ -80,3 +80,44 @@ func NewChain(table *schema.Table, name string, ctype *ChainType, hook *ChainHoo
 
 	return c
 }
+
+// StandardFilterChains returns the input, forward and output filter base chains
+// of the given table, set with the filter priority and an accept policy.
+// An error is returned if the family of the table has no filter priority (i.e. an unknown family).
+func StandardFilterChains(table *schema.Table) ([]*schema.Chain, error) {
+	var chains []*schema.Chain
+	for _, hook := range []ChainHook{HookInput, HookForward, HookOutput} {
+		chain, err := newStandardChain(table, TypeFilter, hook, schema.PriorityFilter)
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+	return chains, nil
+}
+
+// StandardNATChains returns the prerouting (destination NAT) and postrouting (source NAT)
+// nat base chains of the given table, set with the dstnat/srcnat priorities and an accept policy.
+// An error is returned if the family of the table has no such priorities (e.g. a netdev table).
+func StandardNATChains(table *schema.Table) ([]*schema.Chain, error) {
+	prerouting, err := newStandardChain(table, TypeNAT, HookPreRouting, schema.PriorityDstNAT)
+	if err != nil {
+		return nil, err
+	}
+	postrouting, err := newStandardChain(table, TypeNAT, HookPostRouting, schema.PrioritySrcNAT)
+	if err != nil {
+		return nil, err
+	}
+	return []*schema.Chain{prerouting, postrouting}, nil
+}
+
+// newStandardChain returns a base chain named after its hook, set with the standard priority of the given name.
+// The priority is resolved by the family of the table, failing if the family has no such priority on the hook.
+func newStandardChain(table *schema.Table, ctype ChainType, hook ChainHook, name string) (*schema.Chain, error) {
+	policy := PolicyAccept
+	chain := NewChain(table, string(hook), &ctype, &hook, nil, &policy)
+	if err := chain.SetPriority(schema.ChainPriority{Name: name}); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
@@ -31,6 +31,14 @@ func (c *Config) AddChain(chain *schema.Chain) {
 	c.Nftables = append(c.Nftables, nftable)
 }
 
+// CreateChain appends the given chain to the nftable config
+// with the `create` action.
+// Unlike adding it, attempting to create an existing chain results with a failure when the config is applied.
+func (c *Config) CreateChain(chain *schema.Chain) {
+	nftable := schema.Nftable{Create: &schema.Objects{Chain: chain}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
 // DeleteChain appends a given chain to the nftable config
 // with the `delete` action.
 // Attempting to delete a non-existing chain, results with a failure when the config is applied.
@@ -78,3 +86,15 @@ func (c *Config) LookupChain(toFind *schema.Chain) *schema.Chain {
 	}
 	return nil
 }
+
+// FindChainByComment searches the configuration for the chains with the given comment and returns them.
+// Mutating the returned chains will result in mutating the configuration.
+func (c *Config) FindChainByComment(comment string) []*schema.Chain {
+	var chains []*schema.Chain
+	for _, nftable := range c.Nftables {
+		if chain := nftable.Chain; chain != nil && chain.Comment == comment {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
@@ -20,6 +20,7 @@
 package config_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -37,6 +38,7 @@ type chainActionFunc func(*nft.Config, *schema.Chain)
 // Chain Actions
 const (
 	chainADD    chainAction = "add"
+	chainCREATE chainAction = "create"
 	chainDELETE chainAction = "delete"
 	chainFLUSH  chainAction = "flush"
 )
@@ -50,6 +52,19 @@ func TestChain(t *testing.T) {
 	testRegularChainsActions(t)
 
 	testChainLookup(t)
+
+	testStandardChains(t)
+	testDefaultDropFirewall(t)
+
+	testReadChainWithPriorityAsString(t)
+	testChainPriority(t)
+
+	testChainWithComment(t)
+
+	testSetChainPolicy(t)
+
+	testValidateChain(t)
+	testRouteChain(t)
 }
 
 func testAddBaseChains(t *testing.T) {
@@ -106,6 +121,7 @@ func testAddBaseChains(t *testing.T) {
 func testRegularChainsActions(t *testing.T) {
 	actions := map[chainAction]chainActionFunc{
 		chainADD:    func(c *nft.Config, chain *schema.Chain) { c.AddChain(chain) },
+		chainCREATE: func(c *nft.Config, chain *schema.Chain) { c.CreateChain(chain) },
 		chainDELETE: func(c *nft.Config, chain *schema.Chain) { c.DeleteChain(chain) },
 		chainFLUSH:  func(c *nft.Config, chain *schema.Chain) { c.FlushChain(chain) },
 	}
@@ -184,3 +200,387 @@ func testChainLookup(t *testing.T) {
 		assert.Nil(t, config.LookupChain(chain))
 	})
 }
+
+func testStandardChains(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyINET)
+
+	t.Run("Add standard filter chains", func(t *testing.T) {
+		chains, err := nft.StandardFilterChains(table)
+		assert.NoError(t, err)
+		config := nft.NewConfig()
+		for _, chain := range chains {
+			config.AddChain(chain)
+		}
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		chainArgs := `"family":"inet","table":%q,"name":%q,"type":"filter","hook":%q,"prio":0,"policy":"accept"`
+		expected := fmt.Sprintf(`{"nftables":[{"chain":{%s}},{"chain":{%s}},{"chain":{%s}}]}`,
+			fmt.Sprintf(chainArgs, tableName, nft.HookInput, nft.HookInput),
+			fmt.Sprintf(chainArgs, tableName, nft.HookForward, nft.HookForward),
+			fmt.Sprintf(chainArgs, tableName, nft.HookOutput, nft.HookOutput),
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Add standard nat chains", func(t *testing.T) {
+		chains, err := nft.StandardNATChains(table)
+		assert.NoError(t, err)
+		config := nft.NewConfig()
+		for _, chain := range chains {
+			config.AddChain(chain)
+		}
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		chainArgs := `"family":"inet","table":%q,"name":%q,"type":"nat","hook":%q,"prio":%d,"policy":"accept"`
+		expected := fmt.Sprintf(`{"nftables":[{"chain":{%s}},{"chain":{%s}}]}`,
+			fmt.Sprintf(chainArgs, tableName, nft.HookPreRouting, nft.HookPreRouting, -100),
+			fmt.Sprintf(chainArgs, tableName, nft.HookPostRouting, nft.HookPostRouting, 100),
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Add standard nat chains to a netdev table fails", func(t *testing.T) {
+		_, err := nft.StandardNATChains(nft.NewTable(tableName, nft.FamilyNETDEV))
+		assert.Error(t, err)
+	})
+
+	t.Run("Add standard filter chains to a table of an unknown family fails", func(t *testing.T) {
+		_, err := nft.StandardFilterChains(nft.NewTable(tableName, nft.AddressFamily("unknown")))
+		assert.Error(t, err)
+	})
+}
+
+func testDefaultDropFirewall(t *testing.T) {
+	t.Run("Add a default drop firewall", func(t *testing.T) {
+		serializedConfig, err := nft.DefaultDropFirewall(tableName).ToJSON()
+		assert.NoError(t, err)
+
+		chainArgs := `"family":"inet","table":%q,"name":%q,"type":"filter","hook":%q,"prio":0,"policy":%q`
+		ruleArgs := `"family":"inet","table":%q,"chain":%q,"expr":[%s,{"accept":null}]`
+		established := `{"match":{"op":"in","left":{"ct":{"key":"state"}},"right":["established","related"]}}`
+		loopback := `{"match":{"op":"==","left":{"meta":{"key":"iif"}},"right":"lo"}}`
+		expected := fmt.Sprintf(`{"nftables":[{"table":{"family":"inet","name":%q}},`+
+			`{"chain":{%s}},{"chain":{%s}},{"chain":{%s}},{"rule":{%s}},{"rule":{%s}},{"rule":{%s}}]}`,
+			tableName,
+			fmt.Sprintf(chainArgs, tableName, nft.HookInput, nft.HookInput, nft.PolicyDrop),
+			fmt.Sprintf(chainArgs, tableName, nft.HookForward, nft.HookForward, nft.PolicyDrop),
+			fmt.Sprintf(chainArgs, tableName, nft.HookOutput, nft.HookOutput, nft.PolicyAccept),
+			fmt.Sprintf(ruleArgs, tableName, nft.HookInput, established),
+			fmt.Sprintf(ruleArgs, tableName, nft.HookInput, loopback),
+			fmt.Sprintf(ruleArgs, tableName, nft.HookForward, established),
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+}
+
+func testReadChainWithPriorityAsString(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	ctype, hook, prio := nft.TypeFilter, nft.HookInput, -10
+	expectedConfig := nft.NewConfig()
+	expectedConfig.AddChain(nft.NewChain(table, chainName, &ctype, &hook, &prio, nil))
+
+	for _, serializedPrio := range []string{`-10`, `"-10"`} {
+		t.Run(fmt.Sprintf("Read chain with priority %s", serializedPrio), func(t *testing.T) {
+			serializedConfig := fmt.Sprintf(
+				`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"type":"filter","hook":"input","prio":%s}}]}`,
+				tableName, chainName, serializedPrio,
+			)
+			config := nft.NewConfig()
+			assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+			assert.Equal(t, expectedConfig, config)
+		})
+	}
+}
+
+func testChainPriority(t *testing.T) {
+	tests := []struct {
+		family   string
+		hook     string
+		value    int
+		priority string
+	}{
+		{schema.FamilyIP, schema.HookInput, 0, "filter"},
+		{schema.FamilyIP, schema.HookInput, 10, "filter + 10"},
+		{schema.FamilyIP, schema.HookInput, -5, "filter - 5"},
+		{schema.FamilyINET, schema.HookPreRouting, -105, "dstnat - 5"},
+		{schema.FamilyINET, schema.HookPostRouting, 110, "srcnat + 10"},
+		{schema.FamilyIP6, schema.HookOutput, -300, "raw"},
+		{schema.FamilyIP6, schema.HookOutput, -140, "mangle + 10"},
+		{schema.FamilyIP, schema.HookInput, 45, "security - 5"},
+		{schema.FamilyIP, schema.HookInput, 25, "25"},
+		{schema.FamilyIP, schema.HookInput, 100, "100"},
+		{schema.FamilyBridge, schema.HookForward, -190, "filter + 10"},
+		{schema.FamilyBridge, schema.HookOutput, 100, "out"},
+		{schema.FamilyNETDEV, schema.HookIngress, -500, "-500"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Describe priority %d of a %s %s chain", tt.value, tt.family, tt.hook), func(t *testing.T) {
+			value := tt.value
+			chain := schema.Chain{Family: tt.family, Table: tableName, Name: chainName, Type: schema.TypeFilter, Hook: tt.hook, Prio: &value}
+			priority, ok := chain.Priority()
+			assert.True(t, ok)
+			assert.Equal(t, tt.priority, priority.String())
+
+			parsed, err := schema.ParseChainPriority(tt.priority)
+			assert.NoError(t, err)
+			assert.Equal(t, priority, parsed)
+			resolved, err := parsed.Value(tt.family, tt.hook)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.value, resolved)
+		})
+	}
+
+	t.Run("Read chain with a named priority", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"inet","table":%q,"name":%q,"type":"nat","hook":"prerouting","prio":"dstnat + 10"}}]}`,
+			tableName, chainName,
+		)
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		chain := config.Nftables[0].Chain
+		assert.Equal(t, -90, *chain.Prio)
+		priority, ok := chain.Priority()
+		assert.True(t, ok)
+		assert.Equal(t, schema.ChainPriority{Name: schema.PriorityDstNAT, Offset: 10}, priority)
+
+		reserializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(reserializedConfig))
+	})
+
+	t.Run("Read chain with a named priority, serialize it changed", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"type":"filter","hook":"input","prio":"filter - 5"}}]}`,
+			tableName, chainName,
+		)
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+		prio := 20
+		config.Nftables[0].Chain.Prio = &prio
+
+		reserializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"type":"filter","hook":"input","prio":20}}]}`,
+			tableName, chainName,
+		), string(reserializedConfig))
+	})
+
+	t.Run("Read chain with a named priority invalid on its hook", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"inet","table":%q,"name":%q,"type":"filter","hook":"output","prio":"dstnat"}}]}`,
+			tableName, chainName,
+		)
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		chain := config.Nftables[0].Chain
+		assert.Nil(t, chain.Prio)
+		assert.Equal(t, schema.PriorityDstNAT, chain.PrioName)
+		priority, ok := chain.Priority()
+		assert.True(t, ok)
+		assert.Equal(t, schema.ChainPriority{Name: schema.PriorityDstNAT}, priority)
+
+		reserializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(reserializedConfig))
+	})
+
+	t.Run("Diff a chain read with a named priority against its numeric one", func(t *testing.T) {
+		named := nft.NewConfig()
+		assert.NoError(t, named.FromJSON([]byte(fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"type":"filter","hook":"input","prio":"filter + 10"}}]}`,
+			tableName, chainName,
+		))))
+		numeric := nft.NewConfig()
+		assert.NoError(t, numeric.FromJSON([]byte(fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"type":"filter","hook":"input","prio":10}}]}`,
+			tableName, chainName,
+		))))
+
+		diff, err := named.Diff(numeric)
+		assert.NoError(t, err)
+		assert.Empty(t, diff.Added)
+		assert.Empty(t, diff.Removed)
+	})
+
+	t.Run("Round-trip a priority through its text encoding", func(t *testing.T) {
+		serialized, err := json.Marshal(map[string]schema.ChainPriority{"prio": {Name: schema.PriorityFilter, Offset: -10}})
+		assert.NoError(t, err)
+		assert.Equal(t, `{"prio":"filter - 10"}`, string(serialized))
+
+		var deserialized map[string]schema.ChainPriority
+		assert.NoError(t, json.Unmarshal(serialized, &deserialized))
+		assert.Equal(t, schema.ChainPriority{Name: schema.PriorityFilter, Offset: -10}, deserialized["prio"])
+	})
+
+	t.Run("Parse invalid priorities", func(t *testing.T) {
+		for _, priority := range []string{"", "filter +", "filter + -1", "filtre", "filter * 2", "10 + filter"} {
+			_, err := schema.ParseChainPriority(priority)
+			assert.Error(t, err, "priority %q", priority)
+		}
+	})
+
+	t.Run("Set a named priority", func(t *testing.T) {
+		chain := schema.Chain{Family: schema.FamilyBridge, Table: tableName, Name: chainName, Type: schema.TypeFilter, Hook: schema.HookPreRouting}
+		assert.NoError(t, chain.SetPriority(schema.ChainPriority{Name: schema.PriorityDstNAT}))
+		assert.Equal(t, -300, *chain.Prio)
+		assert.Error(t, chain.SetPriority(schema.ChainPriority{Name: schema.PriorityRaw}))
+	})
+}
+
+func testChainWithComment(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	chain.Comment = "generated for pod-a"
+	serializedConfig := fmt.Sprintf(
+		`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"comment":"generated for pod-a"}}]}`,
+		tableName, chainName,
+	)
+
+	t.Run("Add chain with a comment", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddChain(chain)
+
+		serialized, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(serialized))
+	})
+
+	t.Run("Read chain with a comment", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddChain(chain)
+		assert.Equal(t, expectedConfig, config)
+	})
+
+	t.Run("Find chains by comment", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddChain(nft.NewRegularChain(table, "uncommented"))
+		config.AddChain(chain)
+
+		assert.Equal(t, []*schema.Chain{chain}, config.FindChainByComment(chain.Comment))
+		assert.Empty(t, config.FindChainByComment("missing"))
+	})
+}
+
+func testSetChainPolicy(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+
+	t.Run("Set policy on a base chain", func(t *testing.T) {
+		ctype, hook, prio := nft.TypeFilter, nft.HookInput, 0
+		chain := nft.NewChain(table, chainName, &ctype, &hook, &prio, nil)
+		assert.NoError(t, chain.SetPolicy(schema.PolicyDrop))
+
+		config := nft.NewConfig()
+		config.AddChain(chain)
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"chain":{"family":"ip","table":%q,"name":%q,"type":"filter","hook":"input","prio":0,"policy":"drop"}}]}`,
+			tableName, chainName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Set a typed policy on a base chain", func(t *testing.T) {
+		ctype, hook, prio := nft.TypeFilter, nft.HookInput, 0
+		chain := nft.NewChain(table, chainName, &ctype, &hook, &prio, nil)
+		assert.NoError(t, chain.SetPolicy(nft.PolicyAccept))
+		assert.Equal(t, schema.PolicyAccept, chain.Policy)
+	})
+
+	t.Run("Set policy on a regular chain", func(t *testing.T) {
+		chain := nft.NewRegularChain(table, chainName)
+		assert.Error(t, chain.SetPolicy(schema.PolicyDrop))
+		assert.Empty(t, chain.Policy)
+	})
+
+	t.Run("Set an invalid policy on a base chain", func(t *testing.T) {
+		ctype, hook, prio := nft.TypeFilter, nft.HookInput, 0
+		chain := nft.NewChain(table, chainName, &ctype, &hook, &prio, nil)
+		assert.Error(t, chain.SetPolicy("reject"))
+		assert.Empty(t, chain.Policy)
+	})
+}
+
+func testValidateChain(t *testing.T) {
+	tests := []struct {
+		family  nft.AddressFamily
+		ctype   nft.ChainType
+		hook    nft.ChainHook
+		isValid bool
+	}{
+		{nft.FamilyIP, nft.TypeFilter, nft.HookInput, true},
+		{nft.FamilyIP, nft.TypeNAT, nft.HookPostRouting, true},
+		{nft.FamilyIP, nft.TypeNAT, nft.HookForward, false},
+		{nft.FamilyIP, nft.TypeRoute, nft.HookOutput, true},
+		{nft.FamilyIP6, nft.TypeRoute, nft.HookOutput, true},
+		{nft.FamilyIP, nft.TypeRoute, nft.HookInput, false},
+		{nft.FamilyBridge, nft.TypeRoute, nft.HookOutput, false},
+		{nft.FamilyARP, nft.TypeFilter, nft.HookForward, false},
+		{nft.FamilyNETDEV, nft.TypeFilter, nft.HookIngress, true},
+		{nft.FamilyIP, "invalid", nft.HookInput, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("Validate %s chain of type %s on the %s hook", tt.family, tt.ctype, tt.hook), func(t *testing.T) {
+			prio := 0
+			chain := nft.NewChain(nft.NewTable(tableName, tt.family), chainName, &tt.ctype, &tt.hook, &prio, nil)
+			if tt.isValid {
+				assert.NoError(t, chain.Validate())
+			} else {
+				assert.Error(t, chain.Validate())
+			}
+		})
+	}
+
+	t.Run("Validate regular chain", func(t *testing.T) {
+		assert.NoError(t, nft.NewRegularChain(nft.NewTable(tableName, nft.FamilyIP), chainName).Validate())
+	})
+
+	t.Run("Validate base chain without a hook", func(t *testing.T) {
+		ctype := nft.TypeFilter
+		chain := nft.NewChain(nft.NewTable(tableName, nft.FamilyIP), chainName, &ctype, nil, nil, nil)
+		assert.Error(t, chain.Validate())
+	})
+}
+
+func testRouteChain(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	ctype, hook, prio, policy := nft.TypeRoute, nft.HookOutput, -150, nft.PolicyAccept
+	chain := nft.NewChain(table, chainName, &ctype, &hook, &prio, &policy)
+
+	config := nft.NewConfig()
+	config.AddChain(chain)
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{nft.MarkSet(0x1)}, nil, nil, ""))
+
+	serializedConfig := fmt.Sprintf(
+		`{"nftables":[`+
+			`{"chain":{"family":"ip","table":%[1]q,"name":%[2]q,"type":"route","hook":"output","prio":-150,"policy":"accept"}},`+
+			`{"rule":{"family":"ip","table":%[1]q,"chain":%[2]q,"expr":[{"mangle":{"key":{"meta":{"key":"mark"}},"value":1}}]}}]}`,
+		tableName, chainName,
+	)
+
+	t.Run("Add route chain with a mark set rule, check serialization", func(t *testing.T) {
+		assert.NoError(t, chain.Validate())
+
+		data, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(data))
+	})
+
+	t.Run("Add route chain with a mark set rule, check deserialization", func(t *testing.T) {
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON([]byte(serializedConfig)))
+		assert.Equal(t, config, deserializedConfig)
+	})
+}
@@ -21,6 +21,8 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/networkplumbing/go-nft/nft/schema"
 )
@@ -36,19 +38,134 @@ func New() *Config {
 	return c
 }
 
+// NewWithMetainfo returns a new nftables config structure,
+// starting with the given metainfo entry.
+// An unset JSON schema version is populated with the one implemented by the schema package.
+func NewWithMetainfo(metainfo schema.Metainfo) *Config {
+	c := New()
+	c.SetMetainfo(metainfo)
+	return c
+}
+
+// Metainfo returns the metainfo entry of the nftables config, nil if there is none.
+// Configurations read from the system carry the metainfo reported by nft.
+// Mutating the returned metainfo will result in mutating the configuration.
+func (c *Config) Metainfo() *schema.Metainfo {
+	for _, nftable := range c.Nftables {
+		if nftable.Metainfo != nil {
+			return nftable.Metainfo
+		}
+	}
+	return nil
+}
+
+// Generation returns the generation ID of the ruleset the config was read from, as reported in the metainfo.
+// Two reads of the same generation list the same ruleset, sparing the comparison of their content.
+// It reports false if there is no metainfo or nft does not report the generation.
+func (c *Config) Generation() (int, bool) {
+	if m := c.Metainfo(); m != nil && m.Genid != nil {
+		return *m.Genid, true
+	}
+	return 0, false
+}
+
+// SetMetainfo sets the metainfo entry of the nftables config.
+// An existing metainfo entry is replaced, otherwise the entry is inserted as the first one.
+// An unset JSON schema version is populated with the one implemented by the schema package.
+func (c *Config) SetMetainfo(metainfo schema.Metainfo) {
+	if metainfo.JsonSchemaVersion == 0 {
+		metainfo.JsonSchemaVersion = schema.JSONSchemaVersion
+	}
+
+	if m := c.Metainfo(); m != nil {
+		*m = metainfo
+		return
+	}
+	c.Nftables = append([]schema.Nftable{{Metainfo: &metainfo}}, c.Nftables...)
+}
+
+// IsEmpty reports whether the nftables config has no entries, other than the metainfo.
+// A config read from a system without any ruleset (e.g. a fresh network namespace) is empty.
+func (c *Config) IsEmpty() bool {
+	for _, nftable := range c.Nftables {
+		if nftable.Metainfo == nil {
+			return false
+		}
+	}
+	return true
+}
+
 // ToJSON returns the JSON encoding of the nftables config.
+// The encoding is deterministic, the same config always resulting in the same bytes:
+// object keys are emitted in the order of the schema struct fields, or sorted when encoded from maps
+// (e.g. the statements), and row data is emitted as given.
 func (c *Config) ToJSON() ([]byte, error) {
 	return json.Marshal(*c)
 }
 
+// ToJSONIndent returns the indented JSON encoding of the nftables config, for human readers
+// (e.g. reviewing versioned rulesets).
+// Each entry begins on a new line starting with the prefix, followed by copies of the indent by nesting.
+// The indented encoding is accepted by nft as the compact one returned by ToJSON, which is used to apply configs.
+func (c *Config) ToJSONIndent(prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(*c, prefix, indent)
+}
+
+// ToScript returns a self-contained nft script which applies the nftables config, for configs generated
+// on a host other than the one they are applied on.
+// The script is the JSON encoding of the config, to be copied to a file and applied as a single transaction
+// by `nft -j -f <file>` (or checked by `nft -j -c -f <file>`). nft reads JSON scripts with the `-j` option only,
+// and rejects any content besides the JSON document (e.g. a `#!` line), while the native syntax has no
+// equivalent for all the schema.
+func (c *Config) ToScript() (string, error) {
+	data, err := c.ToJSON()
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// decodeErrorContextSize is the number of bytes shown on each side of a decoding error offset.
+const decodeErrorContextSize = 128
+
 // FromJSON decodes the provided JSON-encoded data and populates the nftables config.
+// On a decoding failure, the error includes the offset and the JSON snippet around it.
 func (c *Config) FromJSON(data []byte) error {
 	if err := json.Unmarshal(data, c); err != nil {
-		return err
+		return withDecodeErrorContext(err, data)
 	}
 	return nil
 }
 
+// withDecodeErrorContext wraps JSON syntax and type errors with the data surrounding the failure offset.
+// Other errors are returned as is.
+func withDecodeErrorContext(err error, data []byte) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	start := offset - decodeErrorContextSize
+	if start < 0 {
+		start = 0
+	}
+	end := offset + decodeErrorContextSize
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	if start > end {
+		start = end
+	}
+	return fmt.Errorf("%w (at offset %d, near: %s)", err, offset, data[start:end])
+}
+
 // FlushRuleset adds a command to the nftables config that erases all the configuration when applied.
 // It is commonly used as the first config instruction, followed by a declarative configuration.
 // When used, any previous configuration is flushed away before adding the new one.
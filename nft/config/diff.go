@@ -0,0 +1,302 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// ConfigDiff holds the declarative entries which differ between two configs.
+type ConfigDiff struct {
+	// Added are the entries present in the other config only.
+	Added []schema.Nftable
+	// Removed are the entries present in the config only.
+	Removed []schema.Nftable
+}
+
+// IsEmpty reports whether the configs have no differences.
+func (d *ConfigDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Diff compares the declarative entries of the config with the ones of the other config.
+// Entries are compared as normalized, not considering their handles, rule indexes and
+// counter, quota and last used values, nor the element expirations (which change over time).
+// A rule is compared along with its position in its chain, a reordered rule is reported as a difference.
+// Entries with the `delete` or `flush` action and the metainfo are not compared,
+// entries with the `add` or `create` action are compared as their declarative form.
+func (c *Config) Diff(other *Config) (*ConfigDiff, error) {
+	entries, keys, err := normalizedEntries(c.Nftables)
+	if err != nil {
+		return nil, err
+	}
+	otherEntries, otherKeys, err := normalizedEntries(other.Nftables)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, key := range keys {
+		counts[key]++
+	}
+	diff := &ConfigDiff{}
+	for i, key := range otherKeys {
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		diff.Added = append(diff.Added, otherEntries[i])
+	}
+
+	otherCounts := map[string]int{}
+	for _, key := range otherKeys {
+		otherCounts[key]++
+	}
+	for i, key := range keys {
+		if otherCounts[key] > 0 {
+			otherCounts[key]--
+			continue
+		}
+		diff.Removed = append(diff.Removed, entries[i])
+	}
+	return diff, nil
+}
+
+// Hash returns a hash of the declarative entries of the config, as a hex encoded SHA-256 digest.
+// The entries are hashed as normalized for Diff, configs with no differences have the same hash.
+// It serves as a content token, e.g. to detect a table changing between a read and a later write.
+func (c *Config) Hash() (string, error) {
+	_, keys, err := normalizedEntries(c.Nftables)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// normalizedEntries returns the normalized declarative entries, along with their comparison keys.
+func normalizedEntries(nftables []schema.Nftable) ([]schema.Nftable, []string, error) {
+	var entries []schema.Nftable
+	var keys []string
+	rulePositions := map[objectKey]int{}
+	for _, nftable := range nftables {
+		switch {
+		case nftable.Add != nil:
+			nftable = declarativeEntry(nftable.Add)
+		case nftable.Create != nil:
+			nftable = declarativeEntry(nftable.Create)
+		}
+		entry, ok := normalizeEntry(nftable)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := string(data)
+		if r := entry.Rule; r != nil {
+			chain := objectKey{tableKey{r.Family, r.Table}, r.Chain}
+			key = fmt.Sprintf("%s@%d", data, rulePositions[chain])
+			rulePositions[chain]++
+		}
+		entries = append(entries, entry)
+		keys = append(keys, key)
+	}
+	return entries, keys, nil
+}
+
+// declarativeEntry returns the entry of the objects of an `add` or `create` action.
+func declarativeEntry(objects *schema.Objects) schema.Nftable {
+	return schema.Nftable{
+		Table:         objects.Table,
+		Chain:         objects.Chain,
+		Rule:          objects.Rule,
+		Secmark:       objects.Secmark,
+		Set:           objects.Set,
+		Map:           objects.Map,
+		Element:       objects.Element,
+		CtHelper:      objects.CtHelper,
+		CtExpectation: objects.CtExpectation,
+		CtTimeout:     objects.CtTimeout,
+		Counter:       objects.Counter,
+		Quota:         objects.Quota,
+		Limit:         objects.Limit,
+		Synproxy:      objects.Synproxy,
+	}
+}
+
+// normalizeEntry returns a copy of the declarative entry without its handle and changing values.
+// Entries which are not declarative are reported as not ok.
+func normalizeEntry(nftable schema.Nftable) (schema.Nftable, bool) {
+	entry, ok := withoutHandle(nftable)
+	switch {
+	case entry.Rule != nil:
+		statements := make([]schema.Statement, 0, len(entry.Rule.Expr))
+		for _, statement := range entry.Rule.Expr {
+			if statement.Counter != nil {
+				statement.Counter = &schema.Counter{}
+			}
+			if statement.Last != nil {
+				statement.Last = &schema.Last{}
+			}
+			if statement.Quota != nil {
+				quota := *statement.Quota
+				quota.Used, quota.UsedUnit = 0, ""
+				statement.Quota = &quota
+			}
+			statements = append(statements, statement)
+		}
+		entry.Rule.Expr = statements
+	case entry.Chain != nil && entry.Chain.Prio != nil:
+		chain := *entry.Chain
+		chain.PrioName = ""
+		entry.Chain = &chain
+	case entry.Counter != nil:
+		entry.Counter.Packets, entry.Counter.Bytes = 0, 0
+	case entry.Quota != nil:
+		entry.Quota.Used = 0
+	case entry.Set != nil:
+		entry.Set.Elem = withoutExpires(entry.Set.Elem)
+	case entry.Element != nil:
+		element := *entry.Element
+		element.Elem = withoutExpires(element.Elem)
+		entry.Element = &element
+	}
+	return entry, ok
+}
+
+// withoutExpires returns a copy of the elements without their remaining time to expire,
+// which decreases between reads.
+func withoutExpires(elements []schema.Expression) []schema.Expression {
+	var result []schema.Expression
+	for _, element := range elements {
+		if element.Elem != nil && element.Elem.Expires != 0 {
+			elem := *element.Elem
+			elem.Expires = 0
+			element.Elem = &elem
+		}
+		result = append(result, element)
+	}
+	return result
+}
+
+// WithoutHandles returns a copy of the declarative entries of the config, without their handles and rule indexes.
+// It allows a config read from the system to be applied again, e.g. to restore it.
+// Entries with an explicit action and the metainfo are not included.
+func (c *Config) WithoutHandles() *Config {
+	config := New()
+	for _, nftable := range c.Nftables {
+		if entry, ok := withoutHandle(nftable); ok {
+			config.Nftables = append(config.Nftables, entry)
+		}
+	}
+	return config
+}
+
+// WithoutExpires returns a copy of the config, without the remaining time to expire of the set,
+// map and element entry elements.
+// A snapshot read from the system holds the remaining time of its elements, which is
+// not to be applied again, e.g. to restore it.
+func (c *Config) WithoutExpires() *Config {
+	config := New()
+	for _, nftable := range c.Nftables {
+		switch {
+		case nftable.Set != nil:
+			set := *nftable.Set
+			set.Elem = withoutExpires(set.Elem)
+			nftable.Set = &set
+		case nftable.Map != nil:
+			m := *nftable.Map
+			m.Elem = withoutExpires(m.Elem)
+			nftable.Map = &m
+		case nftable.Element != nil:
+			element := *nftable.Element
+			element.Elem = withoutExpires(element.Elem)
+			nftable.Element = &element
+		}
+		config.Nftables = append(config.Nftables, nftable)
+	}
+	return config
+}
+
+// withoutHandle returns a copy of the declarative entry without its handle (and index, for rules).
+// Entries which are not declarative are reported as not ok.
+func withoutHandle(nftable schema.Nftable) (schema.Nftable, bool) {
+	switch {
+	case nftable.Table != nil:
+		return schema.Nftable{Table: nftable.Table}, true
+	case nftable.Chain != nil:
+		return schema.Nftable{Chain: nftable.Chain}, true
+	case nftable.Rule != nil:
+		r := *nftable.Rule
+		r.Handle, r.Index = nil, nil
+		return schema.Nftable{Rule: &r}, true
+	case nftable.Secmark != nil:
+		secmark := *nftable.Secmark
+		secmark.Handle = nil
+		return schema.Nftable{Secmark: &secmark}, true
+	case nftable.Set != nil:
+		set := *nftable.Set
+		set.Handle = nil
+		return schema.Nftable{Set: &set}, true
+	case nftable.Map != nil:
+		m := *nftable.Map
+		m.Handle = nil
+		return schema.Nftable{Map: &m}, true
+	case nftable.Element != nil:
+		return schema.Nftable{Element: nftable.Element}, true
+	case nftable.CtHelper != nil:
+		helper := *nftable.CtHelper
+		helper.Handle = nil
+		return schema.Nftable{CtHelper: &helper}, true
+	case nftable.CtExpectation != nil:
+		expectation := *nftable.CtExpectation
+		expectation.Handle = nil
+		return schema.Nftable{CtExpectation: &expectation}, true
+	case nftable.CtTimeout != nil:
+		timeout := *nftable.CtTimeout
+		timeout.Handle = nil
+		return schema.Nftable{CtTimeout: &timeout}, true
+	case nftable.Counter != nil:
+		counter := *nftable.Counter
+		counter.Handle = nil
+		return schema.Nftable{Counter: &counter}, true
+	case nftable.Quota != nil:
+		quota := *nftable.Quota
+		quota.Handle = nil
+		return schema.Nftable{Quota: &quota}, true
+	case nftable.Limit != nil:
+		limit := *nftable.Limit
+		limit.Handle = nil
+		return schema.Nftable{Limit: &limit}, true
+	case nftable.Synproxy != nil:
+		synproxy := *nftable.Synproxy
+		synproxy.Handle = nil
+		return schema.Nftable{Synproxy: &synproxy}, true
+	}
+	return schema.Nftable{}, false
+}
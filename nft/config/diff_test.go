@@ -0,0 +1,176 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func TestDiff(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	newConfig := func(comments ...string) *nft.Config {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(chain)
+		for _, comment := range comments {
+			statements := []schema.Statement{{Counter: &schema.Counter{}}, {Last: &schema.Last{}}, {Verdict: schema.Accept()}}
+			config.AddRule(nft.NewRule(table, chain, statements, nil, nil, comment))
+		}
+		return config
+	}
+	// liveConfig returns the config as read from the system, with handles, counter and last used values.
+	liveConfig := func(comments ...string) *nft.Config {
+		config := newConfig(comments...)
+		for i, nftable := range config.Nftables {
+			if r := nftable.Rule; r != nil {
+				handle := i + 1
+				r.Handle = &handle
+				r.Expr[0].Counter = &schema.Counter{Packets: 10 * i, Bytes: 1000 * i}
+				used := 100 * i
+				r.Expr[1].Last = &schema.Last{Used: &used}
+			}
+		}
+		return config
+	}
+
+	t.Run("Diff equal configs, not considering handles, counter and last used values", func(t *testing.T) {
+		desired := newConfig("a", "b")
+		desired.Nftables = append([]schema.Nftable{{Flush: &schema.Objects{Ruleset: true}}}, desired.Nftables...)
+
+		diff, err := liveConfig("a", "b").Diff(desired)
+		assert.NoError(t, err)
+		assert.True(t, diff.IsEmpty(), "unexpected diff: %+v", diff)
+	})
+
+	t.Run("Diff equal configs, not considering inline quota used values and element expirations", func(t *testing.T) {
+		newQuotaConfig := func(used int, usedUnit string, expires int) *nft.Config {
+			config := nft.NewConfig()
+			config.AddTable(table)
+			config.AddChain(chain)
+			quota := &schema.Quota{Val: 10, ValUnit: "mbytes", Used: used, UsedUnit: usedUnit}
+			config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Quota: quota}, {Verdict: schema.Drop()}}, nil, nil, ""))
+			address := "192.0.2.1"
+			config.AddSet(&schema.Set{
+				Family: schema.FamilyIP, Table: tableName, Name: "blocklist", Type: schema.SetTypeIPv4Addr,
+				Flags: &schema.Flags{Flags: []string{schema.SetFlagTimeout}},
+				Elem:  []schema.Expression{{Elem: &schema.Elem{Val: schema.Expression{String: &address}, Timeout: 60, Expires: expires}}},
+			})
+			return config
+		}
+
+		live := newQuotaConfig(512, "kbytes", 42)
+		diff, err := live.Diff(newQuotaConfig(0, "", 0))
+		assert.NoError(t, err)
+		assert.True(t, diff.IsEmpty(), "unexpected diff: %+v", diff)
+		assert.Equal(t, 512, live.Nftables[2].Rule.Expr[0].Quota.Used, "the config is expected to be left intact")
+		assert.Equal(t, 42, live.Nftables[3].Set.Elem[0].Elem.Expires, "the config is expected to be left intact")
+
+		liveHash, err := live.Hash()
+		assert.NoError(t, err)
+		desiredHash, err := newQuotaConfig(0, "", 0).Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, desiredHash, liveHash)
+	})
+
+	t.Run("Diff configs with added and removed rules", func(t *testing.T) {
+		diff, err := liveConfig("a", "b").Diff(newConfig("a", "c"))
+		assert.NoError(t, err)
+
+		assert.Len(t, diff.Added, 1)
+		assert.Equal(t, "c", diff.Added[0].Rule.Comment)
+		assert.Len(t, diff.Removed, 1)
+		assert.Equal(t, "b", diff.Removed[0].Rule.Comment)
+		assert.Nil(t, diff.Removed[0].Rule.Handle)
+	})
+
+	t.Run("Diff configs with reordered rules", func(t *testing.T) {
+		diff, err := liveConfig("a", "b").Diff(newConfig("b", "a"))
+		assert.NoError(t, err)
+		assert.Len(t, diff.Added, 2)
+		assert.Len(t, diff.Removed, 2)
+	})
+
+	t.Run("Diff a config with an added table", func(t *testing.T) {
+		desired := newConfig("a")
+		desired.Nftables = append(desired.Nftables, schema.Nftable{Add: &schema.Objects{
+			Table: nft.NewTable("other", nft.FamilyIP6),
+		}})
+
+		diff, err := liveConfig("a").Diff(desired)
+		assert.NoError(t, err)
+		assert.Equal(t, []schema.Nftable{{Table: nft.NewTable("other", nft.FamilyIP6)}}, diff.Added)
+		assert.Empty(t, diff.Removed)
+	})
+}
+
+func TestHash(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	newConfig := func(handle int, verdict schema.Verdict) *nft.Config {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(chain)
+		config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Verdict: verdict}}, &handle, nil, ""))
+		return config
+	}
+
+	hash, err := newConfig(1, schema.Accept()).Hash()
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	t.Run("Hash configs differing by handles only", func(t *testing.T) {
+		otherHash, err := newConfig(2, schema.Accept()).Hash()
+		assert.NoError(t, err)
+		assert.Equal(t, hash, otherHash)
+	})
+
+	t.Run("Hash configs with different rules", func(t *testing.T) {
+		otherHash, err := newConfig(1, schema.Drop()).Hash()
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, otherHash)
+	})
+}
+
+func TestWithoutHandles(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	handle, index := 3, 1
+	statements := []schema.Statement{{Counter: &schema.Counter{Packets: 1, Bytes: 60}}, {Verdict: schema.Accept()}}
+
+	config := nft.NewConfig()
+	config.SetMetainfo(schema.Metainfo{Version: "1.0.1"})
+	config.AddTable(table)
+	config.AddChain(chain)
+	config.AddRule(nft.NewRule(table, chain, statements, &handle, &index, ""))
+	config.FlushChain(chain)
+
+	expected := nft.NewConfig()
+	expected.AddTable(table)
+	expected.AddChain(chain)
+	expected.AddRule(nft.NewRule(table, chain, statements, nil, nil, ""))
+	assert.Equal(t, expected, config.WithoutHandles())
+	assert.Equal(t, &handle, config.Nftables[3].Rule.Handle, "the config is not expected to be changed")
+}
@@ -0,0 +1,110 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// Lint returns warnings about rules of the config which are likely not to behave as intended.
+// The config is not changed and the warnings do not prevent it from being applied.
+//
+// In the inet family, a rule matching the layer 4 protocol with `ip protocol` or `ip6 nexthdr` matches
+// a single IP family only, letting the traffic of the other family bypass the rule.
+// A warning suggests `meta l4proto` instead, which matches both families.
+//
+// A set with the dynamic flag is expected to be updated from the packet path by a set statement
+// (e.g. `add @name { ip saddr }`), a warning is returned for dynamic sets no rule of the config updates.
+func (c *Config) Lint() []string {
+	var warnings []string
+	updatedSets := map[objectKey]bool{}
+	for _, nftable := range c.Nftables {
+		if r := nftable.Rule; r != nil {
+			for _, statement := range r.Expr {
+				if statement.Set != nil {
+					name := strings.TrimPrefix(statement.Set.Set, "@")
+					updatedSets[objectKey{tableKey{r.Family, r.Table}, name}] = true
+				}
+			}
+		}
+	}
+
+	for _, nftable := range c.Nftables {
+		if set := nftable.Set; set != nil && set.Flags != nil && hasFlag(set.Flags.Flags, schema.SetFlagDynamic) {
+			if !updatedSets[setObjectKey(set)] {
+				warnings = append(warnings, fmt.Sprintf(
+					"dynamic set %s %s %s is not updated by any rule: use a set statement to add elements from the packet path",
+					set.Family, set.Table, set.Name))
+			}
+		}
+
+		r := nftable.Rule
+		if r == nil || r.Family != schema.FamilyINET {
+			continue
+		}
+		for _, statement := range r.Expr {
+			if statement.Match == nil || statement.Match.Left.Payload == nil {
+				continue
+			}
+			payload := statement.Match.Left.Payload
+			if isFamilyL4Protocol(payload) {
+				warnings = append(warnings, fmt.Sprintf(
+					"rule%s in chain %s %s %s matches %s %s, applying to %s only: use meta l4proto to match both IPv4 and IPv6",
+					ruleDescription(r), r.Family, r.Table, r.Chain, payload.Protocol, payload.Field, familyName(payload.Protocol)))
+			}
+		}
+	}
+	return warnings
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+func isFamilyL4Protocol(payload *schema.Payload) bool {
+	return (payload.Protocol == schema.PayloadProtocolIP4 && payload.Field == schema.PayloadFieldIP4Protocol) ||
+		(payload.Protocol == schema.PayloadProtocolIP6 && payload.Field == schema.PayloadFieldIP6NextHdr)
+}
+
+func familyName(protocol string) string {
+	if protocol == schema.PayloadProtocolIP6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// ruleDescription identifies the rule by its handle or comment, when present.
+func ruleDescription(r *schema.Rule) string {
+	switch {
+	case r.Handle != nil:
+		return fmt.Sprintf(" (handle %d)", *r.Handle)
+	case r.Comment != "":
+		return fmt.Sprintf(" %q", r.Comment)
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func TestLint(t *testing.T) {
+	tcp := "tcp"
+	ipProtocolTCP := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIP4Protocol}},
+		Right: schema.Expression{String: &tcp},
+	}}
+	ip6NexthdrTCP := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP6, Field: schema.PayloadFieldIP6NextHdr}},
+		Right: schema.Expression{String: &tcp},
+	}}
+	newConfig := func(family nft.AddressFamily, statements []schema.Statement) *nft.Config {
+		table := nft.NewTable(tableName, family)
+		chain := nft.NewRegularChain(table, chainName)
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(chain)
+		config.AddRule(nft.NewRule(table, chain, statements, nil, nil, "ssh"))
+		return config
+	}
+
+	t.Run("Lint family specific protocol matches in an inet table", func(t *testing.T) {
+		config := newConfig(nft.FamilyINET, []schema.Statement{ipProtocolTCP, ip6NexthdrTCP})
+
+		assert.Equal(t, []string{
+			`rule "ssh" in chain inet ` + tableName + ` ` + chainName +
+				` matches ip protocol, applying to IPv4 only: use meta l4proto to match both IPv4 and IPv6`,
+			`rule "ssh" in chain inet ` + tableName + ` ` + chainName +
+				` matches ip6 nexthdr, applying to IPv6 only: use meta l4proto to match both IPv4 and IPv6`,
+		}, config.Lint())
+	})
+
+	t.Run("Lint a meta l4proto match in an inet table", func(t *testing.T) {
+		config := newConfig(nft.FamilyINET, []schema.Statement{nft.L4ProtoIs(tcp), {Verdict: schema.Accept()}})
+		assert.Empty(t, config.Lint())
+	})
+
+	t.Run("Lint a family specific protocol match in an ip table", func(t *testing.T) {
+		config := newConfig(nft.FamilyIP, []schema.Statement{ipProtocolTCP})
+		assert.Empty(t, config.Lint())
+	})
+
+	t.Run("Lint dynamic sets", func(t *testing.T) {
+		source := schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPSAddr}}
+		config := newConfig(nft.FamilyIP, []schema.Statement{nft.ConnLimitOver("connlimit", source, 10), {Verdict: schema.Drop()}})
+		for _, name := range []string{"connlimit", "unused"} {
+			config.AddSet(&schema.Set{
+				Family: schema.FamilyIP,
+				Table:  tableName,
+				Name:   name,
+				Type:   schema.SetTypeIPv4Addr,
+				Flags:  &schema.Flags{Flags: []string{schema.SetFlagDynamic}},
+			})
+		}
+
+		assert.Equal(t, []string{
+			`dynamic set ip ` + tableName + ` unused is not updated by any rule: use a set statement to add elements from the packet path`,
+		}, config.Lint())
+	})
+}
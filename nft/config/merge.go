@@ -0,0 +1,230 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+type objectKey struct {
+	tableKey
+	name string
+}
+
+// Merge appends the entries of the other nftable config to this config.
+// Definitions of the same table or chain are added once.
+// Definitions of the same set or map are merged into the existing one, joining their elements.
+// A table, chain, set or map which is defined differently in both configs (e.g. a base chain with different hooks)
+// is a conflict, as is a map key mapped to different values, in which case an error describing all conflicts
+// is returned and the config is left unchanged.
+// Entries with an explicit action (e.g. `delete`) and rules are always appended.
+// The entries of the other config are shared, mutating them will result in mutating both configurations.
+func (c *Config) Merge(other *Config) error {
+	nftables := append([]schema.Nftable{}, c.Nftables...)
+
+	tables := map[tableKey]*schema.Table{}
+	chains := map[objectKey]*schema.Chain{}
+	sets := map[objectKey]int{}
+	maps := map[objectKey]int{}
+	for i, nftable := range nftables {
+		switch {
+		case nftable.Table != nil:
+			tables[tableKey{nftable.Table.Family, nftable.Table.Name}] = nftable.Table
+		case nftable.Chain != nil:
+			chains[chainObjectKey(nftable.Chain)] = nftable.Chain
+		case nftable.Set != nil:
+			sets[setObjectKey(nftable.Set)] = i
+		case nftable.Map != nil:
+			maps[mapObjectKey(nftable.Map)] = i
+		}
+	}
+
+	var conflicts []string
+	for _, nftable := range other.Nftables {
+		switch {
+		case nftable.Table != nil:
+			key := tableKey{nftable.Table.Family, nftable.Table.Name}
+			if existing, exists := tables[key]; exists {
+				if !reflect.DeepEqual(*existing, *nftable.Table) {
+					conflicts = append(conflicts, fmt.Sprintf("table %s %s is defined differently", key.family, key.table))
+				}
+				continue
+			}
+			tables[key] = nftable.Table
+		case nftable.Chain != nil:
+			key := chainObjectKey(nftable.Chain)
+			if existing, exists := chains[key]; exists {
+				if !equalChains(existing, nftable.Chain) {
+					conflicts = append(conflicts, fmt.Sprintf("chain %s %s %s is defined differently", key.family, key.table, key.name))
+				}
+				continue
+			}
+			chains[key] = nftable.Chain
+		case nftable.Set != nil:
+			key := setObjectKey(nftable.Set)
+			if i, exists := sets[key]; exists {
+				merged, ok := mergeSets(nftables[i].Set, nftable.Set)
+				if !ok {
+					conflicts = append(conflicts, fmt.Sprintf("set %s %s %s is defined differently", key.family, key.table, key.name))
+					continue
+				}
+				nftables[i] = schema.Nftable{Set: merged}
+				continue
+			}
+			sets[key] = len(nftables)
+		case nftable.Map != nil:
+			key := mapObjectKey(nftable.Map)
+			if i, exists := maps[key]; exists {
+				merged, ok := mergeMaps(nftables[i].Map, nftable.Map)
+				if !ok {
+					conflicts = append(conflicts, fmt.Sprintf("map %s %s %s is defined differently", key.family, key.table, key.name))
+					continue
+				}
+				if keys := conflictingMapKeys(nftables[i].Map.Elem, nftable.Map.Elem); len(keys) > 0 {
+					conflicts = append(conflicts, fmt.Sprintf("map %s %s %s maps %s to different values",
+						key.family, key.table, key.name, strings.Join(keys, ", ")))
+					continue
+				}
+				nftables[i] = schema.Nftable{Map: merged}
+				continue
+			}
+			maps[key] = len(nftables)
+		}
+		nftables = append(nftables, nftable)
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("failed to merge config: %s", strings.Join(conflicts, ", "))
+	}
+	c.Nftables = nftables
+	return nil
+}
+
+// equalChains reports whether the chains are defined the same.
+// Priorities are compared by their numeric value, whether they were read by name or not.
+func equalChains(chain, other *schema.Chain) bool {
+	a, b := *chain, *other
+	if a.Prio != nil && b.Prio != nil {
+		a.PrioName, b.PrioName = "", ""
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func chainObjectKey(chain *schema.Chain) objectKey {
+	return objectKey{tableKey{chain.Family, chain.Table}, chain.Name}
+}
+
+func setObjectKey(set *schema.Set) objectKey {
+	return objectKey{tableKey{set.Family, set.Table}, set.Name}
+}
+
+func mapObjectKey(m *schema.Map) objectKey {
+	return objectKey{tableKey{m.Family, m.Table}, m.Name}
+}
+
+// mergeSets returns a copy of the set, joined with the elements of the other set.
+// The sets are mergeable only if they are defined the same, not considering their elements and handles.
+func mergeSets(set, other *schema.Set) (*schema.Set, bool) {
+	a, b := *set, *other
+	a.Elem, b.Elem = nil, nil
+	a.Handle, b.Handle = nil, nil
+	if !reflect.DeepEqual(a, b) {
+		return nil, false
+	}
+
+	merged := *set
+	merged.Elem = mergeElements(set.Elem, other.Elem)
+	return &merged, true
+}
+
+// mergeMaps returns a copy of the map, joined with the elements of the other map.
+// The maps are mergeable only if they are defined the same, not considering their elements and handles.
+func mergeMaps(m, other *schema.Map) (*schema.Map, bool) {
+	a, b := *m, *other
+	a.Elem, b.Elem = nil, nil
+	a.Handle, b.Handle = nil, nil
+	if !reflect.DeepEqual(a, b) {
+		return nil, false
+	}
+
+	merged := *m
+	merged.Elem = mergeElements(m.Elem, other.Elem)
+	return &merged, true
+}
+
+// mergeElements returns the elements joined with the other elements which are not already present.
+func mergeElements(elements, other []schema.Expression) []schema.Expression {
+	merged := append([]schema.Expression(nil), elements...)
+	for _, element := range other {
+		exists := false
+		for _, existing := range merged {
+			if reflect.DeepEqual(existing, element) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			merged = append(merged, element)
+		}
+	}
+	return merged
+}
+
+// conflictingMapKeys returns the keys which the map elements and the other map elements map to different values,
+// in their JSON encoding.
+func conflictingMapKeys(elements, other []schema.Expression) []string {
+	values := map[string]string{}
+	for _, element := range elements {
+		if key, value, ok := mapElementPair(element); ok {
+			values[key] = value
+		}
+	}
+
+	var keys []string
+	for _, element := range other {
+		key, value, ok := mapElementPair(element)
+		if !ok {
+			continue
+		}
+		if existing, exists := values[key]; exists && existing != value {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// mapElementPair returns the JSON encoding of the key and the value of a map element,
+// false if the element is not a pair of a key and a value.
+func mapElementPair(element schema.Expression) (string, string, bool) {
+	data, err := json.Marshal(element)
+	if err != nil {
+		return "", "", false
+	}
+	var pair [2]json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return "", "", false
+	}
+	return string(pair[0]), string(pair[1]), true
+}
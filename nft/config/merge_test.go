@@ -0,0 +1,155 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func TestMerge(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	newModuleConfig := func(chain *schema.Chain, ruleComment string) *nft.Config {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(chain)
+		config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Verdict: schema.Accept()}}, nil, nil, ruleComment))
+		return config
+	}
+	newSet := func(elements ...string) *schema.Set {
+		set := &schema.Set{Family: schema.FamilyIP, Table: tableName, Name: setName, Type: schema.SetTypeIPv4Addr}
+		for i := range elements {
+			set.Elem = append(set.Elem, schema.Expression{String: &elements[i]})
+		}
+		return set
+	}
+
+	t.Run("Merge configs sharing the same table and chain", func(t *testing.T) {
+		chain := nft.NewRegularChain(table, chainName)
+		config := newModuleConfig(chain, "module-a")
+		assert.NoError(t, config.Merge(newModuleConfig(nft.NewRegularChain(table, chainName), "module-b")))
+
+		expectedConfig := newModuleConfig(chain, "module-a")
+		expectedConfig.AddRule(nft.NewRule(table, chain, []schema.Statement{{Verdict: schema.Accept()}}, nil, nil, "module-b"))
+		assert.Equal(t, expectedConfig, config)
+	})
+
+	t.Run("Merge configs with the same set, joining the elements", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		set := newSet("10.0.0.1", "10.0.0.2")
+		config.AddSet(set)
+
+		other := nft.NewConfig()
+		other.AddTable(table)
+		other.AddSet(newSet("10.0.0.2", "10.0.0.3"))
+
+		assert.NoError(t, config.Merge(other))
+
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddTable(table)
+		expectedConfig.AddSet(newSet("10.0.0.1", "10.0.0.2", "10.0.0.3"))
+		assert.Equal(t, expectedConfig, config)
+		assert.Len(t, set.Elem, 2, "the merged set is expected to be a copy")
+	})
+
+	t.Run("Merge configs with conflicting definitions fails and leaves the config unchanged", func(t *testing.T) {
+		ctype, priority, policy := nft.TypeFilter, 0, nft.PolicyAccept
+		inputHook, outputHook := nft.HookInput, nft.HookOutput
+		config := newModuleConfig(nft.NewChain(table, chainName, &ctype, &inputHook, &priority, &policy), "module-a")
+		config.AddSet(newSet("10.0.0.1"))
+
+		other := newModuleConfig(nft.NewChain(table, chainName, &ctype, &outputHook, &priority, &policy), "module-b")
+		conflictingSet := newSet()
+		conflictingSet.Type = schema.SetTypeIPv6Addr
+		other.AddSet(conflictingSet)
+
+		expectedConfig := newModuleConfig(nft.NewChain(table, chainName, &ctype, &inputHook, &priority, &policy), "module-a")
+		expectedConfig.AddSet(newSet("10.0.0.1"))
+
+		err := config.Merge(other)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "chain ip "+tableName+" "+chainName)
+		assert.Contains(t, err.Error(), "set ip "+tableName+" "+setName)
+		assert.Equal(t, expectedConfig, config)
+	})
+	t.Run("Merge configs with the same chain priority, by name and by value", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(`{"nftables":[`+
+			`{"chain":{"family":"ip","table":"`+tableName+`","name":"input","type":"filter","hook":"input","prio":"filter","policy":"accept"}}]}`)))
+		chains, err := nft.StandardFilterChains(table)
+		assert.NoError(t, err)
+		other := nft.NewConfig()
+		other.AddChain(chains[0])
+
+		assert.NoError(t, config.Merge(other))
+		assert.Len(t, config.Nftables, 1)
+	})
+
+	t.Run("Merge configs with differently defined tables fails", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddTable(table)
+
+		other := nft.NewConfig()
+		other.AddTable(&schema.Table{Family: table.Family, Name: table.Name, Comment: "module-b"})
+
+		err := config.Merge(other)
+		assert.EqualError(t, err, "failed to merge config: table ip "+tableName+" is defined differently")
+		assert.Len(t, config.Nftables, 1)
+	})
+
+	t.Run("Merge configs with the same map", func(t *testing.T) {
+		tenantA, tenantB := schema.Verdict{Jump: &schema.ToTarget{Target: "tenant-a"}}, schema.Verdict{Jump: &schema.ToTarget{Target: "tenant-b"}}
+		mark1, mark2 := float64(1), float64(2)
+		newMap := func(elements ...schema.VmapElement) *schema.Map {
+			m, err := nft.NewVerdictMap(table, "dispatch", schema.SetTypeMark, elements...)
+			assert.NoError(t, err)
+			return m
+		}
+
+		t.Run("joining the elements", func(t *testing.T) {
+			config := nft.NewConfig()
+			config.AddMap(newMap(schema.VmapElement{Key: schema.Expression{Float64: &mark1}, Verdict: tenantA}))
+			other := nft.NewConfig()
+			other.AddMap(newMap(
+				schema.VmapElement{Key: schema.Expression{Float64: &mark1}, Verdict: tenantA},
+				schema.VmapElement{Key: schema.Expression{Float64: &mark2}, Verdict: tenantB},
+			))
+
+			assert.NoError(t, config.Merge(other))
+			assert.Equal(t, other, config)
+		})
+
+		t.Run("mapping a key to different values fails", func(t *testing.T) {
+			config := nft.NewConfig()
+			config.AddMap(newMap(schema.VmapElement{Key: schema.Expression{Float64: &mark1}, Verdict: tenantA}))
+			other := nft.NewConfig()
+			other.AddMap(newMap(schema.VmapElement{Key: schema.Expression{Float64: &mark1}, Verdict: tenantB}))
+
+			err := config.Merge(other)
+			assert.EqualError(t, err, "failed to merge config: map ip "+tableName+" dispatch maps 1 to different values")
+			assert.Len(t, config.Nftables[0].Map.Elem, 1)
+		})
+	})
+}
@@ -0,0 +1,144 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// AddSecmark appends the given secmark object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddSecmark(secmark *schema.Secmark) {
+	nftable := schema.Nftable{Secmark: secmark}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteSecmark appends a given secmark object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteSecmark(secmark *schema.Secmark) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Secmark: secmark}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddCtHelper appends the given ct helper object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddCtHelper(helper *schema.CtHelper) {
+	nftable := schema.Nftable{CtHelper: helper}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteCtHelper appends a given ct helper object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteCtHelper(helper *schema.CtHelper) {
+	nftable := schema.Nftable{Delete: &schema.Objects{CtHelper: helper}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddCtExpectation appends the given ct expectation object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddCtExpectation(expectation *schema.CtExpectation) {
+	nftable := schema.Nftable{CtExpectation: expectation}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteCtExpectation appends a given ct expectation object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteCtExpectation(expectation *schema.CtExpectation) {
+	nftable := schema.Nftable{Delete: &schema.Objects{CtExpectation: expectation}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddCtTimeout appends the given ct timeout object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddCtTimeout(timeout *schema.CtTimeout) {
+	nftable := schema.Nftable{CtTimeout: timeout}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteCtTimeout appends a given ct timeout object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteCtTimeout(timeout *schema.CtTimeout) {
+	nftable := schema.Nftable{Delete: &schema.Objects{CtTimeout: timeout}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddCounterObject appends the given named counter object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddCounterObject(counter *schema.CounterObject) {
+	nftable := schema.Nftable{Counter: counter}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteCounterObject appends a given named counter object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteCounterObject(counter *schema.CounterObject) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Counter: counter}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddQuotaObject appends the given named quota object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddQuotaObject(quota *schema.QuotaObject) {
+	nftable := schema.Nftable{Quota: quota}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteQuotaObject appends a given named quota object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteQuotaObject(quota *schema.QuotaObject) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Quota: quota}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddLimitObject appends the given named limit object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddLimitObject(limit *schema.LimitObject) {
+	nftable := schema.Nftable{Limit: limit}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteLimitObject appends a given named limit object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteLimitObject(limit *schema.LimitObject) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Limit: limit}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddSynproxyObject appends the given named synproxy object to the nftable config.
+// The object is added without an explicit action (`add`).
+func (c *Config) AddSynproxyObject(synproxy *schema.SynproxyObject) {
+	nftable := schema.Nftable{Synproxy: synproxy}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteSynproxyObject appends a given named synproxy object to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced object, results with a failure when the config is applied.
+func (c *Config) DeleteSynproxyObject(synproxy *schema.SynproxyObject) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Synproxy: synproxy}}
+	c.Nftables = append(c.Nftables, nftable)
+}
@@ -0,0 +1,381 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+const (
+	secmarkName    = "sshtag"
+	secmarkContext = "system_u:object_r:ssh_server_packet_t:s0"
+)
+
+func TestSecmark(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyINET)
+
+	t.Run("Add secmark object, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddSecmark(nft.NewSecmark(table, secmarkName, secmarkContext))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"secmark":{"family":"inet","table":%q,"name":%q,"context":%q}}]}`,
+			tableName, secmarkName, secmarkContext,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Delete secmark object, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.DeleteSecmark(nft.NewSecmark(table, secmarkName, ""))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"delete":{"secmark":{"family":"inet","table":%q,"name":%q,"context":""}}}]}`,
+			tableName, secmarkName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Read secmark object from nft output", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(
+			`{"nftables":[{"secmark":{"family":"inet","name":%q,"table":%q,"handle":4,"context":%q}}]}`,
+			secmarkName, tableName, secmarkContext,
+		)
+
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		handle := 4
+		secmark := nft.NewSecmark(table, secmarkName, secmarkContext)
+		secmark.Handle = &handle
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddSecmark(secmark)
+
+		assert.Equal(t, expectedConfig, config)
+	})
+
+	t.Run("Add rule which sets secmark, check round-trip", func(t *testing.T) {
+		chain := nft.NewRegularChain(table, chainName)
+		rule := nft.NewRule(table, chain, []schema.Statement{nft.SecmarkSet(secmarkName)}, nil, nil, "")
+
+		config := nft.NewConfig()
+		config.AddRule(rule)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"inet","table":%q,"chain":%q,"expr":[{"secmark":%q}]}}]}`,
+			tableName, chainName, secmarkName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		var deserializedConfig nft.Config
+		assert.NoError(t, json.Unmarshal(serializedConfig, &deserializedConfig))
+		assert.Equal(t, config, &deserializedConfig)
+	})
+}
+
+func TestCtHelper(t *testing.T) {
+	const helperName = "ftp-standard"
+	table := nft.NewTable(tableName, nft.FamilyIP)
+
+	// As listed by nft for: ct helper ftp-standard { type "ftp" protocol tcp; l3proto ip; }
+	serializedHelper := fmt.Sprintf(
+		`{"nftables":[{"ct helper":{"family":"ip","table":%q,"name":%q,"handle":3,"type":"ftp","protocol":"tcp","l3proto":"ip"}}]}`,
+		tableName, helperName,
+	)
+	handle := 3
+	helper := nft.NewCtHelper(table, helperName, "ftp", "tcp")
+	helper.Handle = &handle
+	helper.L3Proto = schema.FamilyIP
+
+	t.Run("Add ct helper object, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddCtHelper(helper)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedHelper, string(serializedConfig))
+	})
+
+	t.Run("Read ct helper object from nft output", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedHelper)))
+
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddCtHelper(helper)
+		assert.Equal(t, expectedConfig, config)
+	})
+
+	t.Run("Delete ct helper object, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.DeleteCtHelper(nft.NewCtHelper(table, helperName, "", ""))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"delete":{"ct helper":{"family":"ip","table":%q,"name":%q,"type":"","protocol":""}}}]}`,
+			tableName, helperName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Add rule which sets ct helper, check round-trip", func(t *testing.T) {
+		chain := nft.NewRegularChain(table, chainName)
+		rule := nft.NewRule(table, chain, []schema.Statement{nft.CtHelperSet(helperName)}, nil, nil, "")
+
+		config := nft.NewConfig()
+		config.AddRule(rule)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"ip","table":%q,"chain":%q,"expr":[{"ct helper":%q}]}}]}`,
+			tableName, chainName, helperName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		var deserializedConfig nft.Config
+		assert.NoError(t, json.Unmarshal(serializedConfig, &deserializedConfig))
+		assert.Equal(t, config, &deserializedConfig)
+	})
+}
+
+func TestCtExpectation(t *testing.T) {
+	const expectationName = "e_pgsql"
+	serializedExpectation := fmt.Sprintf(
+		`{"nftables":[{"ct expectation":{"family":"ip","table":%q,"name":%q,"handle":5,`+
+			`"l3proto":"ip","protocol":"tcp","dport":5432,"timeout":3600000,"size":12}}]}`,
+		tableName, expectationName,
+	)
+
+	handle := 5
+	expectation := &schema.CtExpectation{
+		Family:   schema.FamilyIP,
+		Table:    tableName,
+		Name:     expectationName,
+		Handle:   &handle,
+		L3Proto:  schema.FamilyIP,
+		Protocol: "tcp",
+		Dport:    5432,
+		Timeout:  3600000,
+		Size:     12,
+	}
+
+	t.Run("Read ct expectation object, check round-trip", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedExpectation)))
+
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddCtExpectation(expectation)
+		assert.Equal(t, expectedConfig, config)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedExpectation, string(serializedConfig))
+	})
+
+	t.Run("Add rule which sets ct expectation, check serialization", func(t *testing.T) {
+		table := nft.NewTable(tableName, nft.FamilyIP)
+		chain := nft.NewRegularChain(table, chainName)
+		config := nft.NewConfig()
+		config.AddRule(nft.NewRule(table, chain, []schema.Statement{nft.CtExpectationSet(expectationName)}, nil, nil, ""))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"ip","table":%q,"chain":%q,"expr":[{"ct expectation":%q}]}}]}`,
+			tableName, chainName, expectationName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+}
+
+func TestCtTimeout(t *testing.T) {
+	const timeoutName = "tcp_short"
+	serializedTimeout := fmt.Sprintf(
+		`{"nftables":[{"ct timeout":{"family":"ip","table":%q,"name":%q,"handle":6,`+
+			`"protocol":"tcp","l3proto":"ip","policy":{"close":10,"established":120,"syn_sent":5}}}]}`,
+		tableName, timeoutName,
+	)
+
+	handle := 6
+	timeout := &schema.CtTimeout{
+		Family:   schema.FamilyIP,
+		Table:    tableName,
+		Name:     timeoutName,
+		Handle:   &handle,
+		Protocol: "tcp",
+		L3Proto:  schema.FamilyIP,
+		Policy:   map[string]int{"established": 120, "close": 10, "syn_sent": 5},
+	}
+
+	t.Run("Read ct timeout object, check round-trip", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedTimeout)))
+
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddCtTimeout(timeout)
+		assert.Equal(t, expectedConfig, config)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedTimeout, string(serializedConfig))
+	})
+
+	t.Run("Add rule which sets ct timeout, check round-trip", func(t *testing.T) {
+		table := nft.NewTable(tableName, nft.FamilyIP)
+		chain := nft.NewRegularChain(table, chainName)
+		config := nft.NewConfig()
+		config.AddCtTimeout(nft.NewCtTimeout(table, timeoutName, "tcp", map[string]int{"established": 120}))
+		config.AddRule(nft.NewRule(table, chain, []schema.Statement{nft.CtTimeoutSet(timeoutName)}, nil, nil, ""))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[`+
+				`{"ct timeout":{"family":"ip","table":%[1]q,"name":%[3]q,"protocol":"tcp","policy":{"established":120}}},`+
+				`{"rule":{"family":"ip","table":%[1]q,"chain":%[2]q,"expr":[{"ct timeout":%[3]q}]}}]}`,
+			tableName, chainName, timeoutName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON(serializedConfig))
+		assert.Equal(t, config, deserializedConfig)
+	})
+}
+
+func TestNamedObjects(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyINET)
+
+	t.Run("Read named objects from nft output", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(`{"nftables":[`+
+			`{"counter":{"family":"inet","name":"cnt","table":%[1]q,"handle":"2","packets":"10","bytes":840}},`+
+			`{"quota":{"family":"inet","name":"qt","table":%[1]q,"handle":3,"bytes":1048576,"used":1024,"inv":true}},`+
+			`{"limit":{"family":"inet","name":"lim","table":%[1]q,"handle":4,"rate":10,"per":"second","burst":5}},`+
+			`{"synproxy":{"family":"inet","name":"syn","table":%[1]q,"handle":5,"mss":1460,"wscale":7,"flags":["timestamp","sack-perm"]}}]}`,
+			tableName,
+		)
+
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		handles := []int{2, 3, 4, 5}
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddCounterObject(&schema.CounterObject{
+			Family: "inet", Table: tableName, Name: "cnt", Handle: &handles[0], Packets: 10, Bytes: 840,
+		})
+		expectedConfig.AddQuotaObject(&schema.QuotaObject{
+			Family: "inet", Table: tableName, Name: "qt", Handle: &handles[1], Bytes: 1048576, Used: 1024, Inv: true,
+		})
+		expectedConfig.AddLimitObject(&schema.LimitObject{
+			Family: "inet", Table: tableName, Name: "lim", Handle: &handles[2], Rate: 10, Per: schema.LimitPerSecond, Burst: 5,
+		})
+		expectedConfig.AddSynproxyObject(&schema.SynproxyObject{
+			Family: "inet", Table: tableName, Name: "syn", Handle: &handles[3], Mss: 1460, Wscale: 7,
+			Flags: &schema.Flags{Flags: []string{"timestamp", "sack-perm"}},
+		})
+		assert.Equal(t, expectedConfig, config)
+	})
+
+	t.Run("Delete named counter object, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.DeleteCounterObject(&schema.CounterObject{Family: "inet", Table: tableName, Name: "cnt"})
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"delete":{"counter":{"family":"inet","table":%q,"name":"cnt","packets":0,"bytes":0}}}]}`,
+			tableName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Add rules which reference named objects, check round-trip", func(t *testing.T) {
+		chain := nft.NewRegularChain(table, chainName)
+		statements := []schema.Statement{
+			nft.CounterRef("cnt"),
+			nft.QuotaRef("qt"),
+			nft.LimitRef("lim"),
+			nft.SynproxyRef("syn"),
+			{Counter: &schema.Counter{Packets: 1, Bytes: 60}},
+			{Quota: &schema.Quota{Val: 10, ValUnit: "mbytes"}},
+			{Synproxy: &schema.Synproxy{Mss: 1460}},
+		}
+
+		config := nft.NewConfig()
+		config.AddRule(nft.NewRule(table, chain, statements, nil, nil, ""))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"inet","table":%q,"chain":%q,"expr":[`+
+				`{"counter":"cnt"},{"quota":"qt"},{"limit":"lim"},{"synproxy":"syn"},`+
+				`{"counter":{"packets":1,"bytes":60}},{"quota":{"val":10,"val_unit":"mbytes"}},{"synproxy":{"mss":1460}}]}}]}`,
+			tableName, chainName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON(serializedConfig))
+		assert.Equal(t, config, deserializedConfig)
+	})
+
+	t.Run("Read rule which references a counter through a map", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"inet","table":%q,"chain":%q,"expr":[`+
+				`{"counter":{"map":{"key":{"meta":{"key":"iifname"}},"data":"@counters"}}}]}}]}`,
+			tableName, chainName,
+		)
+
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		statement := config.Nftables[0].Rule.Expr[0]
+		assert.Nil(t, statement.Counter)
+		assert.NotNil(t, statement.CounterRef)
+		assert.Equal(t, schema.MetaKeyIifname, statement.CounterRef.Map.Key.Meta.Key)
+		assert.Equal(t, "@counters", *statement.CounterRef.Map.Data.String)
+		serializedRef, err := json.Marshal(statement.CounterRef)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"map":{"key":{"meta":{"key":"iifname"}},"data":"@counters"}}`, string(serializedRef))
+	})
+}
@@ -0,0 +1,65 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// OrderByDependencies reorders the nftable config entries, such that chains are defined before
+// the rules which jump (or goto) to them.
+// A chain definition which follows the first rule referencing it is moved to precede that rule.
+// Only entries without an explicit action are reordered, and a chain is not moved across
+// an entry with an explicit action (e.g. `delete`), preserving the meaning of the config.
+// The relative order of all other entries is kept.
+func (c *Config) OrderByDependencies() {
+	nftables := c.Nftables
+	for i := 0; i < len(nftables); i++ {
+		r := nftables[i].Rule
+		if r == nil {
+			continue
+		}
+		for _, target := range ruleJumpTargets(r) {
+			j := laterChainDefinition(nftables, i, chainKey{tableKey{r.Family, r.Table}, target})
+			if j < 0 {
+				continue
+			}
+			chain := nftables[j]
+			copy(nftables[i+1:j+1], nftables[i:j])
+			nftables[i] = chain
+			i++
+		}
+	}
+}
+
+// laterChainDefinition returns the index of the chain definition following the given position,
+// -1 if there is none or an entry with an explicit action precedes it.
+func laterChainDefinition(nftables []schema.Nftable, position int, key chainKey) int {
+	for j := position + 1; j < len(nftables); j++ {
+		nftable := nftables[j]
+		if nftable.Add != nil || nftable.Create != nil || nftable.Delete != nil || nftable.Flush != nil {
+			return -1
+		}
+		if ch := nftable.Chain; ch != nil && (chainKey{tableKey{ch.Family, ch.Table}, ch.Name}) == key {
+			return j
+		}
+	}
+	return -1
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func TestOrderByDependencies(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	baseChain := nft.NewRegularChain(table, "base")
+	jumpTarget := nft.NewRegularChain(table, "jump-target")
+	gotoTarget := nft.NewRegularChain(table, "goto-target")
+	jumpRule := nft.NewRule(table, baseChain, []schema.Statement{{Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: jumpTarget.Name}}}}, nil, nil, "")
+	gotoRule := nft.NewRule(table, jumpTarget, []schema.Statement{{Verdict: schema.Verdict{Goto: &schema.ToTarget{Target: gotoTarget.Name}}}}, nil, nil, "")
+
+	t.Run("Order chains defined after the rules jumping to them", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(baseChain)
+		config.AddRule(jumpRule)
+		config.AddRule(gotoRule)
+		config.AddChain(jumpTarget)
+		config.AddChain(gotoTarget)
+		config.OrderByDependencies()
+
+		expected := nft.NewConfig()
+		expected.AddTable(table)
+		expected.AddChain(baseChain)
+		expected.AddChain(jumpTarget)
+		expected.AddRule(jumpRule)
+		expected.AddChain(gotoTarget)
+		expected.AddRule(gotoRule)
+		assert.Equal(t, expected, config)
+	})
+
+	t.Run("Order chains defined before the rules jumping to them", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(baseChain)
+		config.AddChain(jumpTarget)
+		config.AddRule(jumpRule)
+
+		expected := nft.NewConfig()
+		expected.Nftables = append(expected.Nftables, config.Nftables...)
+		config.OrderByDependencies()
+		assert.Equal(t, expected, config)
+	})
+
+	t.Run("Order a chain defined after an explicit action", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddTable(table)
+		config.AddChain(baseChain)
+		config.AddRule(jumpRule)
+		config.DeleteChain(jumpTarget)
+		config.AddChain(jumpTarget)
+
+		expected := nft.NewConfig()
+		expected.Nftables = append(expected.Nftables, config.Nftables...)
+		config.OrderByDependencies()
+		assert.Equal(t, expected, config)
+	})
+}
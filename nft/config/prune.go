@@ -0,0 +1,181 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+type tableKey struct {
+	family string
+	table  string
+}
+
+type chainKey struct {
+	tableKey
+	chain string
+}
+
+// Prune removes from the nftable config the chains which have no rules and
+// the tables which are left with no chains or other objects.
+// The removed entries are returned, in their original order.
+// Only entries without an explicit action (as the ones read from the system) are considered.
+// Chains which are the target of a jump or goto are not removed, including the targets of
+// the verdicts in named verdict maps.
+// Base chains are removed only when pruneBaseChains is set, as being attached to a hook,
+// an empty base chain still affects traffic through its policy.
+func (c *Config) Prune(pruneBaseChains bool) []schema.Nftable {
+	usedChains := map[chainKey]bool{}
+	for _, nftable := range c.Nftables {
+		if r := nftable.Rule; r != nil {
+			usedChains[chainKey{tableKey{r.Family, r.Table}, r.Chain}] = true
+			for _, target := range ruleJumpTargets(r) {
+				usedChains[chainKey{tableKey{r.Family, r.Table}, target}] = true
+			}
+		}
+		// Chains may be jumped to through the verdicts of named maps (e.g. `vmap @dispatch`).
+		if m := nftable.Map; m != nil && m.Map == schema.SetTypeVerdict {
+			for _, target := range elementJumpTargets(m.Elem) {
+				usedChains[chainKey{tableKey{m.Family, m.Table}, target}] = true
+			}
+		}
+		if e := nftable.Element; e != nil {
+			for _, target := range elementJumpTargets(e.Elem) {
+				usedChains[chainKey{tableKey{e.Family, e.Table}, target}] = true
+			}
+		}
+	}
+
+	var removed []schema.Nftable
+	var nftables []schema.Nftable
+	for _, nftable := range c.Nftables {
+		if ch := nftable.Chain; ch != nil {
+			isBaseChain := ch.Hook != ""
+			if !usedChains[chainKey{tableKey{ch.Family, ch.Table}, ch.Name}] && (!isBaseChain || pruneBaseChains) {
+				removed = append(removed, nftable)
+				continue
+			}
+		}
+		nftables = append(nftables, nftable)
+	}
+
+	usedTables := map[tableKey]bool{}
+	for _, nftable := range nftables {
+		if key, ok := tableOf(nftable); ok && nftable.Table == nil {
+			usedTables[key] = true
+		}
+	}
+
+	c.Nftables = nftables[:0]
+	for _, nftable := range nftables {
+		if t := nftable.Table; t != nil && !usedTables[tableKey{t.Family, t.Name}] {
+			removed = append(removed, nftable)
+			continue
+		}
+		c.Nftables = append(c.Nftables, nftable)
+	}
+
+	return removed
+}
+
+// tableOf returns the table to which a config entry without an explicit action belongs.
+func tableOf(nftable schema.Nftable) (tableKey, bool) {
+	switch {
+	case nftable.Table != nil:
+		return tableKey{nftable.Table.Family, nftable.Table.Name}, true
+	case nftable.Chain != nil:
+		return tableKey{nftable.Chain.Family, nftable.Chain.Table}, true
+	case nftable.Rule != nil:
+		return tableKey{nftable.Rule.Family, nftable.Rule.Table}, true
+	case nftable.Secmark != nil:
+		return tableKey{nftable.Secmark.Family, nftable.Secmark.Table}, true
+	case nftable.Set != nil:
+		return tableKey{nftable.Set.Family, nftable.Set.Table}, true
+	case nftable.Map != nil:
+		return tableKey{nftable.Map.Family, nftable.Map.Table}, true
+	case nftable.Element != nil:
+		return tableKey{nftable.Element.Family, nftable.Element.Table}, true
+	case nftable.Counter != nil:
+		return tableKey{nftable.Counter.Family, nftable.Counter.Table}, true
+	case nftable.Quota != nil:
+		return tableKey{nftable.Quota.Family, nftable.Quota.Table}, true
+	case nftable.Limit != nil:
+		return tableKey{nftable.Limit.Family, nftable.Limit.Table}, true
+	case nftable.Synproxy != nil:
+		return tableKey{nftable.Synproxy.Family, nftable.Synproxy.Table}, true
+	case nftable.CtHelper != nil:
+		return tableKey{nftable.CtHelper.Family, nftable.CtHelper.Table}, true
+	case nftable.CtExpectation != nil:
+		return tableKey{nftable.CtExpectation.Family, nftable.CtExpectation.Table}, true
+	case nftable.CtTimeout != nil:
+		return tableKey{nftable.CtTimeout.Family, nftable.CtTimeout.Table}, true
+	}
+	return tableKey{}, false
+}
+
+// ruleJumpTargets returns the chains the rule may jump to (or goto).
+func ruleJumpTargets(rule *schema.Rule) []string {
+	var targets []string
+	for _, statement := range rule.Expr {
+		targets = append(targets, verdictJumpTargets(statement.Verdict)...)
+		if statement.Vmap != nil {
+			for _, element := range statement.Vmap.Elements {
+				targets = append(targets, verdictJumpTargets(element.Verdict)...)
+			}
+		}
+	}
+	return targets
+}
+
+// elementJumpTargets returns the chains the verdicts of the map elements may jump to (or goto).
+// Each element of a verdict map is a pair of the key and its verdict, other elements are ignored.
+func elementJumpTargets(elements []schema.Expression) []string {
+	var targets []string
+	for _, element := range elements {
+		data, err := json.Marshal(element)
+		if err != nil {
+			continue
+		}
+		var pair [2]json.RawMessage
+		if err := json.Unmarshal(data, &pair); err != nil {
+			continue
+		}
+		var statement schema.Statement
+		if err := json.Unmarshal(pair[1], &statement); err != nil {
+			continue
+		}
+		targets = append(targets, verdictJumpTargets(statement.Verdict)...)
+	}
+	return targets
+}
+
+// verdictJumpTargets returns the chain the verdict jumps to (or goto), if any.
+func verdictJumpTargets(v schema.Verdict) []string {
+	var targets []string
+	if v.Jump != nil {
+		targets = append(targets, v.Jump.Target)
+	}
+	if v.Goto != nil {
+		targets = append(targets, v.Goto.Target)
+	}
+	return targets
+}
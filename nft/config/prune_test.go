@@ -0,0 +1,130 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func TestPrune(t *testing.T) {
+	tableUsed := nft.NewTable("table-used", nft.FamilyIP)
+	tableEmpty := nft.NewTable("table-empty", nft.FamilyIP)
+	tableWithObject := nft.NewTable("table-with-object", nft.FamilyIP)
+
+	ctype, hook, prio := nft.TypeFilter, nft.HookInput, 0
+	baseChain := nft.NewChain(tableUsed, "base", &ctype, &hook, &prio, nil)
+	chainWithRule := nft.NewRegularChain(tableUsed, "with-rule")
+	chainJumpTarget := nft.NewRegularChain(tableUsed, "jump-target")
+	chainEmpty := nft.NewRegularChain(tableUsed, "empty")
+	jump := schema.Statement{Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: chainJumpTarget.Name}}}
+	rule := nft.NewRule(tableUsed, chainWithRule, []schema.Statement{jump}, nil, nil, "")
+
+	buildConfig := func() *nft.Config {
+		config := nft.NewConfig()
+		config.Nftables = append(config.Nftables, schema.Nftable{Metainfo: &schema.Metainfo{JsonSchemaVersion: 1}})
+		config.AddTable(tableUsed)
+		config.AddTable(tableEmpty)
+		config.AddTable(tableWithObject)
+		config.AddChain(baseChain)
+		config.AddChain(chainWithRule)
+		config.AddChain(chainJumpTarget)
+		config.AddChain(chainEmpty)
+		config.AddRule(rule)
+		config.AddSecmark(nft.NewSecmark(tableWithObject, "mysecmark", "system_u:object_r:default_t:s0"))
+		return config
+	}
+
+	t.Run("Prune empty regular chains and tables", func(t *testing.T) {
+		config := buildConfig()
+		removed := config.Prune(false)
+
+		assert.Equal(t, []schema.Nftable{{Chain: chainEmpty}, {Table: tableEmpty}}, removed)
+
+		expectedConfig := buildConfig()
+		expectedConfig.Nftables = append(expectedConfig.Nftables[:2], expectedConfig.Nftables[3:]...)
+		expectedConfig.Nftables = append(expectedConfig.Nftables[:6], expectedConfig.Nftables[7:]...)
+		assert.Equal(t, expectedConfig, config)
+	})
+
+	t.Run("Prune empty chains, including base chains, and tables", func(t *testing.T) {
+		config := buildConfig()
+		removed := config.Prune(true)
+
+		assert.Equal(t, []schema.Nftable{{Chain: baseChain}, {Chain: chainEmpty}, {Table: tableEmpty}}, removed)
+		assert.Nil(t, config.LookupChain(baseChain))
+		assert.NotNil(t, config.LookupChain(chainJumpTarget))
+		assert.NotNil(t, config.LookupTable(tableWithObject))
+	})
+
+	t.Run("Prune a config with nothing to remove", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddTable(tableUsed)
+		config.AddChain(chainWithRule)
+		config.AddRule(rule)
+
+		assert.Empty(t, config.Prune(true))
+		assert.Len(t, config.Nftables, 3)
+	})
+
+	t.Run("Prune a config with chains jumped to through a named verdict map", func(t *testing.T) {
+		mapTarget := nft.NewRegularChain(tableUsed, "map-target")
+		elementTarget := nft.NewRegularChain(tableUsed, "element-target")
+		mark1, mark2 := float64(1), float64(2)
+		dispatch, err := nft.NewVerdictMap(tableUsed, "dispatch", schema.SetTypeMark,
+			schema.VmapElement{Key: schema.Expression{Float64: &mark1}, Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: mapTarget.Name}}},
+		)
+		assert.NoError(t, err)
+		added, err := nft.NewVerdictMap(tableUsed, "dispatch", schema.SetTypeMark,
+			schema.VmapElement{Key: schema.Expression{Float64: &mark2}, Verdict: schema.Verdict{Goto: &schema.ToTarget{Target: elementTarget.Name}}},
+		)
+		assert.NoError(t, err)
+
+		config := nft.NewConfig()
+		config.AddTable(tableUsed)
+		config.AddChain(mapTarget)
+		config.AddChain(elementTarget)
+		config.AddChain(chainEmpty)
+		config.AddMap(dispatch)
+		config.AddElements(&schema.Element{Family: added.Family, Table: added.Table, Name: added.Name, Elem: added.Elem})
+		config.AddRule(nft.NewRule(tableUsed, chainWithRule, []schema.Statement{
+			nft.VmapLookup(schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyMark}}, dispatch.Name),
+		}, nil, nil, ""))
+
+		assert.Equal(t, []schema.Nftable{{Chain: chainEmpty}}, config.Prune(false))
+		assert.NotNil(t, config.LookupChain(mapTarget))
+		assert.NotNil(t, config.LookupChain(elementTarget))
+	})
+
+	t.Run("Prune a config read with a named verdict map", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(`{"nftables":[`+
+			`{"table":{"family":"ip","name":"table-used"}},`+
+			`{"chain":{"family":"ip","table":"table-used","name":"tenant-a"}},`+
+			`{"map":{"family":"ip","table":"table-used","name":"dispatch","type":"mark","map":"verdict",`+
+			`"elem":[[1,{"jump":{"target":"tenant-a"}}],[2,{"drop":null}]]}}]}`)))
+
+		assert.Empty(t, config.Prune(false))
+	})
+}
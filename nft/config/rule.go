@@ -81,6 +81,28 @@ func (c *Config) LookupRule(toFind *schema.Rule) []*schema.Rule {
 	return rules
 }
 
+// CounterByComment returns the inline counters of the commented rules, keyed by the rule comment.
+// Rules without a comment or a counter are skipped.
+// The counters of rules sharing the same comment, and of multiple counters in a rule, are summed.
+func (c *Config) CounterByComment() map[string]schema.Counter {
+	counters := map[string]schema.Counter{}
+	for _, nftable := range c.Nftables {
+		r := nftable.Rule
+		if r == nil || r.Comment == "" {
+			continue
+		}
+		for _, statement := range r.Expr {
+			if statement.Counter != nil {
+				counter := counters[r.Comment]
+				counter.Packets += statement.Counter.Packets
+				counter.Bytes += statement.Counter.Bytes
+				counters[r.Comment] = counter
+			}
+		}
+	}
+	return counters
+}
+
 func areStatementsEqual(statementA, statementB schema.Statement) (bool, error) {
 	statementARow, err := json.Marshal(statementA)
 	if err != nil {
@@ -23,6 +23,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	assert "github.com/stretchr/testify/require"
 
@@ -43,12 +44,42 @@ func TestRule(t *testing.T) {
 	testDeleteRule(t)
 
 	testAddRuleWithRowExpression(t)
+	testAddRuleWithRowStatement(t)
 	testAddRuleWithCounter(t)
 	testAddRuleWithNAT(t)
+	testAddRuleWithVmap(t)
+	testAddRuleWithNamedVmap(t)
+	testAddRuleWithConcatVmap(t)
+	testAddRuleWithMetaMatch(t)
+	testAddRulesWithLogThenDrop(t)
+	testAddRuleWithLogAndVerdict(t)
+	testAddRuleWithOsfMatch(t)
+	testAddRuleWithRtMatch(t)
+	testAddRuleWithCgroupMatch(t)
+	testAddRuleWithSampling(t)
+	testAddRuleWithIPAddresses(t)
+	testAddRuleWithMssClamping(t)
+	testAddRuleWithDSCPAndECN(t)
+	testAddRuleWithARPMatch(t)
+	testAddRuleWithVlanMatch(t)
+	testAddRuleWithEtherMangle(t)
+	testAddRuleWithCtMatch(t)
+	testAddRuleWithFragmentDrop(t)
+	testAddRuleWithReject(t)
+	testAddRuleWithLast(t)
+	testAddRuleWithConnLimit(t)
+	testAddRuleWithMapLookup(t)
+	testAddRuleWithLoadBalancing(t)
+	testAddRuleWithPortMatch(t)
+
+	testFromIptablesRule(t)
 
 	testRuleLookup(t)
+	testCounterByComment(t)
 
 	testReadRuleWithNumericalExpression(t)
+	testReadRuleWithNumbersAsStrings(t)
+	testReadRuleRoundTrip(t)
 }
 
 func testAddRuleWithRowExpression(t *testing.T) {
@@ -87,6 +118,25 @@ func testAddRuleWithRowExpression(t *testing.T) {
 	})
 }
 
+func testAddRuleWithRowStatement(t *testing.T) {
+	t.Run("Add rule with a row statement, check serialization", func(t *testing.T) {
+		testSerializationWith(t, rowStatements)
+	})
+	t.Run("Add rule with a row statement, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, rowStatements)
+	})
+}
+
+// rowStatements returns the statements of: notrack counter, the notrack statement being unknown to the schema.
+func rowStatements() ([]schema.Statement, string) {
+	statements := []schema.Statement{
+		{RowData: json.RawMessage(`{"notrack":null}`)},
+		{Counter: &schema.Counter{}},
+	}
+	serializedStatements := `"expr":[{"notrack":null},{"counter":{"packets":0,"bytes":0}}]`
+	return statements, serializedStatements
+}
+
 func testAddRuleWithMatchAndVerdict(t *testing.T) {
 	const comment = "mycomment"
 
@@ -274,6 +324,25 @@ func testRuleLookup(t *testing.T) {
 	})
 }
 
+func testCounterByComment(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+
+	config := nft.NewConfig()
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Counter: &schema.Counter{Packets: 1, Bytes: 60}}}, nil, nil, "ssh"))
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Counter: &schema.Counter{Packets: 2, Bytes: 120}}}, nil, nil, "http"))
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Counter: &schema.Counter{Packets: 3, Bytes: 180}}}, nil, nil, "http"))
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Verdict: schema.Drop()}}, nil, nil, "no-counter"))
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{{Counter: &schema.Counter{Packets: 4, Bytes: 240}}}, nil, nil, ""))
+
+	t.Run("Collect rule counters by comment", func(t *testing.T) {
+		assert.Equal(t, map[string]schema.Counter{
+			"ssh":  {Packets: 1, Bytes: 60},
+			"http": {Packets: 5, Bytes: 300},
+		}, config.CounterByComment())
+	})
+}
+
 func testReadRuleWithNumericalExpression(t *testing.T) {
 	t.Run("Read rule with numerical expression", func(t *testing.T) {
 		c := nft.NewConfig()
@@ -285,6 +354,93 @@ func testReadRuleWithNumericalExpression(t *testing.T) {
 	})
 }
 
+func testReadRuleWithNumbersAsStrings(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+
+	handle, index := 5, 2
+	expectedRule := nft.NewRule(table, chain, []schema.Statement{{Counter: &schema.Counter{Packets: 10, Bytes: 840}}}, &handle, &index, "")
+	expectedConfig := nft.NewConfig()
+	expectedConfig.AddRule(expectedRule)
+
+	ruleArgs := fmt.Sprintf(`"family":%q,"table":%q,"chain":%q`, nft.FamilyIP, tableName, chainName)
+	representations := map[string]string{
+		"numbers": `"expr":[{"counter":{"packets":10,"bytes":840}}],"handle":5,"index":2`,
+		"strings": `"expr":[{"counter":{"packets":"10","bytes":"840"}}],"handle":"5","index":"2"`,
+		"mixed":   `"expr":[{"counter":{"packets":10,"bytes":"840"}}],"handle":"5","index":2`,
+	}
+	for name, representation := range representations {
+		t.Run(fmt.Sprintf("Read rule with handle, index and counter as %s", name), func(t *testing.T) {
+			config := nft.NewConfig()
+			serializedConfig := fmt.Sprintf(`{"nftables":[{"rule":{%s,%s}}]}`, ruleArgs, representation)
+			assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+			assert.Equal(t, expectedConfig, config)
+		})
+	}
+
+	t.Run("Read rule with an invalid numeric string", func(t *testing.T) {
+		config := nft.NewConfig()
+		serializedConfig := fmt.Sprintf(`{"nftables":[{"rule":{%s,"handle":"five"}}]}`, ruleArgs)
+		assert.Error(t, config.FromJSON([]byte(serializedConfig)))
+	})
+}
+
+func testReadRuleRoundTrip(t *testing.T) {
+	t.Run("Read rule with statements known and unknown to the schema, check round-trip", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(`{"nftables":[{"rule":{"family":"inet","table":%q,"chain":%q,"expr":[`+
+			`{"match":{"op":"==","left":{"meta":{"key":"l4proto"}},"right":"tcp"}},`+
+			`{"flow":{"op":"add","flowtable":"@ft"}},`+
+			`{"counter":"cnt"},`+
+			`{"counter":{"packets":3,"bytes":180}},`+
+			`{"ct helper":"ftp-standard"},`+
+			`{"queue":{"num":{"range":[1,3]},"flags":["bypass","fanout"]}},`+
+			`{"log":null},`+
+			`{"masquerade":null},`+
+			`{"xt":{"type":"target","name":"CLASSIFY"}},`+
+			`{"jump":{"target":"web"}}],"handle":4}}]}`,
+			tableName, chainName,
+		)
+
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		statements := config.Nftables[0].Rule.Expr
+		assert.Len(t, statements, 10)
+		assert.NotNil(t, statements[0].Match)
+		assert.NotNil(t, statements[1].RowData, "unknown statements are expected to be kept as row data")
+		assert.NotNil(t, statements[2].CounterRef)
+		assert.NotNil(t, statements[3].Counter)
+		assert.NotNil(t, statements[4].CtHelper)
+		assert.NotNil(t, statements[5].RowData)
+		assert.NotNil(t, statements[6].Log)
+		assert.NotNil(t, statements[7].Masquerade)
+		assert.NotNil(t, statements[8].RowData)
+		assert.NotNil(t, statements[9].Jump)
+
+		reserializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(reserializedConfig))
+	})
+
+	t.Run("Read rule with a null counter, check round-trip", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"inet","table":%q,"chain":%q,"expr":[{"counter":null}]}}]}`,
+			tableName, chainName,
+		))))
+
+		statements := config.Nftables[0].Rule.Expr
+		assert.Equal(t, &schema.Counter{}, statements[0].Counter)
+
+		reserializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(
+			`{"nftables":[{"rule":{"family":"inet","table":%q,"chain":%q,"expr":[{"counter":{"packets":0,"bytes":0}}]}}]}`,
+			tableName, chainName,
+		), string(reserializedConfig))
+	})
+}
+
 func testAddRuleWithCounter(t *testing.T) {
 	const comment = "mycomment"
 
@@ -352,6 +508,1079 @@ func testAddRuleWithNAT(t *testing.T) {
 	}
 }
 
+func testAddRuleWithVmap(t *testing.T) {
+	t.Run("Add rule with vmap, check serialization is stable", func(t *testing.T) {
+		statements, serializedStatements := vmapStatements()
+
+		table := nft.NewTable(tableName, nft.FamilyIP)
+		chain := nft.NewRegularChain(table, chainName)
+		config := nft.NewConfig()
+		config.AddRule(nft.NewRule(table, chain, statements, nil, nil, ""))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		expectedConfig := buildSerializedConfig(ruleADD, serializedStatements, nil, "")
+		assert.Equal(t, string(expectedConfig), string(serializedConfig))
+
+		statements[0].Vmap.Elements[0], statements[0].Vmap.Elements[2] = statements[0].Vmap.Elements[2], statements[0].Vmap.Elements[0]
+		statements[0].Vmap.SortElements()
+		serializedConfig, err = config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, string(expectedConfig), string(serializedConfig))
+	})
+
+	t.Run("Add rule with vmap, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, vmapStatements)
+	})
+}
+
+func testAddRuleWithNamedVmap(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	mark1, mark2 := float64(1), float64(2)
+	dispatch, err := nft.NewVerdictMap(table, "dispatch", schema.SetTypeMark,
+		schema.VmapElement{Key: schema.Expression{Float64: &mark1}, Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: "tenant-a"}}},
+		schema.VmapElement{Key: schema.Expression{Float64: &mark2}, Verdict: schema.Drop()},
+	)
+	assert.NoError(t, err)
+
+	config := nft.NewConfig()
+	config.AddMap(dispatch)
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{
+		nft.VmapLookup(schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyMark}}, "dispatch"),
+	}, nil, nil, ""))
+
+	serializedConfig := fmt.Sprintf(`{"nftables":[`+
+		`{"map":{"family":"ip","table":%[1]q,"name":"dispatch","type":"mark","map":"verdict",`+
+		`"elem":[[1,{"jump":{"target":"tenant-a"}}],[2,{"drop":null}]]}},`+
+		`{"rule":{"family":"ip","table":%[1]q,"chain":%[2]q,"expr":[{"vmap":{"key":{"meta":{"key":"mark"}},"data":"@dispatch"}}]}}]}`,
+		tableName, chainName,
+	)
+
+	t.Run("Add rule with a named vmap lookup, check serialization", func(t *testing.T) {
+		serialized, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(serialized))
+	})
+
+	t.Run("Add rule with a named vmap lookup, check round-trip", func(t *testing.T) {
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON([]byte(serializedConfig)))
+
+		vmap := deserializedConfig.Nftables[1].Rule.Expr[0].Vmap
+		assert.NotNil(t, vmap)
+		assert.Equal(t, "@dispatch", *vmap.Data.String)
+		assert.Nil(t, vmap.Elements)
+
+		reserialized, err := deserializedConfig.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(reserialized))
+	})
+}
+
+func testAddRuleWithConcatVmap(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	client, server := "192.0.2.1", "198.51.100.0"
+	policy, err := nft.NewVerdictMap(table, "policy", "ipv4_addr . ipv4_addr",
+		schema.VmapElement{
+			Key:     nft.Concat(schema.Expression{String: &client}, schema.Expression{Prefix: &schema.Prefix{Addr: server, Len: 24}}),
+			Verdict: schema.Accept(),
+		},
+	)
+	assert.NoError(t, err)
+	policy.Flags = &schema.Flags{Flags: []string{schema.SetFlagInterval}}
+
+	config := nft.NewConfig()
+	config.AddMap(policy)
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{
+		nft.VmapLookup(nft.Concat(
+			schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPSAddr}},
+			schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPDAddr}},
+		), "policy"),
+	}, nil, nil, ""))
+
+	serializedConfig := fmt.Sprintf(`{"nftables":[`+
+		`{"map":{"family":"ip","table":%[1]q,"name":"policy","flags":"interval",`+
+		`"elem":[[{"concat":["192.0.2.1",{"prefix":{"addr":"198.51.100.0","len":24}}]},{"accept":null}]],`+
+		`"type":["ipv4_addr","ipv4_addr"],"map":"verdict"}},`+
+		`{"rule":{"family":"ip","table":%[1]q,"chain":%[2]q,"expr":[{"vmap":{"key":{"concat":[`+
+		`{"payload":{"protocol":"ip","field":"saddr"}},{"payload":{"protocol":"ip","field":"daddr"}}]},"data":"@policy"}}]}}]}`,
+		tableName, chainName,
+	)
+
+	t.Run("Add rule with a concatenated vmap lookup, check serialization", func(t *testing.T) {
+		serialized, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(serialized))
+	})
+
+	t.Run("Add rule with a concatenated vmap lookup, check round-trip", func(t *testing.T) {
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON([]byte(serializedConfig)))
+
+		assert.Equal(t, "ipv4_addr . ipv4_addr", deserializedConfig.Nftables[0].Map.Type)
+		key := deserializedConfig.Nftables[1].Rule.Expr[0].Vmap.Key
+		assert.Len(t, key.Concat, 2)
+		assert.Equal(t, schema.PayloadFieldIPDAddr, key.Concat[1].Payload.Field)
+
+		var element [2]schema.Expression
+		assert.NoError(t, json.Unmarshal(deserializedConfig.Nftables[0].Map.Elem[0].RowData, &element))
+		assert.Equal(t, client, *element[0].Concat[0].String)
+		assert.Equal(t, 24, element[0].Concat[1].Prefix.Len)
+
+		reserialized, err := deserializedConfig.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(reserialized))
+	})
+}
+
+func testAddRuleWithMetaMatch(t *testing.T) {
+	ifaceName, ifaceIndex, group := "eth0", float64(2), float64(1)
+	ifaceType, mark, nfproto, l4proto := "ether", float64(0x10), "ipv4", "tcp"
+	date, day, hourFrom, hourTo := "2021-06-01 12:00:00", schema.DayMonday, "17:00", "19:00"
+	length, protocol, pkttype := float64(1500), "ip6", schema.PktTypeBroadcast
+	bridgeName, pvid, vproto := "br0", float64(10), "8021q"
+	user, uid, groupName, gid := "nobody", float64(65534), "wheel", float64(10)
+	hours := schema.Range{Low: schema.Expression{String: &hourFrom}, High: schema.Expression{String: &hourTo}}
+	metaTests := []struct {
+		key             string
+		value           schema.Expression
+		serializedValue string
+	}{
+		{schema.MetaKeyMark, schema.Expression{Float64: &mark}, `16`},
+		{schema.MetaKeyNfproto, schema.Expression{String: &nfproto}, `"ipv4"`},
+		{schema.MetaKeyL4proto, schema.Expression{String: &l4proto}, `"tcp"`},
+		{schema.MetaKeyIif, schema.Expression{Float64: &ifaceIndex}, `2`},
+		{schema.MetaKeyIifname, schema.Expression{String: &ifaceName}, `"eth0"`},
+		{schema.MetaKeyIiftype, schema.Expression{String: &ifaceType}, `"ether"`},
+		{schema.MetaKeyIifgroup, schema.Expression{Float64: &group}, `1`},
+		{schema.MetaKeyOif, schema.Expression{Float64: &ifaceIndex}, `2`},
+		{schema.MetaKeyOifname, schema.Expression{String: &ifaceName}, `"eth0"`},
+		{schema.MetaKeyOiftype, schema.Expression{String: &ifaceType}, `"ether"`},
+		{schema.MetaKeyOifgroup, schema.Expression{Float64: &group}, `1`},
+		{schema.MetaKeyIbrname, schema.Expression{String: &bridgeName}, `"br0"`},
+		{schema.MetaKeyObrname, schema.Expression{String: &bridgeName}, `"br0"`},
+		{schema.MetaKeyIbrpvid, schema.Expression{Float64: &pvid}, `10`},
+		{schema.MetaKeyIbrvproto, schema.Expression{String: &vproto}, `"8021q"`},
+		{schema.MetaKeyIbriport, schema.Expression{String: &bridgeName}, `"br0"`},
+		{schema.MetaKeyObriport, schema.Expression{String: &bridgeName}, `"br0"`},
+		{schema.MetaKeyLength, schema.Expression{Float64: &length}, `1500`},
+		{schema.MetaKeyProtocol, schema.Expression{String: &protocol}, `"ip6"`},
+		{schema.MetaKeyPkttype, schema.Expression{String: &pkttype}, `"broadcast"`},
+		{schema.MetaKeyTime, schema.Expression{String: &date}, `"2021-06-01 12:00:00"`},
+		{schema.MetaKeyDay, schema.Expression{String: &day}, `"Monday"`},
+		{schema.MetaKeyHour, schema.Expression{String: &hourFrom}, `"17:00"`},
+		{schema.MetaKeyHour, schema.Expression{Range: &hours}, `{"range":["17:00","19:00"]}`},
+		{schema.MetaKeySkuid, schema.Expression{String: &user}, `"nobody"`},
+		{schema.MetaKeySkuid, schema.Expression{Float64: &uid}, `65534`},
+		{schema.MetaKeySkgid, schema.Expression{String: &groupName}, `"wheel"`},
+		{schema.MetaKeySkgid, schema.Expression{Float64: &gid}, `10`},
+	}
+	for _, tt := range metaTests {
+		createStatements := func() ([]schema.Statement, string) {
+			statement := schema.Statement{Match: &schema.Match{
+				Op:    schema.OperEQ,
+				Left:  schema.Expression{Meta: &schema.Meta{Key: tt.key}},
+				Right: tt.value,
+			}}
+			expectedMatch := fmt.Sprintf(`"match":{"op":"==","left":{"meta":{"key":%q}},"right":%s}`, tt.key, tt.serializedValue)
+			return []schema.Statement{statement}, fmt.Sprintf(`"expr":[{%s}]`, expectedMatch)
+		}
+		t.Run(fmt.Sprintf("Add rule with meta %s match, check serialization", tt.key), func(t *testing.T) {
+			testSerializationWith(t, createStatements)
+		})
+		t.Run(fmt.Sprintf("Add rule with meta %s match, check deserialization", tt.key), func(t *testing.T) {
+			testDeserializationWith(t, createStatements)
+		})
+	}
+
+	t.Run("Match the socket owner by name or ID", func(t *testing.T) {
+		uidMatch := nft.SkuidIs("65534")
+		assert.Equal(t, schema.Expression{Float64: &uid}, uidMatch.Match.Right)
+		assert.Equal(t, schema.MetaKeySkuid, uidMatch.Match.Left.Meta.Key)
+		assert.Equal(t, schema.Expression{String: &user}, nft.SkuidIs(user).Match.Right)
+
+		gidMatch := nft.SkgidIs("10")
+		assert.Equal(t, schema.Expression{Float64: &gid}, gidMatch.Match.Right)
+		assert.Equal(t, schema.MetaKeySkgid, gidMatch.Match.Left.Meta.Key)
+		assert.Equal(t, schema.Expression{String: &groupName}, nft.SkgidIs(groupName).Match.Right)
+	})
+}
+
+func testAddRulesWithLogThenDrop(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+
+	config := nft.NewConfig()
+	for _, statements := range nft.LogThenDrop("dropped: ", nft.Rate{Value: 10, Per: schema.LimitPerSecond, Burst: 5}) {
+		config.AddRule(nft.NewRule(table, chain, statements, nil, nil, ""))
+	}
+
+	ruleArgs := fmt.Sprintf(`"family":%q,"table":%q,"chain":%q`, nft.FamilyIP, tableName, chainName)
+	expectedConfig := fmt.Sprintf(`{"nftables":[{"rule":{%s,%s}},{"rule":{%s,%s}}]}`,
+		ruleArgs, `"expr":[{"limit":{"rate":10,"per":"second","burst":5}},{"log":{"prefix":"dropped: "}}]`,
+		ruleArgs, `"expr":[{"drop":null}]`,
+	)
+
+	t.Run("Add log then drop rules, check serialization", func(t *testing.T) {
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, expectedConfig, string(serializedConfig))
+	})
+
+	t.Run("Add log then drop rules, check deserialization", func(t *testing.T) {
+		var deserializedConfig nft.Config
+		assert.NoError(t, json.Unmarshal([]byte(expectedConfig), &deserializedConfig))
+		assert.Equal(t, config, &deserializedConfig)
+	})
+
+	t.Run("Add rule with a log statement with no arguments", func(t *testing.T) {
+		testSerializationWith(t, logStatements)
+		testDeserializationWith(t, logStatements)
+	})
+}
+
+func testAddRuleWithOsfMatch(t *testing.T) {
+	t.Run("Add rule with osf match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, osfStatements)
+	})
+	t.Run("Add rule with osf match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, osfStatements)
+	})
+}
+
+// osfStatements returns the statements of: osf ttl loose name "Linux" accept, osf version "Linux:4.19" drop
+func osfStatements() ([]schema.Statement, string) {
+	osName, osVersion := "Linux", "Linux:4.19"
+	matchName := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Osf: &schema.Osf{Key: schema.OsfKeyName, Ttl: schema.OsfTtlLoose}},
+		Right: schema.Expression{String: &osName},
+	}}
+	matchVersion := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Osf: &schema.Osf{Key: schema.OsfKeyVersion}},
+		Right: schema.Expression{String: &osVersion},
+	}}
+	statements := []schema.Statement{matchName, {Verdict: schema.Accept()}, matchVersion, {Verdict: schema.Drop()}}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"==","left":{"osf":{"key":"name","ttl":"loose"}},"right":"Linux"}},{"accept":null},` +
+		`{"match":{"op":"==","left":{"osf":{"key":"version"}},"right":"Linux:4.19"}},{"drop":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithRtMatch(t *testing.T) {
+	t.Run("Add rule with rt match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, rtStatements)
+	})
+	t.Run("Add rule with rt match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, rtStatements)
+	})
+}
+
+// rtStatements returns the statements of: rt mtu != 1500 rt ip nexthop 192.168.0.1 drop
+func rtStatements() ([]schema.Statement, string) {
+	mtu, nexthop := float64(1500), "192.168.0.1"
+	matchMtu := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperNEQ,
+		Left:  schema.Expression{Rt: &schema.Rt{Key: schema.RtKeyMtu}},
+		Right: schema.Expression{Float64: &mtu},
+	}}
+	matchNexthop := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Rt: &schema.Rt{Key: schema.RtKeyNexthop, Family: schema.FamilyIP}},
+		Right: schema.Expression{String: &nexthop},
+	}}
+	statements := []schema.Statement{matchMtu, matchNexthop, {Verdict: schema.Drop()}}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"!=","left":{"rt":{"key":"mtu"}},"right":1500}},` +
+		`{"match":{"op":"==","left":{"rt":{"key":"nexthop","family":"ip"}},"right":"192.168.0.1"}},{"drop":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithCgroupMatch(t *testing.T) {
+	t.Run("Add rule with cgroup match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, cgroupStatements)
+	})
+	t.Run("Add rule with cgroup match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, cgroupStatements)
+	})
+}
+
+// cgroupStatements returns the statements of: socket cgroupv2 level 1 "system.slice" accept, meta cgroup 1048577 drop
+func cgroupStatements() ([]schema.Statement, string) {
+	cgroupPath, cgroupID := "system.slice", float64(1048577)
+	matchCgroupv2 := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Socket: &schema.Socket{Key: schema.SocketKeyCgroupv2, Level: 1}},
+		Right: schema.Expression{String: &cgroupPath},
+	}}
+	matchCgroup := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyCgroup}},
+		Right: schema.Expression{Float64: &cgroupID},
+	}}
+	statements := []schema.Statement{matchCgroupv2, {Verdict: schema.Accept()}, matchCgroup, {Verdict: schema.Drop()}}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"==","left":{"socket":{"key":"cgroupv2","level":1}},"right":"system.slice"}},{"accept":null},` +
+		`{"match":{"op":"==","left":{"meta":{"key":"cgroup"}},"right":1048577}},{"drop":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithSampling(t *testing.T) {
+	t.Run("Add rule with sampling, check serialization", func(t *testing.T) {
+		testSerializationWith(t, samplingStatements)
+	})
+	t.Run("Add rule with sampling, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, samplingStatements)
+	})
+
+	for _, p := range []float64{0, 1, -0.5, 2} {
+		t.Run(fmt.Sprintf("Sample with an invalid probability %v", p), func(t *testing.T) {
+			_, err := nft.SampleProbability(p)
+			assert.Error(t, err)
+		})
+	}
+	t.Run("Sample with a probability below the resolution", func(t *testing.T) {
+		statement, err := nft.SampleProbability(0.000001)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(1), *statement.Match.Right.Float64)
+	})
+}
+
+// samplingStatements returns the statements of: numgen random mod 10000 < 100 log
+func samplingStatements() ([]schema.Statement, string) {
+	sample, _ := nft.SampleProbability(0.01)
+	statements := []schema.Statement{sample, {Log: &schema.Log{}}}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"\u003c","left":{"numgen":{"mode":"random","mod":10000}},"right":100}},{"log":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithIPAddresses(t *testing.T) {
+	t.Run("Add rule with IPv6 address matches, check serialization", func(t *testing.T) {
+		testSerializationWith(t, ipv6AddressStatements)
+	})
+	t.Run("Add rule with IPv6 address matches, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, ipv6AddressStatements)
+	})
+
+	normalizationTests := []struct {
+		address  string
+		expected schema.Expression
+	}{
+		{"2001:0db8:0000:0000:0000:0000:0000:0001", addressExpression("2001:db8::1")},
+		{"2001:DB8::1", addressExpression("2001:db8::1")},
+		{"::ffff:192.0.2.1", addressExpression("::ffff:192.0.2.1")},
+		{"192.0.2.1", addressExpression("192.0.2.1")},
+		{"192.0.2.1/24", schema.Expression{Prefix: &schema.Prefix{Addr: "192.0.2.0", Len: 24}}},
+		{"2001:0db8::0001/64", schema.Expression{Prefix: &schema.Prefix{Addr: "2001:db8::", Len: 64}}},
+	}
+	for _, tt := range normalizationTests {
+		t.Run(fmt.Sprintf("Normalize IP address %s", tt.address), func(t *testing.T) {
+			expression, err := nft.IPAddress(tt.address)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, expression)
+		})
+	}
+
+	for _, address := range []string{"fe80::1%eth0", "2001:db8::g", "192.0.2.1/33", ""} {
+		t.Run(fmt.Sprintf("Normalize invalid IP address %q", address), func(t *testing.T) {
+			_, err := nft.IPAddress(address)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func addressExpression(address string) schema.Expression {
+	return schema.Expression{String: &address}
+}
+
+// ipv6AddressStatements returns the statements of: ip6 saddr 2001:db8::/64 ip6 daddr 2001:db8::1 accept
+func ipv6AddressStatements() ([]schema.Statement, string) {
+	source, _ := nft.IPAddress("2001:0db8:0:0:1:2:3:4/64")
+	destination, _ := nft.IPAddress("2001:0db8:0000:0000:0000:0000:0000:0001")
+	matchSource := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP6, Field: schema.PayloadFieldIPSAddr}},
+		Right: source,
+	}}
+	matchDestination := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP6, Field: schema.PayloadFieldIPDAddr}},
+		Right: destination,
+	}}
+	statements := []schema.Statement{matchSource, matchDestination, {Verdict: schema.Accept()}}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip6","field":"saddr"}},"right":{"prefix":{"addr":"2001:db8::","len":64}}}},` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip6","field":"daddr"}},"right":"2001:db8::1"}},{"accept":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithMssClamping(t *testing.T) {
+	t.Run("Add rule with MSS clamping, check serialization", func(t *testing.T) {
+		testSerializationWith(t, mssClampingStatements)
+	})
+	t.Run("Add rule with MSS clamping, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, mssClampingStatements)
+	})
+}
+
+// mssClampingStatements returns the statements of: tcp flags syn tcp option maxseg size set rt mtu
+func mssClampingStatements() ([]schema.Statement, string) {
+	syn := "syn"
+	matchSyn := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperIN,
+		Left:  schema.Expression{Payload: &schema.Payload{Protocol: "tcp", Field: "flags"}},
+		Right: schema.Expression{String: &syn},
+	}}
+	clamp := schema.Statement{Mangle: &schema.Mangle{
+		Key: schema.Expression{TcpOption: &schema.TcpOption{
+			Name:  schema.TcpOptionMaxseg,
+			Field: schema.TcpOptionFieldSize,
+		}},
+		Value: schema.Expression{Rt: &schema.Rt{Key: schema.RtKeyMtu}},
+	}}
+	statements := []schema.Statement{matchSyn, clamp}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"in","left":{"payload":{"protocol":"tcp","field":"flags"}},"right":"syn"}},` +
+		`{"mangle":{"key":{"tcp option":{"name":"maxseg","field":"size"}},"value":{"rt":{"key":"mtu"}}}}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithDSCPAndECN(t *testing.T) {
+	t.Run("Add rule with DSCP and ECN, check serialization", func(t *testing.T) {
+		testSerializationWith(t, dscpStatements)
+	})
+	t.Run("Add rule with DSCP and ECN, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, dscpStatements)
+	})
+}
+
+// dscpStatements returns the statements of: ip dscp cs1 ip6 dscp 46 ip ecn ce ip dscp set af21
+func dscpStatements() ([]schema.Statement, string) {
+	cs1, ef, ce, af21 := schema.DSCPCS1, float64(46), schema.ECNCE, schema.DSCPAF21
+	payload := func(protocol, field string) schema.Expression {
+		return schema.Expression{Payload: &schema.Payload{Protocol: protocol, Field: field}}
+	}
+	statements := []schema.Statement{
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  payload(schema.PayloadProtocolIP4, schema.PayloadFieldIPDscp),
+			Right: schema.Expression{String: &cs1},
+		}},
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  payload(schema.PayloadProtocolIP6, schema.PayloadFieldIPDscp),
+			Right: schema.Expression{Float64: &ef},
+		}},
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  payload(schema.PayloadProtocolIP4, schema.PayloadFieldIPEcn),
+			Right: schema.Expression{String: &ce},
+		}},
+		{Mangle: &schema.Mangle{
+			Key:   payload(schema.PayloadProtocolIP4, schema.PayloadFieldIPDscp),
+			Value: schema.Expression{String: &af21},
+		}},
+	}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip","field":"dscp"}},"right":"cs1"}},` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip6","field":"dscp"}},"right":46}},` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip","field":"ecn"}},"right":"ce"}},` +
+		`{"mangle":{"key":{"payload":{"protocol":"ip","field":"dscp"}},"value":"af21"}}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithARPMatch(t *testing.T) {
+	t.Run("Add rule with ARP match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, arpStatements)
+	})
+	t.Run("Add rule with ARP match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, arpStatements)
+	})
+}
+
+// arpStatements returns the statements of: arp operation reply arp saddr ip != 192.168.0.1 drop
+func arpStatements() ([]schema.Statement, string) {
+	operation, address := schema.ARPOperationReply, "192.168.0.1"
+	statements := []schema.Statement{
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolARP, Field: schema.PayloadFieldARPOperation}},
+			Right: schema.Expression{String: &operation},
+		}},
+		{Match: &schema.Match{
+			Op:    schema.OperNEQ,
+			Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolARP, Field: schema.PayloadFieldARPSAddrIP}},
+			Right: schema.Expression{String: &address},
+		}},
+		{Verdict: schema.Drop()},
+	}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"arp","field":"operation"}},"right":"reply"}},` +
+		`{"match":{"op":"!=","left":{"payload":{"protocol":"arp","field":"saddr ip"}},"right":"192.168.0.1"}},` +
+		`{"drop":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithVlanMatch(t *testing.T) {
+	t.Run("Add rule with VLAN match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, vlanStatements)
+	})
+	t.Run("Add rule with VLAN match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, vlanStatements)
+	})
+}
+
+// vlanStatements returns the statements of: vlan id 100 vlan pcp 5 accept
+func vlanStatements() ([]schema.Statement, string) {
+	id, pcp := float64(100), float64(5)
+	statements := []schema.Statement{
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolVlan, Field: schema.PayloadFieldVlanID}},
+			Right: schema.Expression{Float64: &id},
+		}},
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolVlan, Field: schema.PayloadFieldVlanPcp}},
+			Right: schema.Expression{Float64: &pcp},
+		}},
+		{Verdict: schema.Accept()},
+	}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"vlan","field":"id"}},"right":100}},` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"vlan","field":"pcp"}},"right":5}},` +
+		`{"accept":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithCtMatch(t *testing.T) {
+	withoutError := func(statement schema.Statement, err error) schema.Statement {
+		assert.NoError(t, err)
+		return statement
+	}
+	ctTests := []struct {
+		name                string
+		statement           schema.Statement
+		serializedStatement string
+	}{
+		{
+			"ct state new,established",
+			withoutError(nft.CtStateIn(schema.CtStateNew, schema.CtStateEstablished)),
+			`{"match":{"op":"in","left":{"ct":{"key":"state"}},"right":["new","established"]}}`,
+		},
+		{
+			"ct status dnat",
+			withoutError(nft.CtStatusAny(schema.CtStatusDnat)),
+			`{"match":{"op":"in","left":{"ct":{"key":"status"}},"right":"dnat"}}`,
+		},
+		{
+			"ct status & dnat == dnat",
+			withoutError(nft.CtStatusAll(schema.CtStatusDnat)),
+			`{"match":{"op":"==","left":{"\u0026":[{"ct":{"key":"status"}},"dnat"]},"right":"dnat"}}`,
+		},
+		{
+			"ct status & (snat|assured) == snat|assured",
+			withoutError(nft.CtStatusAll(schema.CtStatusSnat, schema.CtStatusAssured)),
+			`{"match":{"op":"==","left":{"\u0026":[{"ct":{"key":"status"}},{"|":["snat","assured"]}]},"right":{"|":["snat","assured"]}}}`,
+		},
+		{
+			"ct mark set meta mark",
+			nft.CtMarkSave(),
+			`{"mangle":{"key":{"ct":{"key":"mark"}},"value":{"meta":{"key":"mark"}}}}`,
+		},
+		{
+			"meta mark set ct mark",
+			nft.CtMarkRestore(),
+			`{"mangle":{"key":{"meta":{"key":"mark"}},"value":{"ct":{"key":"mark"}}}}`,
+		},
+	}
+	// The encoding/json HTML escaping encodes the `&` operator as `\u0026`, which is equivalent in JSON.
+	for _, tt := range ctTests {
+		tt := tt
+		createStatements := func() ([]schema.Statement, string) {
+			return []schema.Statement{tt.statement}, fmt.Sprintf(`"expr":[%s]`, tt.serializedStatement)
+		}
+		t.Run(fmt.Sprintf("Add rule with %s match, check serialization", tt.name), func(t *testing.T) {
+			testSerializationWith(t, createStatements)
+		})
+		t.Run(fmt.Sprintf("Add rule with %s match, check deserialization", tt.name), func(t *testing.T) {
+			testDeserializationWith(t, createStatements)
+		})
+	}
+
+	t.Run("Ct matches without flags are rejected", func(t *testing.T) {
+		_, err := nft.CtStateIn()
+		assert.Error(t, err)
+		_, err = nft.CtStatusAny()
+		assert.Error(t, err)
+		_, err = nft.CtStatusAll()
+		assert.Error(t, err)
+	})
+}
+
+func testAddRuleWithFragmentDrop(t *testing.T) {
+	t.Run("Add rule which drops fragments, check serialization", func(t *testing.T) {
+		testSerializationWith(t, fragmentDropStatements)
+	})
+	t.Run("Add rule which drops fragments, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, fragmentDropStatements)
+	})
+}
+
+// fragmentDropStatements returns the statements of: ip frag-off & 0x3fff != 0 drop
+func fragmentDropStatements() ([]schema.Statement, string) {
+	statements := []schema.Statement{nft.IPIsFragment(), {Verdict: schema.Drop()}}
+
+	serializedStatements := `"expr":[` +
+		`{"match":{"op":"!=","left":{"\u0026":[{"payload":{"protocol":"ip","field":"frag-off"}},16383]},"right":0}},` +
+		`{"drop":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithReject(t *testing.T) {
+	t.Run("Add rule with reject, check serialization", func(t *testing.T) {
+		testSerializationWith(t, rejectStatements)
+	})
+	t.Run("Add rule with reject, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, rejectStatements)
+	})
+
+	defaultTests := []struct {
+		family       nft.AddressFamily
+		expectedType string
+	}{
+		{nft.FamilyIP, schema.RejectTypeICMP},
+		{nft.FamilyIP6, schema.RejectTypeICMPv6},
+		{nft.FamilyINET, schema.RejectTypeICMPx},
+		{nft.FamilyBridge, schema.RejectTypeICMPx},
+		{nft.FamilyNETDEV, schema.RejectTypeICMPx},
+	}
+	for _, tt := range defaultTests {
+		t.Run(fmt.Sprintf("Reject with the default type of the %s family", tt.family), func(t *testing.T) {
+			statement, err := nft.Reject(tt.family, schema.Reject{Expr: "admin-prohibited"})
+			assert.NoError(t, err)
+			assert.Equal(t, &schema.Reject{Type: tt.expectedType, Expr: "admin-prohibited"}, statement.Reject)
+		})
+	}
+
+	t.Run("Reject with an explicit type", func(t *testing.T) {
+		statement, err := nft.Reject(nft.FamilyINET, schema.Reject{Type: schema.RejectTypeTCPReset})
+		assert.NoError(t, err)
+		assert.Equal(t, &schema.Reject{Type: schema.RejectTypeTCPReset}, statement.Reject)
+	})
+
+	invalidTests := []struct {
+		family     nft.AddressFamily
+		rejectType string
+	}{
+		{nft.FamilyIP, schema.RejectTypeICMPv6},
+		{nft.FamilyIP, schema.RejectTypeICMPx},
+		{nft.FamilyIP6, schema.RejectTypeICMP},
+		{nft.FamilyARP, ""},
+	}
+	for _, tt := range invalidTests {
+		t.Run(fmt.Sprintf("Reject with type %q in the %s family", tt.rejectType, tt.family), func(t *testing.T) {
+			_, err := nft.Reject(tt.family, schema.Reject{Type: tt.rejectType})
+			assert.Error(t, err)
+		})
+	}
+}
+
+// rejectStatements returns the statements of: reject, reject with icmpx admin-prohibited
+func rejectStatements() ([]schema.Statement, string) {
+	statements := []schema.Statement{
+		{Reject: &schema.Reject{}},
+		{Reject: &schema.Reject{Type: schema.RejectTypeICMPx, Expr: "admin-prohibited"}},
+	}
+
+	serializedStatements := `"expr":[{"reject":null},{"reject":{"type":"icmpx","expr":"admin-prohibited"}}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithLast(t *testing.T) {
+	t.Run("Add rule with last, check serialization", func(t *testing.T) {
+		testSerializationWith(t, lastStatements)
+	})
+	t.Run("Add rule with last, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, lastStatements)
+	})
+
+	t.Run("Read rules with the last used time", func(t *testing.T) {
+		ruleArgs := fmt.Sprintf(`"family":%q,"table":%q,"chain":%q`, nft.FamilyIP, tableName, chainName)
+		serializedConfig := fmt.Sprintf(`{"nftables":[{"rule":{%s,%s}},{"rule":{%s,%s}}]}`,
+			ruleArgs, `"expr":[{"last":{"used":1500}},{"accept":null}]`,
+			ruleArgs, `"expr":[{"last":null},{"drop":null}]`,
+		)
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		used, matched := config.Nftables[0].Rule.Expr[0].Last.UsedDuration()
+		assert.True(t, matched)
+		assert.Equal(t, 1500*time.Millisecond, used)
+
+		_, matched = config.Nftables[1].Rule.Expr[0].Last.UsedDuration()
+		assert.False(t, matched)
+	})
+}
+
+// lastStatements returns the statements of: last accept
+func lastStatements() ([]schema.Statement, string) {
+	statements := []schema.Statement{{Last: &schema.Last{}}, {Verdict: schema.Accept()}}
+	return statements, `"expr":[{"last":null},{"accept":null}]`
+}
+
+func testAddRuleWithConnLimit(t *testing.T) {
+	t.Run("Add rule with a connection limit, check serialization", func(t *testing.T) {
+		testSerializationWith(t, connLimitStatements)
+	})
+	t.Run("Add rule with a connection limit, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, connLimitStatements)
+	})
+}
+
+// connLimitStatements returns the statements of: add @connlimit { ip saddr ct count over 10 } reject
+func connLimitStatements() ([]schema.Statement, string) {
+	source := schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPSAddr}}
+	statements := []schema.Statement{nft.ConnLimitOver("connlimit", source, 10), {Reject: &schema.Reject{}}}
+
+	serializedStatements := `"expr":[{"set":{"op":"add","elem":{"payload":{"protocol":"ip","field":"saddr"}},` +
+		`"set":"@connlimit","stmt":[{"ct count":{"val":10,"inv":true}}]}},{"reject":null}]`
+	return statements, serializedStatements
+}
+
+func testAddRuleWithMapLookup(t *testing.T) {
+	t.Run("Add rule with a classification map, check serialization", func(t *testing.T) {
+		testSerializationWith(t, classificationStatements)
+	})
+	t.Run("Add rule with a classification map, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, classificationStatements)
+	})
+}
+
+// classificationStatements returns the statements of: meta priority set ip dscp map { cs1 : 1:10, ef : 1:1 }
+func classificationStatements() ([]schema.Statement, string) {
+	cs1, ef, bulk, voice := schema.DSCPCS1, "ef", "1:10", "1:1"
+	classes, _ := schema.AnonymousMap(
+		[2]schema.Expression{{String: &cs1}, {String: &bulk}},
+		[2]schema.Expression{{String: &ef}, {String: &voice}},
+	)
+	statements := []schema.Statement{{Mangle: &schema.Mangle{
+		Key: schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyPriority}},
+		Value: schema.Expression{Map: &schema.MapLookup{
+			Key:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPDscp}},
+			Data: classes,
+		}},
+	}}}
+
+	serializedStatements := `"expr":[{"mangle":{"key":{"meta":{"key":"priority"}},"value":{"map":{` +
+		`"key":{"payload":{"protocol":"ip","field":"dscp"}},"data":{"set":[["cs1","1:10"],["ef","1:1"]]}}}}}]`
+	return statements, serializedStatements
+}
+
+func testFromIptablesRule(t *testing.T) {
+	tests := []struct {
+		spec         string
+		expectedRule string
+	}{
+		{
+			spec: `-A INPUT -p tcp --dport 22 -j ACCEPT`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"match":{"op":"==","left":{"payload":{"protocol":"tcp","field":"dport"}},"right":22}},{"accept":null}]}`,
+		},
+		{
+			spec: `-t filter -A FORWARD -i eth+ ! -o eth0 -s 192.0.2.0/24 -p udp -m multiport --dports 53,1000:2000 -j DROP`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"forward","expr":[` +
+				`{"match":{"op":"==","left":{"meta":{"key":"iifname"}},"right":"eth*"}},` +
+				`{"match":{"op":"!=","left":{"meta":{"key":"oifname"}},"right":"eth0"}},` +
+				`{"match":{"op":"==","left":{"payload":{"protocol":"ip","field":"saddr"}},"right":{"prefix":{"addr":"192.0.2.0","len":24}}}},` +
+				`{"match":{"op":"==","left":{"payload":{"protocol":"udp","field":"dport"}},"right":{"set":[53,{"range":[1000,2000]}]}}},` +
+				`{"drop":null}]}`,
+		},
+		{
+			spec: `-A INPUT -d 2001:db8::1 -p icmpv6 -m comment --comment "allow ping" -j ACCEPT`,
+			expectedRule: `{"family":"ip6","table":"filter","chain":"input","expr":[` +
+				`{"match":{"op":"==","left":{"payload":{"protocol":"ip6","field":"daddr"}},"right":"2001:db8::1"}},` +
+				`{"match":{"op":"==","left":{"meta":{"key":"l4proto"}},"right":"icmpv6"}},{"accept":null}],"comment":"allow ping"}`,
+		},
+		{
+			spec: `-A INPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"match":{"op":"in","left":{"ct":{"key":"state"}},"right":["established","related"]}},{"accept":null}]}`,
+		},
+		{
+			spec: `-A INPUT -p tcp --dport 23 -j REJECT --reject-with tcp-reset`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"match":{"op":"==","left":{"payload":{"protocol":"tcp","field":"dport"}},"right":23}},{"reject":{"type":"tcp reset"}}]}`,
+		},
+		{
+			spec: `-A INPUT -j LOG --log-prefix 'dropped: ' --log-level 4`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"log":{"prefix":"dropped: ","level":"warn"}}]}`,
+		},
+		{
+			spec: `-A INPUT -j LOG --log-level warning`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"log":{"level":"warn"}}]}`,
+		},
+		{
+			spec: `-A INPUT -j LOG --log-level error`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"log":{"level":"err"}}]}`,
+		},
+		{
+			spec: `-A INPUT -j LOG --log-level panic`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"log":{"level":"emerg"}}]}`,
+		},
+		{
+			spec: `-t nat -A POSTROUTING -o eth0 -j MASQUERADE`,
+			expectedRule: `{"family":"ip","table":"nat","chain":"postrouting","expr":[` +
+				`{"match":{"op":"==","left":{"meta":{"key":"oifname"}},"right":"eth0"}},{"masquerade":null}]}`,
+		},
+		{
+			spec: `-A INPUT -p tcp ! --sport 1024: -g DOCKER`,
+			expectedRule: `{"family":"ip","table":"filter","chain":"input","expr":[` +
+				`{"match":{"op":"!=","left":{"payload":{"protocol":"tcp","field":"sport"}},"right":{"range":[1024,65535]}}},` +
+				`{"goto":{"target":"DOCKER"}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Translate iptables rule %s", tt.spec), func(t *testing.T) {
+			rule, err := nft.FromIptablesRule(tt.spec)
+			assert.NoError(t, err)
+			serializedRule, err := json.Marshal(rule)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedRule, string(serializedRule))
+		})
+	}
+
+	for _, spec := range []string{
+		`-p tcp --dport 22 -j ACCEPT`,
+		`-A INPUT --dport 22 -j ACCEPT`,
+		`-A INPUT -m recent --rcheck -j DROP`,
+		`-A INPUT -j DNAT --to-destination 192.0.2.1`,
+		`-A INPUT -s 192.0.2.1 -d 2001:db8::1 -j DROP`,
+		`-A INPUT -j ACCEPT --reject-with tcp-reset`,
+		`-A INPUT -m comment --comment "unterminated`,
+		`-A INPUT -p`,
+		`-A INPUT -j LOG --log-level verbose`,
+		`-A INPUT -j LOG --log-level 8`,
+	} {
+		t.Run(fmt.Sprintf("Translate unsupported iptables rule %s", spec), func(t *testing.T) {
+			_, err := nft.FromIptablesRule(spec)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func testAddRuleWithLoadBalancing(t *testing.T) {
+	t.Run("Add rule with load balancing, check serialization", func(t *testing.T) {
+		testSerializationWith(t, loadBalancingStatements)
+	})
+	t.Run("Add rule with load balancing, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, loadBalancingStatements)
+	})
+
+	source := schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPSAddr}}
+	backends := []schema.Verdict{{Jump: &schema.ToTarget{Target: "b0"}}, {Jump: &schema.ToTarget{Target: "b1"}}}
+
+	t.Run("Load balance with a jhash key", func(t *testing.T) {
+		statement, err := nft.LoadBalanceTo(schema.Expression{Jhash: &schema.Jhash{Mod: 2, Offset: 10, Expr: source, Seed: 0xcafe}}, backends)
+		assert.NoError(t, err)
+
+		serializedStatement, err := json.Marshal(statement)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"vmap":{"key":{"jhash":{"mod":2,"offset":10,"expr":{"payload":{"protocol":"ip","field":"saddr"}},"seed":51966}},`+
+			`"data":{"set":[[10,{"jump":{"target":"b0"}}],[11,{"jump":{"target":"b1"}}]]}}}`,
+			string(serializedStatement))
+	})
+
+	t.Run("Load balance with a jhash key of another modulus", func(t *testing.T) {
+		_, err := nft.LoadBalanceTo(schema.Expression{Jhash: &schema.Jhash{Mod: 3, Expr: source}}, backends)
+		assert.Error(t, err)
+	})
+
+	t.Run("Load balance to no backends", func(t *testing.T) {
+		_, err := nft.LoadBalanceTo(source, nil)
+		assert.Error(t, err)
+	})
+}
+
+// loadBalancingStatements returns the statements of: jhash ip saddr mod 2 vmap { 0 : jump b0, 1 : jump b1 }
+func loadBalancingStatements() ([]schema.Statement, string) {
+	source := schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIPSAddr}}
+	statement, _ := nft.LoadBalanceTo(source, []schema.Verdict{
+		{Jump: &schema.ToTarget{Target: "b0"}},
+		{Jump: &schema.ToTarget{Target: "b1"}},
+	})
+
+	serializedStatements := `"expr":[{"vmap":{"key":{"jhash":{"mod":2,"expr":{"payload":{"protocol":"ip","field":"saddr"}}}},` +
+		`"data":{"set":[[0,{"jump":{"target":"b0"}}],[1,{"jump":{"target":"b1"}}]]}}}]`
+	return []schema.Statement{statement}, serializedStatements
+}
+
+func testAddRuleWithPortMatch(t *testing.T) {
+	t.Run("Add rule with a port range match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, portRangeStatements)
+	})
+	t.Run("Add rule with a port range match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, portRangeStatements)
+	})
+	t.Run("Add rule with a port set match, check serialization", func(t *testing.T) {
+		testSerializationWith(t, portSetStatements)
+	})
+	t.Run("Add rule with a port set match, check deserialization", func(t *testing.T) {
+		testDeserializationWith(t, portSetStatements)
+	})
+
+	t.Run("Port ranges in reverse order are rejected", func(t *testing.T) {
+		_, err := nft.DportRange(schema.PayloadProtocolTCP, 2000, 1000)
+		assert.Error(t, err)
+	})
+}
+
+func portRangeStatements() ([]schema.Statement, string) {
+	dports, _ := nft.DportRange(schema.PayloadProtocolTCP, 1024, 65535)
+	return []schema.Statement{dports, nft.SportIs(schema.PayloadProtocolTCP, 443), {Verdict: schema.Accept()}},
+		`"expr":[` +
+			`{"match":{"op":"==","left":{"payload":{"protocol":"tcp","field":"dport"}},"right":{"range":[1024,65535]}}},` +
+			`{"match":{"op":"==","left":{"payload":{"protocol":"tcp","field":"sport"}},"right":443}},` +
+			`{"accept":null}]`
+}
+
+func portSetStatements() ([]schema.Statement, string) {
+	return []schema.Statement{nft.DportIn(schema.PayloadProtocolUDP, 53, 123), {Verdict: schema.Accept()}},
+		`"expr":[` +
+			`{"match":{"op":"in","left":{"payload":{"protocol":"udp","field":"dport"}},"right":{"set":[53,123]}}},` +
+			`{"accept":null}]`
+}
+
+func testAddRuleWithLogAndVerdict(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyIP)
+	chain := nft.NewRegularChain(table, chainName)
+	newRule := func() *schema.Rule {
+		return nft.NewRule(table, chain, []schema.Statement{nft.L4ProtoIs("tcp")}, nil, nil, "")
+	}
+
+	t.Run("Append log and drop statements to a rule", func(t *testing.T) {
+		logAndDrop, err := nft.LogAndVerdict(schema.Log{Prefix: "dropped: "}, schema.Statement{Verdict: schema.Drop()})
+		assert.NoError(t, err)
+		rule := newRule()
+		assert.NoError(t, nft.AppendStatements(rule, logAndDrop...))
+
+		serialized, err := json.Marshal(rule.Expr)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			`[{"match":{"op":"==","left":{"meta":{"key":"l4proto"}},"right":"tcp"}},{"log":{"prefix":"dropped: "}},{"drop":null}]`,
+			string(serialized),
+		)
+	})
+
+	t.Run("Log and reject", func(t *testing.T) {
+		reject, err := nft.Reject(nft.FamilyIP, schema.Reject{})
+		assert.NoError(t, err)
+		statements, err := nft.LogAndVerdict(schema.Log{}, reject)
+		assert.NoError(t, err)
+		assert.Len(t, statements, 2)
+		assert.NotNil(t, statements[0].Log)
+		assert.NotNil(t, statements[1].Reject)
+	})
+
+	t.Run("Log and a terminal nat or queue statement", func(t *testing.T) {
+		ip := "192.0.2.1"
+		addr := schema.Expression{String: &ip}
+		for _, statement := range []schema.Statement{
+			{Nat: schema.Nat{Masquerade: &schema.Masquerade{Enabled: true}}},
+			{Nat: schema.Nat{Snat: &schema.Snat{Addr: &addr}}},
+			{Nat: schema.Nat{Dnat: &schema.Dnat{Addr: &addr}}},
+			{Nat: schema.Nat{Redirect: &schema.Redirect{Enabled: true}}},
+			{RowData: json.RawMessage(`{"queue":{"num":1}}`)},
+		} {
+			statements, err := nft.LogAndVerdict(schema.Log{}, statement)
+			assert.NoError(t, err)
+			assert.Len(t, statements, 2)
+		}
+
+		rule := newRule()
+		assert.NoError(t, nft.AppendStatements(rule, schema.Statement{Nat: schema.Nat{Masquerade: &schema.Masquerade{Enabled: true}}}))
+		assert.Error(t, nft.AppendStatements(rule, schema.Statement{Counter: &schema.Counter{}}))
+	})
+
+	t.Run("Log and a non terminal verdict is rejected", func(t *testing.T) {
+		_, err := nft.LogAndVerdict(schema.Log{}, schema.Statement{Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: "other"}}})
+		assert.Error(t, err)
+		_, err = nft.LogAndVerdict(schema.Log{}, schema.Statement{Counter: &schema.Counter{}})
+		assert.Error(t, err)
+		_, err = nft.LogAndVerdict(schema.Log{}, schema.Statement{RowData: json.RawMessage(`{"notrack":null}`)})
+		assert.Error(t, err)
+	})
+
+	t.Run("Statements after a terminal verdict are rejected", func(t *testing.T) {
+		rule := newRule()
+		err := nft.AppendStatements(rule, schema.Statement{Verdict: schema.Accept()}, schema.Statement{Counter: &schema.Counter{}})
+		assert.Error(t, err)
+		assert.Len(t, rule.Expr, 1, "the rule is expected to be left unchanged")
+
+		assert.NoError(t, nft.AppendStatements(rule, schema.Statement{Verdict: schema.Accept()}))
+		assert.Error(t, nft.AppendStatements(rule, schema.Statement{Counter: &schema.Counter{}}))
+		assert.Len(t, rule.Expr, 2)
+	})
+}
+
+func testAddRuleWithEtherMangle(t *testing.T) {
+	table := nft.NewTable(tableName, nft.FamilyBridge)
+	chain := nft.NewRegularChain(table, chainName)
+	saddrSet, err := nft.EtherSAddrSet("02-00-5E-10-00-01")
+	assert.NoError(t, err)
+	daddrSet, err := nft.EtherDAddrSet("0200.5e10.0002")
+	assert.NoError(t, err)
+
+	config := nft.NewConfig()
+	config.AddRule(nft.NewRule(table, chain, []schema.Statement{saddrSet, daddrSet}, nil, nil, ""))
+
+	serializedConfig := fmt.Sprintf(`{"nftables":[{"rule":{"family":"bridge","table":%q,"chain":%q,"expr":[`+
+		`{"mangle":{"key":{"payload":{"protocol":"ether","field":"saddr"}},"value":"02:00:5e:10:00:01"}},`+
+		`{"mangle":{"key":{"payload":{"protocol":"ether","field":"daddr"}},"value":"02:00:5e:10:00:02"}}]}}]}`,
+		tableName, chainName,
+	)
+
+	t.Run("Add rule with ether address mangling, check serialization", func(t *testing.T) {
+		serialized, err := config.ToJSON()
+		assert.NoError(t, err)
+		assert.Equal(t, serializedConfig, string(serialized))
+	})
+
+	t.Run("Add rule with ether address mangling, check round-trip", func(t *testing.T) {
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON([]byte(serializedConfig)))
+		assert.Equal(t, config, deserializedConfig)
+	})
+
+	t.Run("Invalid MAC addresses are rejected", func(t *testing.T) {
+		for _, address := range []string{"02:00:5e:10:00", "02:00:5e:10:00:00:00:01", "not-a-mac"} {
+			_, err := nft.EtherSAddrSet(address)
+			assert.Error(t, err, address)
+		}
+	})
+}
+
+func logStatements() ([]schema.Statement, string) {
+	return []schema.Statement{{Log: &schema.Log{}}}, `"expr":[{"log":null}]`
+}
+
 func testSerializationWith(t *testing.T, createStatements func() ([]schema.Statement, string)) {
 	const comment = "mycomment"
 
@@ -522,3 +1751,23 @@ func redirectStatements() ([]schema.Statement, string) {
 
 	return statements, serializedStatements
 }
+
+func vmapStatements() ([]schema.Statement, string) {
+	port22, port80, port443 := float64(22), float64(80), float64(443)
+	statement := schema.Statement{
+		Vmap: &schema.Vmap{
+			Key: schema.Expression{Payload: &schema.Payload{Protocol: "tcp", Field: "dport"}},
+			Elements: []schema.VmapElement{
+				{Key: schema.Expression{Float64: &port22}, Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: "ssh"}}},
+				{Key: schema.Expression{Float64: &port80}, Verdict: schema.Accept()},
+				{Key: schema.Expression{Float64: &port443}, Verdict: schema.Drop()},
+			},
+		},
+	}
+
+	expectedVmap := `"vmap":{"key":{"payload":{"protocol":"tcp","field":"dport"}},` +
+		`"data":{"set":[[22,{"jump":{"target":"ssh"}}],[80,{"accept":null}],[443,{"drop":null}]]}}`
+	serializedStatements := fmt.Sprintf(`"expr":[{%s}]`, expectedVmap)
+
+	return []schema.Statement{statement}, serializedStatements
+}
@@ -0,0 +1,244 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// AddSet appends the given set to the nftable config.
+// The set is added without an explicit action (`add`).
+// Adding multiple times the same set has no effect when the config is applied,
+// the elements of the set are added to the existing set.
+func (c *Config) AddSet(set *schema.Set) {
+	nftable := schema.Nftable{Set: set}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// CreateSet appends the given set to the nftable config
+// with the `create` action.
+// Unlike adding it, attempting to create an existing set results with a failure when the config is applied.
+func (c *Config) CreateSet(set *schema.Set) {
+	nftable := schema.Nftable{Create: &schema.Objects{Set: set}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteSet appends a given set to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced set, results with a failure when the config is applied.
+func (c *Config) DeleteSet(set *schema.Set) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Set: set}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// FlushSet appends a given set to the nftable config
+// with the `flush` action.
+// All the elements of the set are removed (when applied), the set itself is kept.
+// Flushing an empty set has no effect, attempting to flush a non-existing set results with a failure.
+func (c *Config) FlushSet(set *schema.Set) {
+	nftable := schema.Nftable{Flush: &schema.Objects{Set: set}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddMap appends the given map to the nftable config.
+// The map is added without an explicit action (`add`).
+func (c *Config) AddMap(m *schema.Map) {
+	nftable := schema.Nftable{Map: m}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// CreateMap appends the given map to the nftable config
+// with the `create` action.
+// Unlike adding it, attempting to create an existing map results with a failure when the config is applied.
+func (c *Config) CreateMap(m *schema.Map) {
+	nftable := schema.Nftable{Create: &schema.Objects{Map: m}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteMap appends a given map to the nftable config
+// with the `delete` action.
+// Attempting to delete a non-existing or referenced map, results with a failure when the config is applied.
+func (c *Config) DeleteMap(m *schema.Map) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Map: m}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// FlushMap appends a given map to the nftable config
+// with the `flush` action.
+// All the elements of the map are removed (when applied), the map itself is kept.
+// Flushing an empty map has no effect, attempting to flush a non-existing map results with a failure.
+func (c *Config) FlushMap(m *schema.Map) {
+	nftable := schema.Nftable{Flush: &schema.Objects{Map: m}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// AddElements appends the given elements of a set or map to the nftable config.
+// The elements are added without an explicit action (`add`).
+// Attempting to add elements to a non-existing set or map, results with a failure when the config is applied.
+func (c *Config) AddElements(element *schema.Element) {
+	nftable := schema.Nftable{Element: element}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// DeleteElements appends the given elements of a set or map to the nftable config
+// with the `delete` action.
+// Attempting to delete non-existing elements, results with a failure when the config is applied.
+func (c *Config) DeleteElements(element *schema.Element) {
+	nftable := schema.Nftable{Delete: &schema.Objects{Element: element}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
+// PromoteAnonymousSet extracts the first anonymous set matched by the rule into a named set, with the given name,
+// and rewrites the rule match to reference the named set (`@name`).
+// The named set type is derived from the matched expression (e.g. `ipv4_addr` for `ip saddr`),
+// with the interval flag if the elements include prefixes or ranges.
+// The named set is inserted to the config before the rule, and returned.
+// The rule is expected to be in the config, e.g. as returned by LookupRule().
+// An error is returned if the rule is not in the config, has no anonymous set or if the set type cannot be derived.
+func (c *Config) PromoteAnonymousSet(rule *schema.Rule, name string) (*schema.Set, error) {
+	index := c.ruleIndex(rule)
+	if index < 0 {
+		return nil, fmt.Errorf("rule not found in the config")
+	}
+
+	for _, statement := range rule.Expr {
+		if statement.Match == nil {
+			continue
+		}
+		elements, isAnonymousSet := anonymousSetElements(statement.Match.Right)
+		if !isAnonymousSet {
+			continue
+		}
+
+		setType := anonymousSetType(statement.Match.Left)
+		if setType == "" {
+			return nil, fmt.Errorf("failed to derive the type of the anonymous set to promote to %q", name)
+		}
+		set := &schema.Set{Family: rule.Family, Table: rule.Table, Name: name, Type: setType, Elem: elements}
+		for _, element := range elements {
+			if element.Prefix != nil || element.Range != nil {
+				set.Flags = &schema.Flags{Flags: []string{schema.SetFlagInterval}}
+				break
+			}
+		}
+
+		reference := "@" + name
+		statement.Match.Right = schema.Expression{String: &reference}
+
+		c.Nftables = append(c.Nftables, schema.Nftable{})
+		copy(c.Nftables[index+1:], c.Nftables[index:])
+		c.Nftables[index] = schema.Nftable{Set: set}
+		return set, nil
+	}
+	return nil, fmt.Errorf("no anonymous set found in the rule")
+}
+
+// InlineSet rewrites the rule match referencing the named set (`@name`) to match an anonymous set of its elements,
+// the reverse of PromoteAnonymousSet.
+// The named set is looked up in the config, by the rule family and table, and is kept.
+// An error is returned if the rule does not reference the set or if the set is not in the config.
+func (c *Config) InlineSet(rule *schema.Rule, name string) error {
+	var set *schema.Set
+	for _, nftable := range c.Nftables {
+		if s := nftable.Set; s != nil && s.Family == rule.Family && s.Table == rule.Table && s.Name == name {
+			set = s
+		}
+	}
+	if set == nil {
+		return fmt.Errorf("set %q not found in the config", name)
+	}
+	if len(set.Elem) == 0 {
+		return fmt.Errorf("set %q has no elements to inline", name)
+	}
+
+	for _, statement := range rule.Expr {
+		if statement.Match == nil || statement.Match.Right.String == nil || *statement.Match.Right.String != "@"+name {
+			continue
+		}
+		statement.Match.Right = schema.Expression{Set: append([]schema.Expression(nil), set.Elem...)}
+		return nil
+	}
+	return fmt.Errorf("set %q is not referenced by the rule", name)
+}
+
+// ruleIndex returns the index of the config entry holding the given rule, or -1 if not found.
+func (c *Config) ruleIndex(rule *schema.Rule) int {
+	for i, nftable := range c.Nftables {
+		if nftable.Rule == rule {
+			return i
+		}
+	}
+	return -1
+}
+
+// anonymousSetElements returns the elements of an anonymous set expression,
+// either as decoded from nft (`{"set":[...]}`) or as an array of row data.
+func anonymousSetElements(expression schema.Expression) ([]schema.Expression, bool) {
+	if expression.Set != nil {
+		return append([]schema.Expression(nil), expression.Set...), true
+	}
+	if len(expression.RowData) == 0 || expression.RowData[0] != '[' {
+		return nil, false
+	}
+	var elements []schema.Expression
+	if err := json.Unmarshal(expression.RowData, &elements); err != nil {
+		return nil, false
+	}
+	return elements, true
+}
+
+// anonymousSetType returns the set type of the elements matched against the expression,
+// or an empty string if it is not known.
+func anonymousSetType(expression schema.Expression) string {
+	switch {
+	case expression.Payload != nil:
+		p := expression.Payload
+		switch {
+		case p.Protocol == schema.PayloadProtocolIP4 && isAddressField(p.Field):
+			return schema.SetTypeIPv4Addr
+		case p.Protocol == schema.PayloadProtocolIP6 && isAddressField(p.Field):
+			return schema.SetTypeIPv6Addr
+		case p.Protocol == schema.PayloadProtocolEther && isAddressField(p.Field):
+			return schema.SetTypeEtherAddr
+		case p.Protocol == schema.PayloadProtocolIP4 && p.Field == schema.PayloadFieldIP4Protocol,
+			p.Protocol == schema.PayloadProtocolIP6 && p.Field == schema.PayloadFieldIP6NextHdr:
+			return schema.SetTypeInetProto
+		case p.Field == "sport" || p.Field == "dport":
+			return schema.SetTypeInetService
+		}
+	case expression.Meta != nil:
+		switch expression.Meta.Key {
+		case schema.MetaKeyIifname, schema.MetaKeyOifname:
+			return schema.SetTypeIfname
+		case schema.MetaKeyMark:
+			return schema.SetTypeMark
+		case schema.MetaKeyL4proto:
+			return schema.SetTypeInetProto
+		}
+	}
+	return ""
+}
+
+func isAddressField(field string) bool {
+	return field == schema.PayloadFieldIPSAddr || field == schema.PayloadFieldIPDAddr
+}
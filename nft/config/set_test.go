@@ -0,0 +1,441 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+const setName = "test-set"
+
+func TestSet(t *testing.T) {
+	t.Run("Add set with elements, check round-trip", func(t *testing.T) {
+		address := "10.0.0.1"
+		set := &schema.Set{
+			Family: schema.FamilyIP,
+			Table:  tableName,
+			Name:   setName,
+			Type:   schema.SetTypeIPv4Addr,
+			Flags:  &schema.Flags{Flags: []string{schema.SetFlagInterval}},
+			Elem:   []schema.Expression{{String: &address}},
+		}
+		config := nft.NewConfig()
+		config.AddSet(set)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"set":{"family":"ip","table":%q,"name":%q,"type":"ipv4_addr","flags":"interval","elem":["10.0.0.1"]}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON(serializedConfig))
+		assert.Equal(t, config, deserializedConfig)
+	})
+
+	t.Run("Read set with concatenated type from nft output", func(t *testing.T) {
+		serializedConfig := fmt.Sprintf(
+			`{"nftables":[{"set":{"family":"inet","name":%q,"table":%q,"type":["ipv4_addr","inet_service"],"handle":"5","flags":["interval"]}}]}`,
+			setName, tableName,
+		)
+
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(serializedConfig)))
+
+		handle := 5
+		expectedConfig := nft.NewConfig()
+		expectedConfig.AddSet(&schema.Set{
+			Family: schema.FamilyINET,
+			Table:  tableName,
+			Name:   setName,
+			Handle: &handle,
+			Type:   schema.SetTypeIPv4Addr + " . " + schema.SetTypeInetService,
+			Flags:  &schema.Flags{Flags: []string{schema.SetFlagInterval}},
+		})
+		assert.Equal(t, expectedConfig, config)
+
+		serializedSet, err := json.Marshal(config.Nftables[0].Set)
+		assert.NoError(t, err)
+		assert.Contains(t, string(serializedSet), `"type":["ipv4_addr","inet_service"]`)
+	})
+
+	t.Run("Delete set, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.DeleteSet(&schema.Set{Family: schema.FamilyIP, Table: tableName, Name: setName})
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"delete":{"set":{"family":"ip","table":%q,"name":%q}}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Add set with commented elements, check round-trip", func(t *testing.T) {
+		addresses := []string{"192.0.2.1", "192.0.2.2"}
+		set := &schema.Set{
+			Family: schema.FamilyIP,
+			Table:  tableName,
+			Name:   setName,
+			Type:   schema.SetTypeIPv4Addr,
+			Elem: []schema.Expression{
+				{Elem: &schema.Elem{Val: schema.Expression{String: &addresses[0]}, Comment: "botnet"}},
+				{String: &addresses[1]},
+			},
+		}
+		config := nft.NewConfig()
+		config.AddSet(set)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"set":{"family":"ip","table":%q,"name":%q,"type":"ipv4_addr",`+
+				`"elem":[{"elem":{"val":"192.0.2.1","comment":"botnet"}},"192.0.2.2"]}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON(serializedConfig))
+		assert.Equal(t, config, deserializedConfig)
+	})
+
+	t.Run("Create set, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.CreateSet(&schema.Set{Family: schema.FamilyIP, Table: tableName, Name: setName, Type: schema.SetTypeIPv4Addr})
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"create":{"set":{"family":"ip","table":%q,"name":%q,"type":"ipv4_addr"}}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Flush set, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.FlushSet(&schema.Set{Family: schema.FamilyIP, Table: tableName, Name: setName})
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"flush":{"set":{"family":"ip","table":%q,"name":%q}}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+}
+
+func TestMap(t *testing.T) {
+	t.Run("Add map with elements, check round-trip", func(t *testing.T) {
+		m := &schema.Map{
+			Family: schema.FamilyIP,
+			Table:  tableName,
+			Name:   "test-map",
+			Type:   schema.SetTypeInetService,
+			Map:    schema.SetTypeIPv4Addr,
+			Elem:   []schema.Expression{{RowData: json.RawMessage(`[80,"10.0.0.1"]`)}},
+		}
+		config := nft.NewConfig()
+		config.AddMap(m)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"map":{"family":"ip","table":%q,"name":"test-map","type":"inet_service","map":"ipv4_addr","elem":[[80,"10.0.0.1"]]}}]}`,
+			tableName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+
+		deserializedConfig := nft.NewConfig()
+		assert.NoError(t, deserializedConfig.FromJSON(serializedConfig))
+		assert.Equal(t, config, deserializedConfig)
+	})
+
+	t.Run("Create map, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.CreateMap(&schema.Map{
+			Family: schema.FamilyIP, Table: tableName, Name: "test-map", Type: schema.SetTypeInetService, Map: schema.SetTypeIPv4Addr,
+		})
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"create":{"map":{"family":"ip","table":%q,"name":"test-map","type":"inet_service","map":"ipv4_addr"}}}]}`,
+			tableName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Flush map, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.FlushMap(&schema.Map{Family: schema.FamilyIP, Table: tableName, Name: "test-map"})
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(`{"nftables":[{"flush":{"map":{"family":"ip","table":%q,"name":"test-map"}}}]}`, tableName)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+}
+
+func TestElements(t *testing.T) {
+	addresses := []string{"10.0.0.1", "10.0.0.2"}
+	element := &schema.Element{
+		Family: schema.FamilyIP,
+		Table:  tableName,
+		Name:   setName,
+		Elem:   []schema.Expression{{String: &addresses[0]}, {String: &addresses[1]}},
+	}
+
+	t.Run("Add elements, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.AddElements(element)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"element":{"family":"ip","table":%q,"name":%q,"elem":["10.0.0.1","10.0.0.2"]}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Delete elements, check serialization", func(t *testing.T) {
+		config := nft.NewConfig()
+		config.DeleteElements(element)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+
+		expected := fmt.Sprintf(
+			`{"nftables":[{"delete":{"element":{"family":"ip","table":%q,"name":%q,"elem":["10.0.0.1","10.0.0.2"]}}}]}`,
+			tableName, setName,
+		)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+}
+
+func TestPromoteAnonymousSet(t *testing.T) {
+	const anonymousSetRule = `{"rule":{"family":"ip","table":%q,"chain":%q,"expr":[` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip","field":"saddr"}},` +
+		`"right":{"set":["192.0.2.1",{"prefix":{"addr":"198.51.100.0","len":24}}]}}},{"drop":null}]}}`
+	const namedSetRule = `{"rule":{"family":"ip","table":%q,"chain":%q,"expr":[` +
+		`{"match":{"op":"==","left":{"payload":{"protocol":"ip","field":"saddr"}},"right":"@blocklist"}},{"drop":null}]}}`
+	const namedSet = `{"set":{"family":"ip","table":%q,"name":"blocklist","type":"ipv4_addr","flags":"interval",` +
+		`"elem":["192.0.2.1",{"prefix":{"addr":"198.51.100.0","len":24}}]}}`
+
+	t.Run("Promote an anonymous set to a named set", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(fmt.Sprintf(`{"nftables":[`+anonymousSetRule+`]}`, tableName, chainName))))
+
+		set, err := config.PromoteAnonymousSet(config.Nftables[0].Rule, "blocklist")
+		assert.NoError(t, err)
+		assert.Equal(t, schema.SetTypeIPv4Addr, set.Type)
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		expected := fmt.Sprintf(`{"nftables":[`+namedSet+`,`+namedSetRule+`]}`, tableName, tableName, chainName)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Inline a named set", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(fmt.Sprintf(`{"nftables":[`+namedSet+`,`+namedSetRule+`]}`, tableName, tableName, chainName))))
+
+		assert.NoError(t, config.InlineSet(config.Nftables[1].Rule, "blocklist"))
+
+		serializedConfig, err := config.ToJSON()
+		assert.NoError(t, err)
+		expected := fmt.Sprintf(`{"nftables":[`+namedSet+`,`+anonymousSetRule+`]}`, tableName, tableName, chainName)
+		assert.Equal(t, expected, string(serializedConfig))
+	})
+
+	t.Run("Promote an anonymous set of an unknown type", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(fmt.Sprintf(`{"nftables":[{"rule":{"family":"ip","table":%q,"chain":%q,"expr":[`+
+			`{"match":{"op":"==","left":{"meta":{"key":"skuid"}},"right":{"set":[1000,1001]}}},{"accept":null}]}}]}`,
+			tableName, chainName))))
+
+		_, err := config.PromoteAnonymousSet(config.Nftables[0].Rule, "users")
+		assert.Error(t, err)
+	})
+
+	t.Run("Promote a rule with no anonymous set", func(t *testing.T) {
+		config := nft.NewConfig()
+		assert.NoError(t, config.FromJSON([]byte(fmt.Sprintf(`{"nftables":[`+namedSetRule+`]}`, tableName, chainName))))
+
+		_, err := config.PromoteAnonymousSet(config.Nftables[0].Rule, "other")
+		assert.Error(t, err)
+		assert.Error(t, config.InlineSet(config.Nftables[0].Rule, "blocklist"))
+	})
+}
+
+func TestSetDeduplicate(t *testing.T) {
+	expressions := func(data string) []schema.Expression {
+		var elements []schema.Expression
+		assert.NoError(t, json.Unmarshal([]byte(data), &elements))
+		return elements
+	}
+	intervalFlags := &schema.Flags{Flags: []string{schema.SetFlagInterval}}
+
+	tests := []struct {
+		name            string
+		flags           *schema.Flags
+		elements        string
+		expected        string
+		expectedRemoved string
+	}{
+		{
+			name:            "Remove duplicate elements",
+			elements:        `["192.0.2.1","192.0.2.2","192.0.2.1"]`,
+			expected:        `["192.0.2.1","192.0.2.2"]`,
+			expectedRemoved: `["192.0.2.1"]`,
+		},
+		{
+			name:     "Keep overlapping elements of a set without intervals",
+			elements: `["192.0.2.1",{"prefix":{"addr":"192.0.2.0","len":24}}]`,
+			expected: `["192.0.2.1",{"prefix":{"addr":"192.0.2.0","len":24}}]`,
+		},
+		{
+			name:  "Merge overlapping prefixes and addresses",
+			flags: intervalFlags,
+			elements: `["198.51.100.7",{"prefix":{"addr":"192.0.2.0","len":25}},"192.0.2.5",` +
+				`{"prefix":{"addr":"192.0.2.128","len":25}}]`,
+			expected: `["198.51.100.7",{"prefix":{"addr":"192.0.2.0","len":24}}]`,
+			expectedRemoved: `[{"prefix":{"addr":"192.0.2.0","len":25}},"192.0.2.5",` +
+				`{"prefix":{"addr":"192.0.2.128","len":25}}]`,
+		},
+		{
+			name:            "Merge adjacent addresses into a range",
+			flags:           intervalFlags,
+			elements:        `["192.0.2.3","192.0.2.1","192.0.2.2"]`,
+			expected:        `[{"range":["192.0.2.1","192.0.2.3"]}]`,
+			expectedRemoved: `["192.0.2.3","192.0.2.1","192.0.2.2"]`,
+		},
+		{
+			name:            "Merge IPv6 prefixes",
+			flags:           intervalFlags,
+			elements:        `[{"prefix":{"addr":"2001:db8::","len":33}},{"prefix":{"addr":"2001:db8:8000::","len":33}}]`,
+			expected:        `[{"prefix":{"addr":"2001:db8::","len":32}}]`,
+			expectedRemoved: `[{"prefix":{"addr":"2001:db8::","len":33}},{"prefix":{"addr":"2001:db8:8000::","len":33}}]`,
+		},
+		{
+			name:            "Merge overlapping port ranges",
+			flags:           intervalFlags,
+			elements:        `[{"range":[1000,2000]},22,{"range":[1500,3000]},3001]`,
+			expected:        `[{"range":[1000,3001]},22]`,
+			expectedRemoved: `[{"range":[1000,2000]},{"range":[1500,3000]},3001]`,
+		},
+		{
+			name:     "Keep elements with attributes",
+			flags:    intervalFlags,
+			elements: `[{"elem":{"val":"192.0.2.1","comment":"host"}},{"prefix":{"addr":"192.0.2.0","len":24}}]`,
+			expected: `[{"elem":{"val":"192.0.2.1","comment":"host"}},{"prefix":{"addr":"192.0.2.0","len":24}}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := &schema.Set{Family: schema.FamilyIP, Table: tableName, Name: setName, Flags: tt.flags, Elem: expressions(tt.elements)}
+
+			removed := set.Deduplicate()
+
+			elements, err := json.Marshal(set.Elem)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(elements))
+			if tt.expectedRemoved == "" {
+				assert.Empty(t, removed)
+			} else {
+				removedElements, err := json.Marshal(removed)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedRemoved, string(removedElements))
+			}
+		})
+	}
+}
+
+func TestSetValidate(t *testing.T) {
+	flags := func(flags ...string) *schema.Flags {
+		return &schema.Flags{Flags: flags}
+	}
+	address := "192.0.2.1"
+	timeoutElement := schema.Expression{Elem: &schema.Elem{Val: schema.Expression{String: &address}, Timeout: 60}}
+	newSet := func() schema.Set {
+		return schema.Set{Family: schema.FamilyIP, Table: tableName, Name: setName, Type: schema.SetTypeIPv4Addr}
+	}
+
+	validTests := map[string]func(*schema.Set){
+		"with no attributes":             func(*schema.Set) {},
+		"with gc-interval and a timeout": func(s *schema.Set) { s.Timeout, s.GcInterval = 3600, 60 },
+		"with dynamic and timeout flags": func(s *schema.Set) { s.Flags = flags(schema.SetFlagDynamic, schema.SetFlagTimeout) },
+		"with element timeouts": func(s *schema.Set) {
+			s.Flags, s.Elem = flags(schema.SetFlagTimeout), []schema.Expression{timeoutElement}
+		},
+		"with elements within the size": func(s *schema.Set) { s.Size, s.Elem = 1, []schema.Expression{{String: &address}} },
+		"with auto-merge":               func(s *schema.Set) { s.Flags, s.AutoMerge = flags(schema.SetFlagInterval), true },
+	}
+	for name, update := range validTests {
+		t.Run("Validate a set "+name, func(t *testing.T) {
+			set := newSet()
+			update(&set)
+			assert.NoError(t, set.Validate())
+		})
+	}
+
+	invalidTests := map[string]func(*schema.Set){
+		"without a type":                   func(s *schema.Set) { s.Type = "" },
+		"without a name":                   func(s *schema.Set) { s.Name = "" },
+		"with a negative size":             func(s *schema.Set) { s.Size = -1 },
+		"with gc-interval and no timeout":  func(s *schema.Set) { s.GcInterval = 60 },
+		"with element timeouts only":       func(s *schema.Set) { s.Elem = []schema.Expression{timeoutElement} },
+		"with constant and dynamic flags":  func(s *schema.Set) { s.Flags = flags(schema.SetFlagConstant, schema.SetFlagDynamic) },
+		"with a constant flag and timeout": func(s *schema.Set) { s.Flags, s.Timeout = flags(schema.SetFlagConstant), 60 },
+		"with auto-merge and no interval":  func(s *schema.Set) { s.AutoMerge = true },
+		"with elements exceeding the size": func(s *schema.Set) {
+			s.Size, s.Elem = 1, []schema.Expression{{String: &address}, {String: &address}}
+		},
+	}
+	for name, update := range invalidTests {
+		t.Run("Validate a set "+name, func(t *testing.T) {
+			set := newSet()
+			update(&set)
+			assert.Error(t, set.Validate())
+		})
+	}
+}
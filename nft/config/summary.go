@@ -0,0 +1,83 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// ConfigSummary holds the counts of the objects of a config.
+type ConfigSummary struct {
+	Tables        int
+	BaseChains    int
+	RegularChains int
+	Rules         int
+	Sets          int
+	Maps          int
+	// Elements counts the elements of the sets and maps, and of the element entries.
+	Elements int
+}
+
+// String returns the summary on a single line, e.g. for logging.
+func (s ConfigSummary) String() string {
+	return fmt.Sprintf("%d table(s), %d base chain(s), %d regular chain(s), %d rule(s), %d set(s), %d map(s), %d element(s)",
+		s.Tables, s.BaseChains, s.RegularChains, s.Rules, s.Sets, s.Maps, s.Elements)
+}
+
+// Summary returns the counts of the objects defined by the config, in a single pass over its entries.
+// The objects of entries without an explicit action, with `add` or `create` are counted,
+// the ones of `delete` and `flush` entries are not.
+func (c *Config) Summary() ConfigSummary {
+	var summary ConfigSummary
+	for _, nftable := range c.Nftables {
+		switch {
+		case nftable.Add != nil:
+			summary.add(declarativeEntry(nftable.Add))
+		case nftable.Create != nil:
+			summary.add(declarativeEntry(nftable.Create))
+		case nftable.Delete == nil && nftable.Flush == nil:
+			summary.add(nftable)
+		}
+	}
+	return summary
+}
+
+func (s *ConfigSummary) add(nftable schema.Nftable) {
+	switch {
+	case nftable.Table != nil:
+		s.Tables++
+	case nftable.Chain != nil && nftable.Chain.Hook != "":
+		s.BaseChains++
+	case nftable.Chain != nil:
+		s.RegularChains++
+	case nftable.Rule != nil:
+		s.Rules++
+	case nftable.Set != nil:
+		s.Sets++
+		s.Elements += len(nftable.Set.Elem)
+	case nftable.Map != nil:
+		s.Maps++
+		s.Elements += len(nftable.Map.Elem)
+	case nftable.Element != nil:
+		s.Elements += len(nftable.Element.Elem)
+	}
+}
@@ -31,6 +31,14 @@ func (c *Config) AddTable(table *schema.Table) {
 	c.Nftables = append(c.Nftables, nftable)
 }
 
+// CreateTable appends the given table to the nftable config
+// with the `create` action.
+// Unlike adding it, attempting to create an existing table results with a failure when the config is applied.
+func (c *Config) CreateTable(table *schema.Table) {
+	nftable := schema.Nftable{Create: &schema.Objects{Table: table}}
+	c.Nftables = append(c.Nftables, nftable)
+}
+
 // DeleteTable appends a given table to the nftable config
 // with the `delete` action.
 // Attempting to delete a non-existing table, results with a failure when the config is applied.
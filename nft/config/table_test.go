@@ -41,6 +41,7 @@ func TestTable(t *testing.T) {
 func testTableActions(t *testing.T) {
 	actions := map[nft.TableAction]tableActionFunc{
 		nft.TableADD:    func(c *nft.Config, t *schema.Table) { c.AddTable(t) },
+		nft.TableCREATE: func(c *nft.Config, t *schema.Table) { c.CreateTable(t) },
 		nft.TableDELETE: func(c *nft.Config, t *schema.Table) { c.DeleteTable(t) },
 		nft.TableFLUSH:  func(c *nft.Config, t *schema.Table) { c.FlushTable(t) },
 	}
@@ -0,0 +1,64 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package nft
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// LoopbackInterface is the name of the loopback interface, accepted by DefaultDropFirewall.
+const LoopbackInterface = "lo"
+
+// DefaultDropFirewall returns a config with a default drop firewall skeleton in an inet table of the given name.
+// The skeleton has the standard filter base chains, where the input and forward chains have a drop policy
+// and the output chain has an accept policy.
+// Packets of established and related connections are accepted by the input and forward chains,
+// as well as loopback packets by the input chain.
+// The returned config is intended to be extended with the rules accepting the desired traffic.
+func DefaultDropFirewall(table string) *Config {
+	t := NewTable(table, FamilyINET)
+	// The filter priority is defined on all the hooks of the inet family, the chains cannot fail.
+	chains, _ := StandardFilterChains(t)
+	input, forward := chains[0], chains[1]
+	input.Policy, forward.Policy = schema.PolicyDrop, schema.PolicyDrop
+
+	config := NewConfig()
+	config.AddTable(t)
+	for _, chain := range chains {
+		config.AddChain(chain)
+	}
+
+	established, _ := CtStateIn(schema.CtStateEstablished, schema.CtStateRelated)
+	acceptEstablished := []schema.Statement{established, {Verdict: schema.Accept()}}
+	loopback := LoopbackInterface
+	acceptLoopback := []schema.Statement{
+		{Match: &schema.Match{
+			Op:    schema.OperEQ,
+			Left:  schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyIif}},
+			Right: schema.Expression{String: &loopback},
+		}},
+		{Verdict: schema.Accept()},
+	}
+	config.AddRule(NewRule(t, input, acceptEstablished, nil, nil, ""))
+	config.AddRule(NewRule(t, input, acceptLoopback, nil, nil, ""))
+	config.AddRule(NewRule(t, forward, acceptEstablished, nil, nil, ""))
+
+	return config
+}
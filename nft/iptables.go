@@ -0,0 +1,432 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package nft
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// iptablesChains maps the iptables builtin chains to the standard nft chain names.
+var iptablesChains = map[string]string{
+	"INPUT":       "input",
+	"FORWARD":     "forward",
+	"OUTPUT":      "output",
+	"PREROUTING":  "prerouting",
+	"POSTROUTING": "postrouting",
+}
+
+// iptablesModules are the match modules accepted with `-m`, the options of which are translated.
+var iptablesModules = map[string]bool{
+	"tcp":       true,
+	"udp":       true,
+	"multiport": true,
+	"conntrack": true,
+	"state":     true,
+	"comment":   true,
+}
+
+// iptablesRejectTypes maps the REJECT target `--reject-with` values to the reject statement.
+var iptablesRejectTypes = map[string]schema.Reject{
+	"tcp-reset":              {Type: schema.RejectTypeTCPReset},
+	"icmp-net-unreachable":   {Type: schema.RejectTypeICMP, Expr: "net-unreachable"},
+	"icmp-host-unreachable":  {Type: schema.RejectTypeICMP, Expr: "host-unreachable"},
+	"icmp-port-unreachable":  {Type: schema.RejectTypeICMP, Expr: "port-unreachable"},
+	"icmp-proto-unreachable": {Type: schema.RejectTypeICMP, Expr: "prot-unreachable"},
+	"icmp-net-prohibited":    {Type: schema.RejectTypeICMP, Expr: "net-prohibited"},
+	"icmp-host-prohibited":   {Type: schema.RejectTypeICMP, Expr: "host-prohibited"},
+	"icmp-admin-prohibited":  {Type: schema.RejectTypeICMP, Expr: "admin-prohibited"},
+	"icmp6-no-route":         {Type: schema.RejectTypeICMPv6, Expr: "no-route"},
+	"icmp6-adm-prohibited":   {Type: schema.RejectTypeICMPv6, Expr: "admin-prohibited"},
+	"icmp6-addr-unreachable": {Type: schema.RejectTypeICMPv6, Expr: "addr-unreachable"},
+	"icmp6-port-unreachable": {Type: schema.RejectTypeICMPv6, Expr: "port-unreachable"},
+}
+
+// iptablesUnsupportedTargets are common iptables extension targets, which are not translated
+// (other targets are taken for user chains).
+var iptablesUnsupportedTargets = map[string]bool{
+	"SNAT": true, "DNAT": true, "REDIRECT": true, "NETMAP": true, "TPROXY": true,
+	"MARK": true, "CONNMARK": true, "CT": true, "NOTRACK": true, "CLASSIFY": true, "DSCP": true, "TOS": true,
+	"TCPMSS": true, "NFLOG": true, "NFQUEUE": true, "QUEUE": true, "AUDIT": true, "TRACE": true, "SET": true,
+}
+
+// iptablesLogLevels are the log levels by their numeric syslog level, as accepted by the LOG target `--log-level`.
+var iptablesLogLevels = []string{
+	schema.LogLevelEmerg, schema.LogLevelAlert, schema.LogLevelCrit, schema.LogLevelErr,
+	schema.LogLevelWarn, schema.LogLevelNotice, schema.LogLevelInfo, schema.LogLevelDebug,
+}
+
+// iptablesLogLevelNames are the log levels by their syslog name, as accepted by the LOG target `--log-level`.
+var iptablesLogLevelNames = map[string]string{
+	"emerg": schema.LogLevelEmerg, "panic": schema.LogLevelEmerg, "alert": schema.LogLevelAlert,
+	"crit": schema.LogLevelCrit, "err": schema.LogLevelErr, "error": schema.LogLevelErr,
+	"warn": schema.LogLevelWarn, "warning": schema.LogLevelWarn, "notice": schema.LogLevelNotice,
+	"info": schema.LogLevelInfo, "debug": schema.LogLevelDebug,
+}
+
+// FromIptablesRule translates an iptables rule specification (e.g. `-A INPUT -p tcp --dport 22 -j ACCEPT`)
+// to an nft rule, on a best-effort basis to help migrating rulesets.
+// The rule is of the ip family, or ip6 when IPv6 addresses are matched, in the `filter` table by default.
+// The builtin chains are translated to the standard nft chain names (e.g. `INPUT` to `input`).
+//
+// Only a common subset of the iptables syntax is supported, other options fail the translation:
+//   - The table and chain: `-t`, `-A`.
+//   - The protocol, addresses and interfaces: `-p`, `-s`, `-d`, `-i`, `-o` (with `+` wildcards).
+//   - The tcp, udp and multiport ports: `--sport`, `--dport`, `--sports`, `--dports` (with ranges).
+//   - The conntrack and state modules: `--ctstate`, `--state`.
+//   - The comment module: `--comment`.
+//   - The ACCEPT, DROP, RETURN, REJECT (`--reject-with`), LOG (`--log-prefix`, `--log-level`) and MASQUERADE
+//     targets, and the user chains to jump or go to (`-j`, `-g`).
+//
+// The matches are translated in the given order and can be negated (`!`).
+// The protocol is matched by the ports when given, as nft does (e.g. `tcp dport 22`).
+// The rule counters of iptables are not translated, a counter statement is to be added explicitly if needed.
+func FromIptablesRule(spec string) (schema.Rule, error) {
+	args, err := splitIptablesSpec(spec)
+	if err != nil {
+		return schema.Rule{}, err
+	}
+
+	t := iptablesTranslation{rule: schema.Rule{Family: string(FamilyIP), Table: "filter"}, protocolIndex: -1}
+	for i := 0; i < len(args); i++ {
+		option, negated := args[i], false
+		if option == "!" {
+			i++
+			if i == len(args) {
+				return schema.Rule{}, fmt.Errorf("failed to translate iptables rule: missing option after '!'")
+			}
+			option, negated = args[i], true
+		}
+		i++
+		if i == len(args) {
+			return schema.Rule{}, fmt.Errorf("failed to translate iptables rule: option %s requires a value", option)
+		}
+		if err := t.translate(option, args[i], negated); err != nil {
+			return schema.Rule{}, fmt.Errorf("failed to translate iptables rule: %v", err)
+		}
+	}
+
+	if err := t.finish(); err != nil {
+		return schema.Rule{}, fmt.Errorf("failed to translate iptables rule: %v", err)
+	}
+	return t.rule, nil
+}
+
+// iptablesTranslation holds the state of an iptables rule translation.
+type iptablesTranslation struct {
+	rule schema.Rule
+
+	// The protocol match, at its index in the statements, is dropped if the ports are matched.
+	protocol      string
+	protocolIndex int
+	portsMatched  bool
+	family        string
+
+	target     string
+	goTo       bool
+	targetOpts map[string]string
+}
+
+func (t *iptablesTranslation) translate(option, value string, negated bool) error {
+	op := schema.OperEQ
+	if negated {
+		op = schema.OperNEQ
+		switch option {
+		case "-t", "--table", "-A", "--append", "-m", "--match", "-j", "--jump", "-g", "--goto", "--comment":
+			return fmt.Errorf("option %s cannot be negated", option)
+		}
+	}
+
+	switch option {
+	case "-t", "--table":
+		t.rule.Table = value
+	case "-A", "--append":
+		t.rule.Chain = value
+		if name, isBuiltin := iptablesChains[value]; isBuiltin {
+			t.rule.Chain = name
+		}
+	case "-m", "--match":
+		if !iptablesModules[value] {
+			return fmt.Errorf("unsupported match module %q", value)
+		}
+	case "-p", "--protocol":
+		t.protocol = strings.ToLower(value)
+		if t.protocol == "all" {
+			return nil
+		}
+		protocol := t.protocol
+		t.protocolIndex = len(t.rule.Expr)
+		t.addMatch(op, schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyL4proto}}, schema.Expression{String: &protocol})
+		if negated {
+			t.protocolIndex = -1
+		}
+	case "-s", "--source", "-d", "--destination":
+		return t.translateAddress(option == "-s" || option == "--source", value, op)
+	case "-i", "--in-interface", "-o", "--out-interface":
+		key := schema.MetaKeyIifname
+		if option == "-o" || option == "--out-interface" {
+			key = schema.MetaKeyOifname
+		}
+		name := value
+		if strings.HasSuffix(name, "+") {
+			name = strings.TrimSuffix(name, "+") + "*"
+		}
+		t.addMatch(op, schema.Expression{Meta: &schema.Meta{Key: key}}, schema.Expression{String: &name})
+	case "--sport", "--source-port", "--dport", "--destination-port", "--sports", "--source-ports", "--dports", "--destination-ports":
+		return t.translatePorts(option, value, op)
+	case "--ctstate", "--state":
+		states := strings.Split(strings.ToLower(value), ",")
+		statement, err := CtStateIn(states...)
+		if err != nil {
+			return err
+		}
+		if negated {
+			statement.Match.Op = schema.OperNEQ
+		}
+		t.rule.Expr = append(t.rule.Expr, statement)
+	case "--comment":
+		t.rule.Comment = value
+	case "-j", "--jump", "-g", "--goto":
+		t.target = value
+		t.goTo = option == "-g" || option == "--goto"
+	case "--reject-with", "--log-prefix", "--log-level":
+		if t.targetOpts == nil {
+			t.targetOpts = map[string]string{}
+		}
+		t.targetOpts[option] = value
+	default:
+		return fmt.Errorf("unsupported option %s", option)
+	}
+	return nil
+}
+
+func (t *iptablesTranslation) addMatch(op string, left, right schema.Expression) {
+	t.rule.Expr = append(t.rule.Expr, schema.Statement{Match: &schema.Match{Op: op, Left: left, Right: right}})
+}
+
+func (t *iptablesTranslation) translateAddress(isSource bool, address string, op string) error {
+	if strings.Contains(address, ",") {
+		return fmt.Errorf("unsupported address list %q", address)
+	}
+	expression, err := IPAddress(address)
+	if err != nil {
+		return err
+	}
+
+	family := string(FamilyIP)
+	if ip := net.ParseIP(strings.SplitN(address, "/", 2)[0]); ip == nil || ip.To4() == nil || strings.Contains(address, ":") {
+		family = string(FamilyIP6)
+	}
+	if t.family != "" && t.family != family {
+		return fmt.Errorf("conflicting IPv4 and IPv6 addresses")
+	}
+	t.family = family
+
+	field := schema.PayloadFieldIPDAddr
+	if isSource {
+		field = schema.PayloadFieldIPSAddr
+	}
+	t.addMatch(op, schema.Expression{Payload: &schema.Payload{Protocol: family, Field: field}}, expression)
+	return nil
+}
+
+func (t *iptablesTranslation) translatePorts(option, value string, op string) error {
+	switch t.protocol {
+	case "tcp", "udp", "sctp", "dccp":
+	default:
+		return fmt.Errorf("option %s requires the tcp, udp, sctp or dccp protocol", option)
+	}
+
+	field := "dport"
+	if strings.HasPrefix(option, "--s") {
+		field = "sport"
+	}
+	var right schema.Expression
+	if strings.HasSuffix(option, "s") {
+		var ports []schema.Expression
+		for _, port := range strings.Split(value, ",") {
+			expression, err := portExpression(port)
+			if err != nil {
+				return err
+			}
+			ports = append(ports, expression)
+		}
+		right = schema.Expression{Set: ports}
+	} else {
+		expression, err := portExpression(value)
+		if err != nil {
+			return err
+		}
+		right = expression
+	}
+
+	t.portsMatched = true
+	t.addMatch(op, schema.Expression{Payload: &schema.Payload{Protocol: t.protocol, Field: field}}, right)
+	return nil
+}
+
+// portExpression returns the expression of a port or a port range (e.g. `1024:65535`, with optional bounds).
+func portExpression(port string) (schema.Expression, error) {
+	if !strings.Contains(port, ":") {
+		value, err := parsePort(port)
+		return schema.Expression{Float64: &value}, err
+	}
+
+	bounds := strings.SplitN(port, ":", 2)
+	if bounds[0] == "" {
+		bounds[0] = "0"
+	}
+	if bounds[1] == "" {
+		bounds[1] = "65535"
+	}
+	low, err := parsePort(bounds[0])
+	if err != nil {
+		return schema.Expression{}, err
+	}
+	high, err := parsePort(bounds[1])
+	if err != nil {
+		return schema.Expression{}, err
+	}
+	return schema.Expression{Range: &schema.Range{Low: schema.Expression{Float64: &low}, High: schema.Expression{Float64: &high}}}, nil
+}
+
+func parsePort(port string) (float64, error) {
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unsupported port %q, expected a port number", port)
+	}
+	return float64(value), nil
+}
+
+// finish completes the rule with the protocol simplification, the family and the target.
+func (t *iptablesTranslation) finish() error {
+	if t.rule.Chain == "" {
+		return fmt.Errorf("missing chain, expected the -A option")
+	}
+	if t.family != "" {
+		t.rule.Family = t.family
+	}
+	if t.portsMatched && t.protocolIndex >= 0 {
+		t.rule.Expr = append(t.rule.Expr[:t.protocolIndex], t.rule.Expr[t.protocolIndex+1:]...)
+	}
+
+	statement, err := t.targetStatement()
+	if err != nil {
+		return err
+	}
+	if statement != nil {
+		t.rule.Expr = append(t.rule.Expr, *statement)
+	}
+	return nil
+}
+
+func (t *iptablesTranslation) targetStatement() (*schema.Statement, error) {
+	for option := range t.targetOpts {
+		if !(option == "--reject-with" && t.target == "REJECT") && !(option != "--reject-with" && t.target == "LOG") {
+			return nil, fmt.Errorf("option %s is not supported with the %q target", option, t.target)
+		}
+	}
+
+	switch t.target {
+	case "":
+		return nil, nil
+	case "ACCEPT":
+		return &schema.Statement{Verdict: schema.Accept()}, nil
+	case "DROP":
+		return &schema.Statement{Verdict: schema.Drop()}, nil
+	case "RETURN":
+		return &schema.Statement{Verdict: schema.Return()}, nil
+	case "MASQUERADE":
+		return &schema.Statement{Nat: schema.Nat{Masquerade: &schema.Masquerade{Enabled: true}}}, nil
+	case "REJECT":
+		reject := schema.Reject{}
+		if with, exists := t.targetOpts["--reject-with"]; exists {
+			var known bool
+			if reject, known = iptablesRejectTypes[with]; !known {
+				return nil, fmt.Errorf("unsupported reject type %q", with)
+			}
+		}
+		return &schema.Statement{Reject: &reject}, nil
+	case "LOG":
+		log := schema.Log{Prefix: t.targetOpts["--log-prefix"]}
+		if level, exists := t.targetOpts["--log-level"]; exists {
+			var known bool
+			if n, err := strconv.Atoi(level); err == nil {
+				if known = n >= 0 && n < len(iptablesLogLevels); known {
+					log.Level = iptablesLogLevels[n]
+				}
+			} else {
+				log.Level, known = iptablesLogLevelNames[strings.ToLower(level)]
+			}
+			if !known {
+				return nil, fmt.Errorf("unsupported log level %q", level)
+			}
+		}
+		return &schema.Statement{Log: &log}, nil
+	}
+
+	if iptablesUnsupportedTargets[t.target] {
+		return nil, fmt.Errorf("unsupported target %q", t.target)
+	}
+	target := &schema.ToTarget{Target: t.target}
+	if t.goTo {
+		return &schema.Statement{Verdict: schema.Verdict{Goto: target}}, nil
+	}
+	return &schema.Statement{Verdict: schema.Verdict{Jump: target}}, nil
+}
+
+// splitIptablesSpec splits the rule specification into its arguments, as a shell would,
+// honoring the single and double quotes (e.g. of a comment).
+func splitIptablesSpec(spec string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range spec {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("failed to translate iptables rule: unterminated quote in %q", spec)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	// MaxStdoutSize is the maximum size in bytes of the nft standard output which is captured.
+	// An output exceeding it fails the command with ErrOutputTooLarge, zero implies no limit.
+	// There is no limit by default: the ruleset and set element listings are decoded as streamed by ReadConfig
+	// and WalkSetElements, without capturing them, while the other outputs are decoded in full once captured,
+	// the decoded objects taking about as much memory as the capture.
+	MaxStdoutSize = 0
+	// MaxStderrSize is the maximum size in bytes of the nft standard error output which is captured.
+	// An output exceeding it is truncated, with a marker stating the number of dropped bytes.
+	// Zero implies no limit.
+	MaxStderrSize = 64 * 1024
+)
+
+// ErrOutputTooLarge is returned (wrapped) when the nft output exceeds MaxStdoutSize.
+var ErrOutputTooLarge = errors.New("nft output exceeds the maximum size")
+
+// limitedBuffer is a buffer which keeps up to a limited number of bytes, dropping the rest.
+// Writes never fail, so the command is not interrupted by the limit.
+// The buffer is not embedded, so that copying into it goes through Write (and not bytes.Buffer.ReadFrom).
+type limitedBuffer struct {
+	buffer  bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func newLimitedBuffer(limit int) *limitedBuffer {
+	return &limitedBuffer{limit: limit}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buffer.Write(p)
+	}
+
+	n := len(p)
+	if available := b.limit - b.buffer.Len(); len(p) > available {
+		if available < 0 {
+			available = 0
+		}
+		b.dropped += len(p) - available
+		p = p[:available]
+	}
+	_, _ = b.buffer.Write(p)
+	return n, nil
+}
+
+// Truncated reports whether bytes were dropped due to the limit.
+func (b *limitedBuffer) Truncated() bool {
+	return b.dropped > 0
+}
+
+// Bytes returns the kept content.
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buffer.Bytes()
+}
+
+// String returns the kept content, followed by a truncation marker if bytes were dropped.
+func (b *limitedBuffer) String() string {
+	if !b.Truncated() {
+		return b.buffer.String()
+	}
+	return fmt.Sprintf("%s[...truncated %d bytes]", b.buffer.String(), b.dropped)
+}
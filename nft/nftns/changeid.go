@@ -0,0 +1,56 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// ChangeIDTable is the table which holds the change identifier stamped by WithChangeID, as its comment.
+// The table holds no chains and therefore has no effect on the traffic.
+var ChangeIDTable = schema.Table{Family: schema.FamilyINET, Name: "go_nft_change_id"}
+
+// withChangeID returns a copy of the config, followed by the (re)definition of the change ID table.
+// The table is added before being deleted, avoiding the deletion of a missing table.
+func (c *Config) withChangeID(id string) *Config {
+	stamped := *c
+	stamped.Nftables = append([]schema.Nftable{}, c.Nftables...)
+
+	table := ChangeIDTable
+	stamped.AddTable(&table)
+	stamped.DeleteTable(&table)
+	stampedTable := ChangeIDTable
+	stampedTable.Comment = id
+	stamped.AddTable(&stampedTable)
+	return &stamped
+}
+
+// ReadChangeID returns the change identifier of the last config applied with WithChangeID.
+// An empty identifier is returned when no config has been stamped.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadChangeID(netNSPath string) (string, error) {
+	config, err := readTables(netNSPath)
+	if err != nil {
+		return "", err
+	}
+
+	if table := config.LookupTable(&ChangeIDTable); table != nil {
+		return table.Comment, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,148 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"fmt"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// CheckConfig checks whether the config applies cleanly on the system, without applying it (`nft -c`).
+// As nft stops checking at the first error, the config is checked table by table, each by a separate nft
+// invocation, reporting the errors of all the failing tables through an AggregateError.
+// Each error names its table and wraps the NftError of the check.
+// The entries of no table (e.g. a ruleset flush) are checked along with each table, in their position.
+// The config is checked as applied with the given options, except for WithExpectedTableHash.
+// Passing the check per table does not guarantee the whole config applies, e.g. an object may be
+// created twice in separate tables. The system is expected to have the `nft` executable deployed
+// and nftables enabled in the kernel.
+func CheckConfig(c *Config, opts ...ApplyOption) error {
+	options := applyOptions{mode: DefaultApplyMode}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	applied := c.withOptions(options)
+
+	var tables []TableRef
+	parts := map[TableRef]*Config{}
+	var untabled []schema.Nftable
+	for _, nftable := range applied.Nftables {
+		table, ok := entryTable(nftable)
+		if !ok {
+			untabled = append(untabled, nftable)
+			for _, part := range parts {
+				part.Nftables = append(part.Nftables, nftable)
+			}
+			continue
+		}
+		part, exists := parts[table]
+		if !exists {
+			part = &Config{NetNSPath: c.NetNSPath, PreserveCredentials: c.PreserveCredentials, NoFork: c.NoFork}
+			part.Nftables = append([]schema.Nftable{}, untabled...)
+			parts[table] = part
+			tables = append(tables, table)
+		}
+		part.Nftables = append(part.Nftables, nftable)
+	}
+	if len(tables) == 0 {
+		return checkPart(applied)
+	}
+
+	var errs []error
+	for _, table := range tables {
+		if err := checkPart(parts[table]); err != nil {
+			errs = append(errs, fmt.Errorf("table %s %s: %w", table.Family, table.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return &AggregateError{Errors: errs}
+	}
+	return nil
+}
+
+func checkPart(c *Config) error {
+	commands, err := c.plan(cmdCheck)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if _, _, err := runCommand(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryTable returns the table of the config entry, reporting false for entries of no table
+// (e.g. the metainfo and a ruleset flush).
+func entryTable(nftable schema.Nftable) (TableRef, bool) {
+	objects := schema.Objects{
+		Table:         nftable.Table,
+		Chain:         nftable.Chain,
+		Rule:          nftable.Rule,
+		Secmark:       nftable.Secmark,
+		Set:           nftable.Set,
+		Map:           nftable.Map,
+		Element:       nftable.Element,
+		CtHelper:      nftable.CtHelper,
+		CtExpectation: nftable.CtExpectation,
+		CtTimeout:     nftable.CtTimeout,
+		Counter:       nftable.Counter,
+		Quota:         nftable.Quota,
+		Limit:         nftable.Limit,
+		Synproxy:      nftable.Synproxy,
+	}
+	for _, action := range []*schema.Objects{nftable.Add, nftable.Create, nftable.Delete, nftable.Flush} {
+		if action != nil {
+			objects = *action
+		}
+	}
+
+	switch {
+	case objects.Table != nil:
+		return TableRef{Family: objects.Table.Family, Name: objects.Table.Name}, true
+	case objects.Chain != nil:
+		return TableRef{Family: objects.Chain.Family, Name: objects.Chain.Table}, true
+	case objects.Rule != nil:
+		return TableRef{Family: objects.Rule.Family, Name: objects.Rule.Table}, true
+	case objects.Secmark != nil:
+		return TableRef{Family: objects.Secmark.Family, Name: objects.Secmark.Table}, true
+	case objects.Set != nil:
+		return TableRef{Family: objects.Set.Family, Name: objects.Set.Table}, true
+	case objects.Map != nil:
+		return TableRef{Family: objects.Map.Family, Name: objects.Map.Table}, true
+	case objects.Element != nil:
+		return TableRef{Family: objects.Element.Family, Name: objects.Element.Table}, true
+	case objects.CtHelper != nil:
+		return TableRef{Family: objects.CtHelper.Family, Name: objects.CtHelper.Table}, true
+	case objects.CtExpectation != nil:
+		return TableRef{Family: objects.CtExpectation.Family, Name: objects.CtExpectation.Table}, true
+	case objects.CtTimeout != nil:
+		return TableRef{Family: objects.CtTimeout.Family, Name: objects.CtTimeout.Table}, true
+	case objects.Counter != nil:
+		return TableRef{Family: objects.Counter.Family, Name: objects.Counter.Table}, true
+	case objects.Quota != nil:
+		return TableRef{Family: objects.Quota.Family, Name: objects.Quota.Table}, true
+	case objects.Limit != nil:
+		return TableRef{Family: objects.Limit.Family, Name: objects.Limit.Table}, true
+	case objects.Synproxy != nil:
+		return TableRef{Family: objects.Synproxy.Family, Name: objects.Synproxy.Table}, true
+	}
+	return TableRef{}, false
+}
@@ -0,0 +1,111 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"sync"
+	"time"
+)
+
+// CoalescingApplier applies configs at most once per minimum interval by network namespace,
+// collapsing the requests made in between into a single apply of the latest requested config.
+// It protects the system from apply storms, e.g. from a hot reconcile loop.
+// The latest requested config is always applied, once the interval since the previous apply has elapsed.
+// A CoalescingApplier is safe for concurrent use.
+type CoalescingApplier struct {
+	minInterval time.Duration
+
+	mu         sync.Mutex
+	namespaces map[string]*coalescedApply
+}
+
+// coalescedApply holds the state of the applies to a network namespace.
+type coalescedApply struct {
+	config  *Config
+	opts    []ApplyOption
+	waiters []chan error
+
+	running   bool
+	lastApply time.Time
+}
+
+// NewCoalescingApplier returns a CoalescingApplier applying configs at most once per minInterval
+// to each network namespace.
+func NewCoalescingApplier(minInterval time.Duration) *CoalescingApplier {
+	return &CoalescingApplier{
+		minInterval: minInterval,
+		namespaces:  map[string]*coalescedApply{},
+	}
+}
+
+// Apply requests the apply of the config to its network namespace, as by ApplyConfig, and waits for it.
+// The config is applied immediately if the minimum interval elapsed since the previous apply to the namespace,
+// otherwise once it elapses, unless a later request supersedes it: the requests made in between are coalesced,
+// only the config (and options) of the latest one is applied and its result is returned to all of them.
+// The config must not be mutated until Apply returns.
+func (a *CoalescingApplier) Apply(c *Config, opts ...ApplyOption) error {
+	done := make(chan error, 1)
+
+	a.mu.Lock()
+	namespace, exists := a.namespaces[c.NetNSPath]
+	if !exists {
+		namespace = &coalescedApply{}
+		a.namespaces[c.NetNSPath] = namespace
+	}
+	namespace.config, namespace.opts = c, opts
+	namespace.waiters = append(namespace.waiters, done)
+	if !namespace.running {
+		namespace.running = true
+		go a.run(namespace)
+	}
+	a.mu.Unlock()
+
+	return <-done
+}
+
+// run applies the latest requested config to the namespace until there are no more requests,
+// waiting for the minimum interval between the applies.
+func (a *CoalescingApplier) run(namespace *coalescedApply) {
+	for {
+		a.mu.Lock()
+		wait := time.Until(namespace.lastApply.Add(a.minInterval))
+		a.mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		a.mu.Lock()
+		config, opts, waiters := namespace.config, namespace.opts, namespace.waiters
+		namespace.config, namespace.opts, namespace.waiters = nil, nil, nil
+		if config == nil {
+			namespace.running = false
+			a.mu.Unlock()
+			return
+		}
+		a.mu.Unlock()
+
+		err := ApplyConfig(config, opts...)
+
+		a.mu.Lock()
+		namespace.lastApply = time.Now()
+		a.mu.Unlock()
+		for _, done := range waiters {
+			done <- err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"context"
+	"fmt"
+)
+
+// ApplyConfigWithConfirm applies the given nftables config on the system and confirms it,
+// reverting to the ruleset prior to the apply if the confirmation fails.
+// The confirm function is called once the config is applied, e.g. to check the connectivity
+// through the new ruleset. The config is reverted if it returns an error, or if the context
+// is done (e.g. by a timeout) before it returns.
+// The confirm function is not interrupted when the context is done, it keeps running in the background
+// until it returns and its result is then discarded. It is expected to honor the context (or a similar
+// deadline), not to outlive its caller.
+// The revert replaces the whole ruleset of the network namespace with a snapshot read before the apply,
+// changes applied by others in between are lost.
+// The snapshot is restored as read, without the validation and ordering of ApplyConfig,
+// and without the remaining time to expire of its set elements.
+// The returned error wraps the confirmation error (or the context error), also when the revert fails.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ApplyConfigWithConfirm(ctx context.Context, c *Config, confirm func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	snapshot, err := ReadConfig(c.NetNSPath)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot the ruleset: %w", err)
+	}
+	if err := ApplyConfig(c); err != nil {
+		return err
+	}
+
+	confirmErr := waitForConfirmation(ctx, confirm)
+	if confirmErr == nil {
+		return nil
+	}
+
+	if err := revertRuleset(c, snapshot); err != nil {
+		return fmt.Errorf("failed to revert the ruleset (%v), not confirmed: %w", err, confirmErr)
+	}
+	return fmt.Errorf("ruleset reverted, not confirmed: %w", confirmErr)
+}
+
+// revertRuleset replaces the ruleset with the snapshot, running it as is and reporting it to
+// the OnExec callback of the applied config.
+func revertRuleset(c *Config, snapshot *Config) error {
+	revert, err := New(c.NetNSPath)
+	if err != nil {
+		return err
+	}
+	revert.PreserveCredentials = c.PreserveCredentials
+	revert.NoFork = c.NoFork
+	revert.OnExec = c.OnExec
+	revert.FlushRuleset()
+	revert.Nftables = append(revert.Nftables, snapshot.WithoutHandles().WithoutExpires().Nftables...)
+
+	data, err := revert.ToJSON()
+	if err != nil {
+		return err
+	}
+	_, err = revert.execCommand(data, cmdJSON, cmdFile, cmdStdin)
+	return err
+}
+
+// waitForConfirmation returns the error of the confirm function, or the context error if it is done first.
+// The result channel is buffered, such that the confirm goroutine exits once the function returns,
+// also after the context is done.
+func waitForConfirmation(ctx context.Context, confirm func() error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- confirm()
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,76 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// WithCountersOnAllRules adds an inline counter to each applied rule which has none
+// (neither an inline counter nor a named counter reference), giving traffic visibility over the whole config.
+// The counter is added after the leading matches of the rule, counting the packets matching the rule.
+// The config itself is not changed. Rules having a counter are left as is, so that applying again
+// a config read from the system does not stack counters.
+func WithCountersOnAllRules() ApplyOption {
+	return func(o *applyOptions) {
+		o.counters = true
+	}
+}
+
+// withCounters returns a copy of the config, with an inline counter added to the rules without any.
+func (c *Config) withCounters() *Config {
+	counted := *c
+	counted.Nftables = make([]schema.Nftable, 0, len(c.Nftables))
+	for _, nftable := range c.Nftables {
+		switch {
+		case nftable.Rule != nil:
+			nftable.Rule = ruleWithCounter(nftable.Rule)
+		case nftable.Add != nil && nftable.Add.Rule != nil:
+			add := *nftable.Add
+			add.Rule = ruleWithCounter(add.Rule)
+			nftable.Add = &add
+		case nftable.Create != nil && nftable.Create.Rule != nil:
+			create := *nftable.Create
+			create.Rule = ruleWithCounter(create.Rule)
+			nftable.Create = &create
+		}
+		counted.Nftables = append(counted.Nftables, nftable)
+	}
+	return &counted
+}
+
+// ruleWithCounter returns the rule if it has a counter, otherwise a copy of it with an inline counter
+// inserted after its leading matches.
+func ruleWithCounter(rule *schema.Rule) *schema.Rule {
+	position := len(rule.Expr)
+	for i, statement := range rule.Expr {
+		if statement.Counter != nil || statement.CounterRef != nil {
+			return rule
+		}
+		if statement.Match == nil && position == len(rule.Expr) {
+			position = i
+		}
+	}
+
+	counted := *rule
+	counted.Expr = make([]schema.Statement, 0, len(rule.Expr)+1)
+	counted.Expr = append(counted.Expr, rule.Expr[:position]...)
+	counted.Expr = append(counted.Expr, schema.Statement{Counter: &schema.Counter{}})
+	counted.Expr = append(counted.Expr, rule.Expr[position:]...)
+	return &counted
+}
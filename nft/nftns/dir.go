@@ -0,0 +1,101 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	nftconfig "github.com/networkplumbing/go-nft/nft/config"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// configFileExt is the extension of the config files applied from a directory.
+const configFileExt = ".json"
+
+// ApplyDir reads the JSON config files (`*.json`) in the directory, merges them into one config
+// and applies it on the system, in a single nft transaction.
+// The files are read ordered by name, the entries of each file being merged in that order.
+// Conflicting definitions across the files (e.g. the same chain with different hooks) fail the merge,
+// see the config Merge, in which case nothing is applied.
+// The metainfo entries of the files are not applied.
+// Other files, broken links and sub-directories are ignored, an error is returned if the directory holds no config file.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ApplyDir(netNSPath, dir string, opts ...ApplyOption) error {
+	c, err := ReadDir(netNSPath, dir)
+	if err != nil {
+		return err
+	}
+	return ApplyConfig(c, opts...)
+}
+
+// ReadDir reads the JSON config files (`*.json`) in the directory and merges them into one config,
+// as applied by ApplyDir.
+func ReadDir(netNSPath, dir string) (*Config, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), configFileExt) {
+			continue
+		}
+		// Symbolic links are followed, e.g. for files mounted from a Kubernetes ConfigMap.
+		path := filepath.Join(dir, file.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		found = true
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileConfig := nftconfig.New()
+		if err := fileConfig.FromJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+		}
+		fileConfig.Nftables = withoutMetainfo(fileConfig.Nftables)
+		if err := c.Merge(fileConfig); err != nil {
+			return nil, fmt.Errorf("failed to merge config file %s: %v", path, err)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no config file (%s) found in %s", configFileExt, dir)
+	}
+	return c, nil
+}
+
+func withoutMetainfo(nftables []schema.Nftable) []schema.Nftable {
+	entries := make([]schema.Nftable, 0, len(nftables))
+	for _, nftable := range nftables {
+		if nftable.Metainfo == nil {
+			entries = append(entries, nftable)
+		}
+	}
+	return entries
+}
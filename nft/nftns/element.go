@@ -0,0 +1,204 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// ElementsBatchSize is the maximum number of elements sent to nft in a single invocation
+// by AddElements and DeleteElements.
+// Some nft versions fail on very large transactions, the default is safe for typical kernels.
+var ElementsBatchSize = 1000
+
+type elementOptions struct {
+	autoMerge bool
+}
+
+// ElementOption is an option of AddElements.
+type ElementOption func(*elementOptions)
+
+// WithAutoMerge states the target interval set or map is defined with auto-merge,
+// nft then merging the overlapping elements instead of rejecting them.
+func WithAutoMerge() ElementOption {
+	return func(o *elementOptions) {
+		o.autoMerge = true
+	}
+}
+
+// AddElements adds the given elements to the set or map on the system.
+// The elements are split into batches of ElementsBatchSize, each applied by a separate nft invocation.
+// All batches are attempted, the failures are reported through an AggregateError, a single failure as is.
+// As each batch is a separate transaction, a failure leaves the elements of the other batches applied.
+//
+// Elements including a prefix or a range are added to an interval set, and are sorted by their low value first
+// (see schema.Element.SortIntervals), nft rejecting out of order intervals spread over batches.
+// Overlapping intervals are rejected by nft unless the set is defined with auto-merge (see schema.Set.AutoMerge),
+// they are reported by an error before anything is applied, unless WithAutoMerge is given.
+// Neither the overlaps with the elements already in the set nor the set definition are checked.
+// The given elements are left intact.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func AddElements(netNSPath string, element *schema.Element, opts ...ElementOption) error {
+	var options elementOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if hasIntervals(element.Elem) {
+		sorted := *element
+		sorted.Elem = append([]schema.Expression(nil), element.Elem...)
+		sorted.SortIntervals()
+		if !options.autoMerge {
+			if a, b, overlap := sorted.IntervalOverlap(); overlap {
+				return fmt.Errorf("overlapping elements %s and %s of %s %s %s, the set requires auto-merge",
+					elementString(a), elementString(b), element.Family, element.Table, element.Name)
+			}
+		}
+		element = &sorted
+	}
+
+	return applyElementBatches(netNSPath, element, func(c *Config, batch *schema.Element) {
+		c.AddElements(batch)
+	})
+}
+
+// DeleteElements deletes the given elements from the set or map on the system.
+// The elements are split into batches in the same manner as by AddElements.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func DeleteElements(netNSPath string, element *schema.Element) error {
+	return applyElementBatches(netNSPath, element, func(c *Config, batch *schema.Element) {
+		c.DeleteElements(batch)
+	})
+}
+
+// DeleteElementsMatching deletes the elements of the set on the system which the match function selects,
+// e.g. to expire the elements of a given comment or outside of a prefix.
+// The set is listed and walked as by WalkSetElements, each element given to match as listed:
+// an element with a timeout, expiration or comment is an Elem expression, deleted by its value.
+// The selected elements are then deleted as by DeleteElements, nothing is applied if none is selected.
+// Elements added or deleted between the listing and the deletion are not considered, deleting an element
+// already deleted fails.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func DeleteElementsMatching(netNSPath, family, table, set string, match func(schema.Expression) bool) error {
+	var matching []schema.Expression
+	err := WalkSetElements(netNSPath, family, table, set, func(element schema.Expression) error {
+		if match(element) {
+			if element.Elem != nil {
+				element = element.Elem.Val
+			}
+			matching = append(matching, element)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(matching) == 0 {
+		return nil
+	}
+	return DeleteElements(netNSPath, &schema.Element{Family: family, Table: table, Name: set, Elem: matching})
+}
+
+// FlushSet removes all the elements of the set on the system, in a single transaction.
+// The set itself is kept, flushing an empty set succeeds.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func FlushSet(netNSPath, family, table, set string) error {
+	c, err := New(netNSPath)
+	if err != nil {
+		return err
+	}
+	c.FlushSet(&schema.Set{Family: family, Table: table, Name: set})
+	return ApplyConfig(c)
+}
+
+// FlushMap removes all the elements of the map on the system, in a single transaction.
+// The map itself is kept, flushing an empty map succeeds.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func FlushMap(netNSPath, family, table, m string) error {
+	c, err := New(netNSPath)
+	if err != nil {
+		return err
+	}
+	c.FlushMap(&schema.Map{Family: family, Table: table, Name: m})
+	return ApplyConfig(c)
+}
+
+func applyElementBatches(netNSPath string, element *schema.Element, addBatch func(*Config, *schema.Element)) error {
+	var errs []error
+	for _, batch := range elementBatches(element, ElementsBatchSize) {
+		c, err := New(netNSPath)
+		if err != nil {
+			return err
+		}
+		addBatch(c, batch)
+		if err := ApplyConfig(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &AggregateError{Errors: errs}
+}
+
+// elementBatches splits the elements into chunks of the given size, a non-positive size implies a single chunk.
+func elementBatches(element *schema.Element, size int) []*schema.Element {
+	if size <= 0 || len(element.Elem) <= size {
+		return []*schema.Element{element}
+	}
+
+	var batches []*schema.Element
+	for start := 0; start < len(element.Elem); start += size {
+		end := start + size
+		if end > len(element.Elem) {
+			end = len(element.Elem)
+		}
+		batch := *element
+		batch.Elem = element.Elem[start:end]
+		batches = append(batches, &batch)
+	}
+	return batches
+}
+
+// hasIntervals reports whether the elements include a prefix or a range, possibly with attributes.
+func hasIntervals(elements []schema.Expression) bool {
+	for _, element := range elements {
+		if element.Elem != nil {
+			element = element.Elem.Val
+		}
+		if element.Prefix != nil || element.Range != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func elementString(element schema.Expression) string {
+	data, err := json.Marshal(element)
+	if err != nil {
+		return fmt.Sprintf("%+v", element)
+	}
+	return string(data)
+}
@@ -0,0 +1,168 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft/nftns"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// recordingNSEnter replaces the nsenter binary with a script which records each invocation stdin
+// as a line in the returned log file, failing the invocations which include the given input.
+func recordingNSEnter(t *testing.T, failOn string) string {
+	logPath := filepath.Join(tempDir(t), "stdin.log")
+	fakeNSEnter(t, "input=$(cat)\n"+
+		"echo \"$input\" >> "+logPath+"\n"+
+		"case \"$input\" in *'"+failOn+"'*) echo 'Error: Could not process rule' >&2; exit 1;; esac\n")
+	return logPath
+}
+
+func readInvocations(t *testing.T, logPath string) []string {
+	data, err := ioutil.ReadFile(logPath)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func newElement(values ...string) *schema.Element {
+	element := &schema.Element{Family: schema.FamilyIP, Table: "filter", Name: "blocklist"}
+	for i := range values {
+		element.Elem = append(element.Elem, schema.Expression{String: &values[i]})
+	}
+	return element
+}
+
+func TestElementsBatching(t *testing.T) {
+	batchSize := nftns.ElementsBatchSize
+	nftns.ElementsBatchSize = 2
+	defer func() { nftns.ElementsBatchSize = batchSize }()
+
+	t.Run("Add elements in batches", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "never")
+
+		element := newElement("10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5")
+		assert.NoError(t, nftns.AddElements("/run/netns/test", element))
+
+		elementPrefix := `{"nftables":[{"element":{"family":"ip","table":"filter","name":"blocklist","elem":`
+		assert.Equal(t, []string{
+			elementPrefix + `["10.0.0.1","10.0.0.2"]}}]}`,
+			elementPrefix + `["10.0.0.3","10.0.0.4"]}}]}`,
+			elementPrefix + `["10.0.0.5"]}}]}`,
+		}, readInvocations(t, logPath))
+		assert.Len(t, element.Elem, 5, "the given elements are expected to be left intact")
+	})
+
+	t.Run("Delete elements in batches", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "never")
+
+		assert.NoError(t, nftns.DeleteElements("/run/netns/test", newElement("10.0.0.1", "10.0.0.2", "10.0.0.3")))
+
+		elementPrefix := `{"nftables":[{"delete":{"element":{"family":"ip","table":"filter","name":"blocklist","elem":`
+		assert.Equal(t, []string{
+			elementPrefix + `["10.0.0.1","10.0.0.2"]}}}]}`,
+			elementPrefix + `["10.0.0.3"]}}}]}`,
+		}, readInvocations(t, logPath))
+	})
+
+	t.Run("A failed batch is reported as is and the others are applied", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "10.0.0.1")
+
+		err := nftns.AddElements("/run/netns/test", newElement("10.0.0.1", "10.0.0.2", "10.0.0.3"))
+		assert.Error(t, err)
+
+		nftErr, ok := err.(*nftns.NftError)
+		assert.True(t, ok, "unexpected error type: %T", err)
+		assert.Contains(t, string(nftErr.Stdin), "10.0.0.1")
+		assert.Equal(t, nftns.ExitCodeFailure, nftErr.ExitCode)
+		assert.Len(t, readInvocations(t, logPath), 2)
+	})
+
+	t.Run("Failed batches are aggregated", func(t *testing.T) {
+		recordingNSEnter(t, "blocklist")
+
+		err := nftns.DeleteElements("/run/netns/test", newElement("10.0.0.1", "10.0.0.2", "10.0.0.3"))
+		assert.Error(t, err)
+
+		aggregateErr, ok := err.(*nftns.AggregateError)
+		assert.True(t, ok, "unexpected error type: %T", err)
+		assert.Len(t, aggregateErr.Errors, 2)
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr), "the NftError is expected to be found in the aggregate")
+		assert.Contains(t, string(nftErr.Stdin), "10.0.0.1")
+		assert.False(t, errors.Is(err, nftns.ErrExists))
+	})
+}
+
+func TestAddIntervalElements(t *testing.T) {
+	prefix := func(addr string, length int) schema.Expression {
+		return schema.Expression{Prefix: &schema.Prefix{Addr: addr, Len: length}}
+	}
+	newIntervalElement := func(elements ...schema.Expression) *schema.Element {
+		element := newElement("10.0.0.1")
+		element.Elem = append(element.Elem, elements...)
+		return element
+	}
+	elementPrefix := `{"nftables":[{"element":{"family":"ip","table":"filter","name":"blocklist","elem":`
+
+	t.Run("Add interval elements sorted", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "never")
+
+		element := newIntervalElement(prefix("192.0.2.0", 24), prefix("10.1.0.0", 16))
+		assert.NoError(t, nftns.AddElements("/run/netns/test", element))
+
+		assert.Equal(t, []string{
+			elementPrefix + `["10.0.0.1",{"prefix":{"addr":"10.1.0.0","len":16}},{"prefix":{"addr":"192.0.2.0","len":24}}]}}]}`,
+		}, readInvocations(t, logPath))
+		assert.Equal(t, "192.0.2.0", element.Elem[1].Prefix.Addr, "the given elements are expected to be left intact")
+	})
+
+	t.Run("Overlapping interval elements are rejected without auto-merge", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "never")
+
+		err := nftns.AddElements("/run/netns/test", newIntervalElement(prefix("10.0.0.0", 8)))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `"10.0.0.1"`)
+		assert.Contains(t, err.Error(), `{"prefix":{"addr":"10.0.0.0","len":8}}`)
+		assert.NoFileExists(t, logPath)
+	})
+
+	t.Run("Overlapping interval elements are added with auto-merge", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "never")
+
+		assert.NoError(t, nftns.AddElements("/run/netns/test", newIntervalElement(prefix("10.0.0.0", 8)), nftns.WithAutoMerge()))
+
+		assert.Equal(t, []string{
+			elementPrefix + `[{"prefix":{"addr":"10.0.0.0","len":8}},"10.0.0.1"]}}]}`,
+		}, readInvocations(t, logPath))
+	})
+
+	t.Run("Duplicate elements of plain sets are not checked", func(t *testing.T) {
+		logPath := recordingNSEnter(t, "never")
+
+		assert.NoError(t, nftns.AddElements("/run/netns/test", newElement("10.0.0.2", "10.0.0.1", "10.0.0.2")))
+
+		assert.Equal(t, []string{elementPrefix + `["10.0.0.2","10.0.0.1","10.0.0.2"]}}]}`}, readInvocations(t, logPath))
+	})
+}
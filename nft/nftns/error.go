@@ -0,0 +1,184 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of nft, as passed through by nsenter.
+// The syntax, evaluation and kernel errors (e.g. a missing object) all result in the general failure code,
+// which are told apart by the Diagnostics.
+const (
+	ExitCodeFailure   = 1 // General failure
+	ExitCodeNoMemory  = 2 // Out of memory
+	ExitCodeNoNetlink = 3 // The netlink socket could not be opened, e.g. lacking permissions
+)
+
+// NftError is returned when the execution of the nft command fails.
+type NftError struct {
+	Path   string
+	Args   []string
+	Stdin  []byte
+	Stdout string
+	Stderr string
+	Err    error
+
+	// ExitCode is the exit code of the command, one of the ExitCode* values when reported by nft.
+	// It is -1 if the command did not exit (e.g. it failed to start or was killed).
+	ExitCode int
+
+	// Diagnostics holds the errors reported by nft, parsed from its standard error output.
+	// It is empty when the output is not recognized, in which case Stderr is the only source of details.
+	Diagnostics []Diagnostic
+}
+
+func (e *NftError) Error() string {
+	return fmt.Sprintf(
+		"failed to execute %s %s: %v stdin:'%s' stdout:'%s' stderr:'%s'",
+		e.Path, strings.Join(e.Args, " "), e.Err, string(e.Stdin), e.Stdout, e.Stderr,
+	)
+}
+
+func (e *NftError) Unwrap() error {
+	return e.Err
+}
+
+// exitCode returns the exit code carried by the error (e.g. an *exec.ExitError), -1 if there is none.
+func exitCode(err error) int {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// AggregateError is returned when multiple nft invocations are issued for a single operation,
+// holding the errors of the failed invocations.
+// The errors are matched by errors.Is and errors.As, e.g. to get the NftError of a failed invocation.
+type AggregateError struct {
+	Errors []error
+}
+
+// Is reports whether any of the errors matches the target.
+func (e *AggregateError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors which matches the target, and sets the target to it.
+func (e *AggregateError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *AggregateError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d nft invocation(s) failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// ConflictError is returned when a table on the system changed since it was read,
+// its hash differing from the expected one.
+type ConflictError struct {
+	Family       string
+	Table        string
+	ExpectedHash string
+	ActualHash   string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("table %s %s changed on the system: expected hash %s, found %s",
+		e.Family, e.Table, e.ExpectedHash, e.ActualHash)
+}
+
+// Diagnostic is an error reported by nft, optionally with its location in the input.
+type Diagnostic struct {
+	// Location of the error in the input, set when reported (e.g. `/dev/stdin:1:10-25:`).
+	// Line and columns are 1-based.
+	Input     string
+	Line      int
+	Column    int
+	EndColumn int
+
+	Message string
+
+	// Object is the part of the input the error points to, e.g. the failing JSON object.
+	Object string
+}
+
+var diagnosticRegex = regexp.MustCompile(`^(?:(.+):(\d+):(\d+)(?:-(\d+))?: )?Error: (.*)$`)
+var markerRegex = regexp.MustCompile(`^\s*[\^~]+\s*$`)
+
+// ParseDiagnostics parses the errors reported by nft on its standard error output.
+// Each error is reported by nft on a line starting with the location and the `Error:` tag,
+// optionally followed by the offending input line and a marker line (`^^^~~~`) pointing to
+// the failing part of it.
+func ParseDiagnostics(stderr string) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	lines := strings.Split(stderr, "\n")
+	for i, line := range lines {
+		match := diagnosticRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		d := Diagnostic{Input: match[1], Message: match[5]}
+		d.Line, _ = strconv.Atoi(match[2])
+		d.Column, _ = strconv.Atoi(match[3])
+		d.EndColumn, _ = strconv.Atoi(match[4])
+		if d.EndColumn == 0 {
+			d.EndColumn = d.Column
+		}
+
+		if i+2 < len(lines) && markerRegex.MatchString(lines[i+2]) {
+			d.Object = markedText(lines[i+1], lines[i+2])
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	return diagnostics
+}
+
+// markedText returns the part of the line which is pointed by the marker.
+func markedText(line, marker string) string {
+	start := strings.IndexAny(marker, "^~")
+	end := strings.LastIndexAny(marker, "^~") + 1
+	if start >= len(line) {
+		return ""
+	}
+	if end > len(line) {
+		end = len(line)
+	}
+	return line[start:end]
+}
@@ -0,0 +1,111 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns_test
+
+import (
+	"errors"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft/nftns"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	t.Run("Parse an error with location and marker", func(t *testing.T) {
+		stderr := "/dev/stdin:1:1-31: Error: Could not process rule: No such file or directory\n" +
+			`{"nftables":[{"table":{"family":"ip","name":"t"}},{"chain":{"family":"ip","table":"x","name":"c"}}]}` + "\n" +
+			"                                                  ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^\n"
+
+		assert.Equal(t, []nftns.Diagnostic{{
+			Input:     "/dev/stdin",
+			Line:      1,
+			Column:    1,
+			EndColumn: 31,
+			Message:   "Could not process rule: No such file or directory",
+			Object:    `{"chain":{"family":"ip","table":"x","name":"c"}}]}`,
+		}}, nftns.ParseDiagnostics(stderr))
+	})
+
+	t.Run("Parse multiple errors without a marker", func(t *testing.T) {
+		stderr := "/dev/stdin:2:5: Error: syntax error, unexpected junk\n" +
+			"Error: Could not process rule: Operation not permitted\n"
+
+		assert.Equal(t, []nftns.Diagnostic{
+			{Input: "/dev/stdin", Line: 2, Column: 5, EndColumn: 5, Message: "syntax error, unexpected junk"},
+			{Message: "Could not process rule: Operation not permitted"},
+		}, nftns.ParseDiagnostics(stderr))
+	})
+
+	t.Run("Parse an unrecognized output", func(t *testing.T) {
+		assert.Empty(t, nftns.ParseDiagnostics("nft: invalid option -- 'j'\n"))
+	})
+}
+
+func TestNftError(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	err := error(&nftns.NftError{
+		Path:   "/usr/bin/nsenter",
+		Args:   []string{"nsenter", "--net=/run/netns/test", "--", "nft", "-j", "-f", "-"},
+		Stdin:  []byte(`{"nftables":[]}`),
+		Stderr: "Error: failure",
+		Err:    exitErr,
+	})
+
+	assert.Equal(t,
+		`failed to execute /usr/bin/nsenter nsenter --net=/run/netns/test -- nft -j -f -: `+
+			`exit status 1 stdin:'{"nftables":[]}' stdout:'' stderr:'Error: failure'`,
+		err.Error(),
+	)
+
+	var nftErr *nftns.NftError
+	assert.True(t, errors.As(err, &nftErr))
+	assert.True(t, errors.Is(err, exitErr))
+}
+
+func TestNftErrorExitCode(t *testing.T) {
+	t.Run("Exit code of a failed nft execution", func(t *testing.T) {
+		fakeNSEnter(t, "echo 'Error: Could not open netlink socket' >&2; exit 3")
+
+		_, err := nftns.ReadConfig("/run/netns/test")
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+		assert.Equal(t, nftns.ExitCodeNoNetlink, nftErr.ExitCode)
+	})
+
+	t.Run("Exit code of an nft execution which failed to start", func(t *testing.T) {
+		fakeNSEnter(t, "")
+		nftns.NSEnterBinPath = tempDir(t) + "/missing"
+
+		_, err := nftns.ReadConfig("/run/netns/test")
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+		assert.Equal(t, -1, nftErr.ExitCode)
+	})
+}
+
+func TestAggregateError(t *testing.T) {
+	nftErr := &nftns.NftError{Path: "nsenter", Err: errors.New("exit status 1"), ExitCode: nftns.ExitCodeFailure}
+	err := error(&nftns.AggregateError{Errors: []error{errors.New("other failure"), nftErr, nftns.ErrExists}})
+
+	var found *nftns.NftError
+	assert.True(t, errors.As(err, &found))
+	assert.Equal(t, nftErr, found)
+	assert.True(t, errors.Is(err, nftns.ErrExists))
+	assert.False(t, errors.Is(err, nftns.ErrJSONUnsupported))
+}
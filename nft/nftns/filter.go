@@ -0,0 +1,86 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"fmt"
+	"path"
+)
+
+// TableFilter selects tables by family and name.
+// An empty family matches the tables of all families.
+// The name is a glob pattern, in the syntax of path.Match (e.g. `kube-*`), an empty name matching all names.
+type TableFilter struct {
+	Family string
+	Name   string
+}
+
+// Match reports whether the table is selected by the filter.
+// An error is returned for a malformed name pattern.
+func (f TableFilter) Match(table TableRef) (bool, error) {
+	if f.Family != "" && f.Family != table.Family {
+		return false, nil
+	}
+	if f.Name == "" {
+		return true, nil
+	}
+	match, err := path.Match(f.Name, table.Name)
+	if err != nil {
+		return false, fmt.Errorf("invalid table name pattern %q: %v", f.Name, err)
+	}
+	return match, nil
+}
+
+// ReadConfigFiltered loads the tables selected by the filter from the system, and the objects they hold.
+// The tables are listed first, then each selected table is read by a separate nft invocation (see ReadTable),
+// sparing the listing of unrelated tables on hosts with many of them.
+// As the tables are not read in a single transaction, concurrent changes may be seen for some tables only.
+// The config holds the metainfo of the first read table, it is empty if no table is selected.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadConfigFiltered(netNSPath string, filter TableFilter) (*Config, error) {
+	tables, err := ListTables(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := New(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		match, err := filter.Match(table)
+		if err != nil {
+			return nil, err
+		}
+		if !match {
+			continue
+		}
+
+		tableConfig, err := ReadTable(netNSPath, table.Family, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, nftable := range tableConfig.Nftables {
+			if nftable.Metainfo != nil && config.Metainfo() != nil {
+				continue
+			}
+			config.Nftables = append(config.Nftables, nftable)
+		}
+	}
+	return config, nil
+}
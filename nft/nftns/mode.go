@@ -0,0 +1,85 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// ApplyMode tells how ApplyConfig treats the ruleset present on the system.
+type ApplyMode int
+
+const (
+	// ModeMerge applies the config entries as given, on top of the ruleset present on the system.
+	// Pre-existing tables, chains, rules, sets and objects are kept: adding an existing table or chain
+	// leaves its content as is, while rules are appended to the ones already present.
+	// Only the entries of the config itself (e.g. a `flush` or a `delete`) remove pre-existing content.
+	ModeMerge ApplyMode = iota
+	// ModeReplace replaces the tables declared by the config: each of them is deleted, with all its chains,
+	// rules, sets and objects, and defined again with the config entries, in the same nft transaction.
+	// Tables not declared by the config are left as is, also when the config holds chains or rules of them.
+	ModeReplace
+)
+
+// DefaultApplyMode is the mode ApplyConfig uses when none is given by WithMode.
+var DefaultApplyMode = ModeMerge
+
+// WithMode applies the config in the given mode, instead of the DefaultApplyMode.
+func WithMode(mode ApplyMode) ApplyOption {
+	return func(o *applyOptions) {
+		o.mode = mode
+	}
+}
+
+// withReplacedTables returns a copy of the config, preceded by the deletion of the tables it declares.
+// The tables are added before being deleted, avoiding the deletion of missing tables.
+func (c *Config) withReplacedTables() *Config {
+	replaced := *c
+	replaced.Nftables = nil
+
+	declared := map[schema.Table]bool{}
+	for _, nftable := range c.Nftables {
+		table := declaredTable(nftable)
+		if table == nil {
+			continue
+		}
+		key := schema.Table{Family: table.Family, Name: table.Name}
+		if declared[key] {
+			continue
+		}
+		declared[key] = true
+		replaced.AddTable(&schema.Table{Family: table.Family, Name: table.Name})
+		replaced.DeleteTable(&schema.Table{Family: table.Family, Name: table.Name})
+	}
+
+	replaced.Nftables = append(replaced.Nftables, c.Nftables...)
+	return &replaced
+}
+
+// declaredTable returns the table declared by the entry, without an explicit action, with `add` or `create`.
+func declaredTable(nftable schema.Nftable) *schema.Table {
+	switch {
+	case nftable.Table != nil:
+		return nftable.Table
+	case nftable.Add != nil && nftable.Add.Table != nil:
+		return nftable.Add.Table
+	case nftable.Create != nil && nftable.Create.Table != nil:
+		return nftable.Create.Table
+	}
+	return nil
+}
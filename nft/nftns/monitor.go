@@ -0,0 +1,175 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+const (
+	cmdMonitor = "monitor"
+	cmdTrace   = "trace"
+)
+
+// Trace Event Types
+const (
+	TraceTypeRule   = "rule"   // A rule matched, the event identifies the rule.
+	TraceTypePolicy = "policy" // The packet reached the end of a base chain and the chain policy applied.
+	TraceTypeReturn = "return" // The packet reached the end of a regular chain and returned to the calling chain.
+	TraceTypePacket = "packet" // The packet metadata, as seen by the first traced chain.
+)
+
+// traceMaxLineSize is the maximum size of a single trace event line emitted by nft.
+const traceMaxLineSize = 1024 * 1024
+
+// TraceEvent is a packet trace event, emitted for packets marked with `meta nftrace set 1`.
+// All events of the same packet share the same ID.
+// The fields not modeled by the event are available through the raw event data.
+type TraceEvent struct {
+	ID     int    `json:"id"`
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Chain  string `json:"chain"`
+	Type   string `json:"type"`
+
+	// Rule is the matching rule, set for rule events. It includes the rule handle.
+	Rule *schema.Rule `json:"rule,omitempty"`
+	// Verdict is the verdict applied by the rule or the chain policy, e.g. `{"accept":null}`.
+	Verdict *schema.Statement `json:"verdict,omitempty"`
+	// Policy is the chain policy, set for policy events.
+	Policy string `json:"policy,omitempty"`
+
+	// Packet metadata.
+	Iif  string `json:"iif,omitempty"`
+	Oif  string `json:"oif,omitempty"`
+	Mark *int   `json:"mark,omitempty"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// MonitorTrace runs `nft monitor trace` on the system and streams the decoded trace events.
+// Packets are traced once marked with `meta nftrace set 1` by a rule.
+// Monitoring stops when the context is done, at which point both channels are closed.
+// A failure of the nft command or the decoding of an event is sent on the error channel,
+// after which monitoring stops.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func MonitorTrace(ctx context.Context, netNSPath string) (<-chan TraceEvent, <-chan error) {
+	events := make(chan TraceEvent)
+	errs := make(chan error, 1)
+
+	c, err := New(netNSPath)
+	if err != nil {
+		errs <- err
+		close(events)
+		close(errs)
+		return events, errs
+	}
+
+	go func() {
+		defer close(events)
+		defer close(errs)
+		if err := c.monitorTrace(ctx, events); err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+func (c *Config) monitorTrace(ctx context.Context, events chan<- TraceEvent) error {
+	command := c.plannedCommand(nil, cmdJSON, cmdMonitor, cmdTrace)
+	Logger.Trace().Msgf("Running nft command: %v %v", command.Path, command.Args)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr := newLimitedBuffer(MaxStderrSize)
+	runErr := make(chan error, 1)
+	go func() {
+		err := CommandRunner.Run(ctx, command.Path, command.Args, nil, stdoutWriter, stderr)
+		stdoutWriter.Close()
+		runErr <- err
+	}()
+
+	var decodeErr error
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, traceMaxLineSize)
+	for decodeErr == nil && scanner.Scan() {
+		var event TraceEvent
+		var isTrace bool
+		isTrace, decodeErr = decodeTraceEvent(scanner.Bytes(), &event)
+		if !isTrace || decodeErr != nil {
+			continue
+		}
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	if decodeErr == nil {
+		decodeErr = scanner.Err()
+	}
+	if decodeErr != nil {
+		cancel()
+	}
+	// Drain the output, so the command is not blocked on writing it until it terminates.
+	_, _ = io.Copy(ioutil.Discard, stdout)
+
+	if err := <-runErr; err != nil && decodeErr == nil {
+		return &NftError{
+			Path:        command.Path,
+			Args:        append([]string{command.Path}, command.Args...),
+			Stderr:      stderr.String(),
+			Err:         err,
+			ExitCode:    exitCode(err),
+			Diagnostics: ParseDiagnostics(stderr.String()),
+		}
+	}
+	return decodeErr
+}
+
+// decodeTraceEvent decodes a line of the monitor output, reporting whether it holds a trace event.
+func decodeTraceEvent(line []byte, event *TraceEvent) (bool, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return false, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(line, &object); err != nil {
+		return false, fmt.Errorf("failed to decode trace event: %v: %s", err, line)
+	}
+	data, isTrace := object[cmdTrace]
+	if !isTrace {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, event); err != nil {
+		return false, fmt.Errorf("failed to decode trace event: %v: %s", err, line)
+	}
+	event.Raw = data
+	return true, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft/nftns"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func TestMonitorTrace(t *testing.T) {
+	t.Run("Stream trace events", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"trace":{"id":7,"family":"ip","table":"filter","chain":"input","type":"packet","iif":"eth0"}}'
+echo '{"trace":{"id":7,"family":"ip","table":"filter","chain":"input","type":"rule",`+
+			`"rule":{"family":"ip","table":"filter","chain":"input","handle":4,"expr":[{"accept":null}]},"verdict":{"accept":null}}}'
+exec sleep 10
+`)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		events, errs := nftns.MonitorTrace(ctx, "/run/netns/test")
+
+		packetEvent := receiveTraceEvent(t, events)
+		assert.Equal(t, 7, packetEvent.ID)
+		assert.Equal(t, nftns.TraceTypePacket, packetEvent.Type)
+		assert.Equal(t, "eth0", packetEvent.Iif)
+
+		ruleEvent := receiveTraceEvent(t, events)
+		assert.Equal(t, nftns.TraceTypeRule, ruleEvent.Type)
+		assert.NotNil(t, ruleEvent.Rule)
+		assert.Equal(t, 4, *ruleEvent.Rule.Handle)
+		assert.Equal(t, schema.Accept(), ruleEvent.Verdict.Verdict)
+
+		cancel()
+		_, open := <-events
+		assert.False(t, open)
+		assert.NoError(t, <-errs, "a cancellation is not expected to be reported as an error")
+	})
+
+	t.Run("Report nft failure", func(t *testing.T) {
+		fakeNSEnter(t, "echo 'Error: Operation not permitted' >&2; exit 1")
+
+		events, errs := nftns.MonitorTrace(context.Background(), "/run/netns/test")
+
+		_, open := <-events
+		assert.False(t, open)
+		err := <-errs
+		assert.Error(t, err)
+		assert.IsType(t, &nftns.NftError{}, err)
+	})
+
+	t.Run("Report an event decoding failure", func(t *testing.T) {
+		fakeNSEnter(t, "echo '{\"trace\":{\"id\":\"x\"}}'; exec sleep 10")
+
+		events, errs := nftns.MonitorTrace(context.Background(), "/run/netns/test")
+
+		_, open := <-events
+		assert.False(t, open)
+		assert.Error(t, <-errs)
+	})
+}
+
+func receiveTraceEvent(t *testing.T, events <-chan nftns.TraceEvent) nftns.TraceEvent {
+	select {
+	case event, open := <-events:
+		assert.True(t, open, "events channel closed unexpectedly")
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a trace event")
+	}
+	return nftns.TraceEvent{}
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// NetNSCommand is the command which executes nft in the network namespace.
+type NetNSCommand int
+
+const (
+	// NetNSCommandNSEnter executes nft by nsenter (`nsenter --net=<path> -- nft ...`),
+	// entering the namespace of any path, with the nsenter options of the config.
+	NetNSCommandNSEnter NetNSCommand = iota
+	// NetNSCommandIPNetNSExec executes nft by iproute2 (`ip netns exec <name> nft ...`),
+	// which references the namespaces by name, as bind-mounted in /run/netns (e.g. by `ip netns add`):
+	// a network namespace path in that directory is given by its name, other paths as is,
+	// which ip fails to enter. The nsenter options of the config (e.g. PreserveCredentials) do not apply.
+	NetNSCommandIPNetNSExec
+)
+
+// netNSRunDir is the directory of the named network namespaces of iproute2.
+const netNSRunDir = "/run/netns"
+
+// netNSCommand is the command used to execute nft in the network namespaces, nsenter by default.
+// It is changed by SetNetNSCommand, which checks the command is available.
+var netNSCommand = NetNSCommandNSEnter
+
+// IPBinPath is the ip executable, used by the NetNSCommandIPNetNSExec command.
+var IPBinPath = "ip"
+
+// SetNetNSCommand sets the command used to execute nft in the network namespaces, after checking
+// its executable (NSEnterBinPath or IPBinPath) is found in the PATH, or exists when given with a path.
+// The executable is checked for the local CommandRunner only, a remote runner being expected
+// to provide it (set the remote runner before this call).
+func SetNetNSCommand(command NetNSCommand) error {
+	path, err := command.binPath()
+	if err != nil {
+		return err
+	}
+	if _, isLocal := CommandRunner.(localRunner); isLocal {
+		if _, err := exec.LookPath(path); err != nil {
+			return fmt.Errorf("network namespace command %s not available: %w", path, err)
+		}
+	}
+	netNSCommand = command
+	return nil
+}
+
+func (c NetNSCommand) binPath() (string, error) {
+	switch c {
+	case NetNSCommandNSEnter:
+		return NSEnterBinPath, nil
+	case NetNSCommandIPNetNSExec:
+		return IPBinPath, nil
+	}
+	return "", fmt.Errorf("unknown network namespace command %d", c)
+}
+
+// ipNetNSExecArgs returns the ip arguments which precede the nft command.
+func (c *Config) ipNetNSExecArgs() []string {
+	name := c.NetNSPath
+	if filepath.Dir(name) == netNSRunDir {
+		name = filepath.Base(name)
+	}
+	return []string{"netns", "exec", name, NFTBinPath}
+}
@@ -19,8 +19,13 @@ package nftns
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os/exec"
+	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 
 	nftconfig "github.com/networkplumbing/go-nft/nft/config"
@@ -30,13 +35,27 @@ import (
 )
 
 const (
-	cmdFile    = "-f"
-	cmdJSON    = "-j"
-	cmdList    = "list"
-	cmdRuleset = "ruleset"
-	cmdStdin   = "-"
+	cmdFile     = "-f"
+	cmdJSON     = "-j"
+	cmdHandle   = "-a"
+	cmdNumeric  = "-nn"
+	cmdEcho     = "-e"
+	cmdCheck    = "-c"
+	cmdList     = "list"
+	cmdRuleset  = "ruleset"
+	cmdChain    = "chain"
+	cmdTable    = "table"
+	cmdSet      = "set"
+	cmdSets     = "sets"
+	cmdTables   = "tables"
+	cmdReset    = "reset"
+	cmdCounters = "counters"
+	cmdStdin    = "-"
 )
 
+// NSEnterBinPath and NFTBinPath are the executables of the commands passed to the CommandRunner.
+// Names without a path are resolved by the runner, the local runner looking them up in the PATH when run.
+// See SetNetNSCommand for executing nft by ip instead of nsenter.
 var (
 	NSEnterBinPath = "nsenter"
 	NFTBinPath     = "nft"
@@ -44,15 +63,133 @@ var (
 
 var Logger zerolog.Logger
 
+// ErrJSONUnsupported is returned (wrapped) when nft is present but does not support JSON,
+// either being too old to recognize the `-j` option or being built without JSON support.
+var ErrJSONUnsupported = errors.New("nft JSON support is not available")
+
+// ErrExists is returned (wrapped) when nft fails to create an object which already exists,
+// e.g. a table created with the `create` action.
+var ErrExists = errors.New("nft object already exists")
+
+// existsMessage is the nft error message which indicates the existence of an object.
+const existsMessage = "File exists"
+
+// jsonUnsupportedMessages are the nft error messages which indicate the lack of JSON support.
+var jsonUnsupportedMessages = []string{
+	"JSON support not compiled-in",
+	"invalid option",
+	"unrecognized option",
+}
+
 func init() {
 	Logger = log.Logger
-	NSEnterBinPath, _ = exec.LookPath("nsenter")
-	NFTBinPath, _ = exec.LookPath("nft")
 }
 
 type Config struct {
 	nftconfig.Config
 	NetNSPath string `json:"-"`
+
+	// nsenter options, used when the config is applied.
+	// PreserveCredentials keeps the current UID and GID when entering the network namespace (`--preserve-credentials`).
+	// NoFork executes nft without forking first (`--no-fork`).
+	PreserveCredentials bool `json:"-"`
+	NoFork              bool `json:"-"`
+
+	// RawJSON holds the exact nft output the config was read from, when read with WithRawJSON.
+	RawJSON []byte `json:"-"`
+
+	// Warnings holds the messages nft reported on its standard error output while succeeding
+	// (e.g. on deprecated syntax), on the last apply of the config or the read it results from.
+	// Each message is logged at the warning level as well.
+	// On failure, the standard error output is reported by the returned NftError instead.
+	Warnings []string `json:"-"`
+
+	// OnExec, when set, is called after each nft command executed to apply the config (by ApplyConfig,
+	// ApplyConfigEcho and the functions using them, including the revert of ApplyConfigWithConfirm),
+	// e.g. to keep an audit log of the changes.
+	// It is given the command line (the nsenter path first, as the NftError Args), the standard input
+	// holding the applied JSON when any, and the command error, nil on success.
+	// The commands of the package functions which create their own config (e.g. ReadConfig, AddElements)
+	// are not reported. It is called synchronously, delaying the following commands.
+	OnExec func(args []string, stdin []byte, err error) `json:"-"`
+}
+
+type readOptions struct {
+	rawJSON bool
+	handles bool
+	numeric bool
+}
+
+// args returns the nft list flags of the options.
+func (o readOptions) args() []string {
+	var args []string
+	if o.handles {
+		args = append(args, cmdHandle)
+	}
+	if o.numeric {
+		args = append(args, cmdNumeric)
+	}
+	return args
+}
+
+// ReadOption is an option of ReadConfig.
+type ReadOption func(*readOptions)
+
+// WithRawJSON retains the raw nft output in the RawJSON field of the returned config.
+// It is not retained by default, avoiding the memory cost.
+func WithRawJSON() ReadOption {
+	return func(o *readOptions) {
+		o.rawJSON = true
+	}
+}
+
+// WithHandles lists the objects with their handles (`-a`).
+func WithHandles() ReadOption {
+	return func(o *readOptions) {
+		o.handles = true
+	}
+}
+
+// WithNumeric lists the ruleset fully numeric (`-nn`), without resolving names of
+// services, protocols and more from the local databases (e.g. `/etc/services`).
+// The listed config is then independent of the host it is read from.
+func WithNumeric() ReadOption {
+	return func(o *readOptions) {
+		o.numeric = true
+	}
+}
+
+type applyOptions struct {
+	mode         ApplyMode
+	counters     bool
+	changeID     string
+	expectedHash map[schema.Table]string
+}
+
+// ApplyOption is an option of ApplyConfig.
+type ApplyOption func(*applyOptions)
+
+// WithChangeID stamps the applied config with the given change identifier,
+// in the same transaction as the config itself.
+// The identifier currently applied on the system is returned by ReadChangeID.
+func WithChangeID(id string) ApplyOption {
+	return func(o *applyOptions) {
+		o.changeID = id
+	}
+}
+
+// WithExpectedTableHash fails the apply with a ConflictError if the hash of the given table on the system,
+// as returned by ReadTableHash, differs from the expected hash.
+// It allows a read-modify-write of a table to detect changes applied concurrently by others.
+// The table is checked right before the apply, nft does not support conditional transactions
+// and a change applied between the check and the apply is not detected.
+func WithExpectedTableHash(table *schema.Table, hash string) ApplyOption {
+	return func(o *applyOptions) {
+		if o.expectedHash == nil {
+			o.expectedHash = map[schema.Table]string{}
+		}
+		o.expectedHash[schema.Table{Family: table.Family, Name: table.Name}] = hash
+	}
 }
 
 // New returns a new nftables config structure.
@@ -61,80 +198,830 @@ func New(netNSPath string) (*Config, error) {
 		NetNSPath: netNSPath,
 	}
 
-	// hmm.  concurrency issues?
-	if NSEnterBinPath == "" {
-		path, err := exec.LookPath("nsenter")
-		if err != nil {
-			return nil, err
-		}
-		NSEnterBinPath = path
-	}
-
 	c.Nftables = []schema.Nftable{}
 	return c, nil
 }
 
+// NewFromFile returns a new nftables config structure, for the network namespace referenced by the open file
+// (e.g. an fd of `/proc/<pid>/ns/net`), allowing to use anonymous namespaces without a bind-mounted path.
+// The namespace is entered through the path of the file descriptor, given by FileNetNSPath.
+// The file must be kept open, by the caller, as long as the config is applied or read:
+// the descriptor is not duplicated and a closed (or reused) descriptor references no (or another) namespace.
+func NewFromFile(f *os.File) (*Config, error) {
+	return New(FileNetNSPath(f))
+}
+
+// FileNetNSPath returns the path of the open file descriptor of a network namespace (`/proc/<pid>/fd/<fd>`),
+// to be given as the network namespace path of the package functions.
+// The path refers to the descriptor of the current process, it is valid only as long as the file is open,
+// and only for commands executed on the local host (not through a remote CommandRunner).
+func FileNetNSPath(f *os.File) string {
+	return fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), f.Fd())
+}
+
 // ReadConfig loads the nftables configuration from the system and
 // returns it as a nftables config structure.
+// An empty ruleset (e.g. of a fresh network namespace) is read as an empty config, see the config IsEmpty.
+// The ruleset is decoded as streamed from nft, without capturing the listing (unless read WithRawJSON),
+// hence regardless of MaxStdoutSize.
 // The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
-func ReadConfig(netNSPath string) (*Config, error) {
-	stdout, err := execCommand(netNSPath, nil, cmdJSON, cmdList, cmdRuleset)
+func ReadConfig(netNSPath string, opts ...ReadOption) (*Config, error) {
+	var options readOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	config, err := New(netNSPath)
 	if err != nil {
 		return nil, err
 	}
 
+	args := append(append([]string{cmdJSON}, options.args()...), cmdList, cmdRuleset)
+	var raw bytes.Buffer
+	warnings, err := streamCommand(config.plannedCommand(nil, args...), func(stdout io.Reader) error {
+		if options.rawJSON {
+			stdout = io.TeeReader(stdout, &raw)
+			defer func() { _, _ = io.Copy(ioutil.Discard, stdout) }()
+		}
+		err := decodeNftables(json.NewDecoder(stdout), func(nftable schema.Nftable) {
+			config.Nftables = append(config.Nftables, nftable)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list ruleset: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	config.Warnings = warnings
+	if options.rawJSON {
+		config.RawJSON = raw.Bytes()
+	}
+
+	return config, nil
+}
+
+// ReadTable loads a single table, and the objects it holds, from the system.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadTable(netNSPath, family, table string) (*Config, error) {
 	config, err := New(netNSPath)
 	if err != nil {
 		return nil, err
 	}
+
+	stdout, err := config.execCommand(nil, cmdJSON, cmdList, cmdTable, family, table)
+	if err != nil {
+		return nil, err
+	}
 	if err = config.FromJSON(stdout.Bytes()); err != nil {
-		return nil, fmt.Errorf("failed to list ruleset: %v", err)
+		return nil, fmt.Errorf("failed to list table: %v", err)
 	}
 
 	return config, nil
 }
 
-// ApplyConfig applies the given nftables config on the system.
+// ReadSets loads the sets from the system, of all tables.
+// nft lists the sets without their elements, these are loaded per set by ReadSet.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadSets(netNSPath string) ([]schema.Set, error) {
+	config, err := New(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := config.execCommand(nil, cmdJSON, cmdList, cmdSets)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.FromJSON(stdout.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to list sets: %v", err)
+	}
+
+	var sets []schema.Set
+	for _, nftable := range config.Nftables {
+		if nftable.Set != nil {
+			sets = append(sets, *nftable.Set)
+		}
+	}
+	return sets, nil
+}
+
+// ReadSet loads a single set from the system, including its elements.
+// Elements with a timeout, expiration or comment are loaded as Elem expressions.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadSet(netNSPath, family, table, set string) (*schema.Set, error) {
+	config, err := New(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := config.execCommand(nil, cmdJSON, cmdList, cmdSet, family, table, set)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.FromJSON(stdout.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to list set: %v", err)
+	}
+
+	for _, nftable := range config.Nftables {
+		if s := nftable.Set; s != nil && s.Family == family && s.Table == table && s.Name == set {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to list set: set %s %s %s not found in output", family, table, set)
+}
+
+// TableRef identifies a table, by its family and name.
+type TableRef struct {
+	Family string
+	Name   string
+}
+
+// ListTables returns the tables on the system, without their content.
+// It is cheaper than reading the whole ruleset, the tables may be read in detail by ReadTable.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ListTables(netNSPath string) ([]TableRef, error) {
+	config, err := readTables(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []TableRef
+	for _, nftable := range config.Nftables {
+		if t := nftable.Table; t != nil {
+			tables = append(tables, TableRef{Family: t.Family, Name: t.Name})
+		}
+	}
+	return tables, nil
+}
+
+// readTables loads the tables from the system, without their content.
+func readTables(netNSPath string) (*Config, error) {
+	config, err := New(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := config.execCommand(nil, cmdJSON, cmdList, cmdTables)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.FromJSON(stdout.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %v", err)
+	}
+	return config, nil
+}
+
+// ReadTableHash returns the hash of the content of a table on the system, as a state token of the table.
+// The hash does not depend on handles and counter values, see the config Hash for details.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadTableHash(netNSPath, family, table string) (string, error) {
+	config, err := ReadTable(netNSPath, family, table)
+	if err != nil {
+		return "", err
+	}
+	return config.Hash()
+}
+
+// CheckJSONSupport checks that nft supports JSON, by listing the tables in JSON format.
+// An error wrapping ErrJSONUnsupported is returned when nft is present but does not support JSON,
+// allowing callers to fall back to the native nft syntax.
+// Other failures (e.g. a missing nft executable) are returned as is.
+func CheckJSONSupport(netNSPath string) error {
+	c, err := New(netNSPath)
+	if err != nil {
+		return err
+	}
+
+	stdout, err := c.execCommand(nil, cmdJSON, cmdList, cmdTables)
+	if err != nil {
+		var nftErr *NftError
+		if errors.As(err, &nftErr) {
+			for _, message := range jsonUnsupportedMessages {
+				if strings.Contains(nftErr.Stderr, message) {
+					return fmt.Errorf("%w: %s", ErrJSONUnsupported, strings.TrimSpace(nftErr.Stderr))
+				}
+			}
+		}
+		return err
+	}
+
+	if !json.Valid(stdout.Bytes()) {
+		return fmt.Errorf("%w: output is not JSON: %s", ErrJSONUnsupported, stdout.String())
+	}
+	return nil
+}
+
+// ReadChain loads a single chain and its rules from the system.
+// The rules are returned with their handles, allowing them to be referenced by later operations.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReadChain(netNSPath, family, table, chain string) (*schema.Chain, []schema.Rule, error) {
+	config, err := New(netNSPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stdout, err := config.execCommand(nil, cmdJSON, cmdHandle, cmdList, cmdChain, family, table, chain)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = config.FromJSON(stdout.Bytes()); err != nil {
+		return nil, nil, fmt.Errorf("failed to list chain: %v", err)
+	}
+
+	var c *schema.Chain
+	var rules []schema.Rule
+	for _, nftable := range config.Nftables {
+		switch {
+		case nftable.Chain != nil:
+			c = nftable.Chain
+		case nftable.Rule != nil:
+			rules = append(rules, *nftable.Rule)
+		}
+	}
+	if c == nil {
+		return nil, nil, fmt.Errorf("failed to list chain: chain %s %s %s not found in output", family, table, chain)
+	}
+
+	return c, rules, nil
+}
+
+// DeleteRuleMatching deletes the rule of the given chain on the system which is equal to the given rule,
+// not considering the rule handle, index and counter values (which change over time).
+// The rule is looked up in the chain as loaded from the system, and deleted by its current handle.
+// An error is returned if no rule or more than one rule match.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func DeleteRuleMatching(netNSPath, family, table, chain string, r schema.Rule) error {
+	_, rules, err := ReadChain(netNSPath, family, table, chain)
+	if err != nil {
+		return err
+	}
+
+	matches := matchingRules(family, table, chain, rules, r)
+	switch {
+	case len(matches) == 0:
+		return fmt.Errorf("failed to delete rule: no matching rule found in chain %s %s %s", family, table, chain)
+	case len(matches) > 1:
+		var handles []string
+		for _, match := range matches {
+			handles = append(handles, ruleHandle(match))
+		}
+		return fmt.Errorf("failed to delete rule: %d matching rules found in chain %s %s %s (handles %s)",
+			len(matches), family, table, chain, strings.Join(handles, ", "))
+	case matches[0].Handle == nil:
+		return fmt.Errorf("failed to delete rule: matching rule in chain %s %s %s has no handle", family, table, chain)
+	}
+
+	deleteConfig, err := New(netNSPath)
+	if err != nil {
+		return err
+	}
+	deleteConfig.DeleteRule(&schema.Rule{Family: family, Table: table, Chain: chain, Handle: matches[0].Handle})
+	return ApplyConfig(deleteConfig)
+}
+
+// matchingRules returns the rules of the chain which are equal to the given rule,
+// not considering the rule handle, index and counter values.
+func matchingRules(family, table, chain string, rules []schema.Rule, r schema.Rule) []*schema.Rule {
+	config := nftconfig.New()
+	for i := range rules {
+		config.AddRule(withoutCounterValues(rules[i]))
+	}
+
+	toFind := withoutCounterValues(r)
+	toFind.Family, toFind.Table, toFind.Chain = family, table, chain
+	toFind.Handle, toFind.Index = nil, nil
+	var matches []*schema.Rule
+	for _, match := range config.LookupRule(toFind) {
+		if match.Comment == toFind.Comment {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// withoutCounterValues returns a copy of the rule with its counters reset.
+func withoutCounterValues(r schema.Rule) *schema.Rule {
+	statements := make([]schema.Statement, 0, len(r.Expr))
+	for _, statement := range r.Expr {
+		if statement.Counter != nil {
+			statement.Counter = &schema.Counter{}
+		}
+		statements = append(statements, statement)
+	}
+	r.Expr = statements
+	return &r
+}
+
+func ruleHandle(r *schema.Rule) string {
+	if r.Handle == nil {
+		return "none"
+	}
+	return fmt.Sprint(*r.Handle)
+}
+
+// CounterByComment loads the ruleset from the system and returns the inline counters
+// of the commented rules, keyed by the rule comment.
+// Rules without a comment or a counter are skipped.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func CounterByComment(netNSPath string) (map[string]schema.Counter, error) {
+	config, err := ReadConfig(netNSPath)
+	if err != nil {
+		return nil, err
+	}
+	return config.CounterByComment(), nil
+}
+
+// DriftDetected loads the ruleset from the system, in the network namespace of the desired config,
+// and compares it with the desired config.
+// It reports whether they differ, along with the differences, where the added entries are the
+// ones missing on the system and the removed ones are present on the system only.
+// The comparison does not consider handles and counter values, see the config Diff for details.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func DriftDetected(desired *Config) (bool, *nftconfig.ConfigDiff, error) {
+	live, err := ReadConfig(desired.NetNSPath)
+	if err != nil {
+		return false, nil, err
+	}
+
+	diff, err := live.Diff(&desired.Config)
+	if err != nil {
+		return false, nil, err
+	}
+	return !diff.IsEmpty(), diff, nil
+}
+
+// PlannedCommand is a command which is executed to apply a config.
+// The arguments do not include the path of the executable.
+type PlannedCommand struct {
+	Path  string
+	Args  []string
+	Stdin []byte
+}
+
+func (p PlannedCommand) String() string {
+	return strings.Join(append([]string{p.Path}, p.Args...), " ")
+}
+
+// Plan returns the commands which ApplyConfig executes to apply the config, in order, without executing them.
+// The config entries are applied ordered by their dependencies, see the config OrderByDependencies.
+// The config itself is not reordered.
+// The sets of the config are validated first, see the schema Set Validate.
+func (c *Config) Plan() ([]PlannedCommand, error) {
+	return c.plan()
+}
+
+// plan returns the commands applying the config, with the nft flags given first.
+func (c *Config) plan(flags ...string) ([]PlannedCommand, error) {
+	for _, nftable := range c.Nftables {
+		if set := nftable.Set; set != nil {
+			if err := set.Validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ordered := c.Config
+	ordered.Nftables = append([]schema.Nftable{}, c.Nftables...)
+	ordered.OrderByDependencies()
+
+	data, err := ordered.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append(append([]string{}, flags...), cmdJSON, cmdFile, cmdStdin)
+	return []PlannedCommand{c.plannedCommand(data, args...)}, nil
+}
+
+// CounterSample is the value of a named counter object, as sampled from the system.
+type CounterSample struct {
+	Family  string
+	Table   string
+	Name    string
+	Packets int
+	Bytes   int
+}
+
+// ReadCountersReset reads and resets the named counter objects on the system, in a single operation.
+// The returned samples hold the values prior to the reset, allowing the computation of rates
+// over intervals without the race of a separate read and reset.
+// Only named counter objects are reset, inline rule counters are not.
 // The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
-func ApplyConfig(c *Config) error {
-	data, err := c.ToJSON()
+func ReadCountersReset(netNSPath string) ([]CounterSample, error) {
+	config, err := New(netNSPath)
 	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := config.execCommand(nil, cmdJSON, cmdReset, cmdCounters)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.FromJSON(stdout.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to reset counters: %v", err)
+	}
+
+	var samples []CounterSample
+	for _, nftable := range config.Nftables {
+		if counter := nftable.Counter; counter != nil {
+			samples = append(samples, CounterSample{
+				Family:  counter.Family,
+				Table:   counter.Table,
+				Name:    counter.Name,
+				Packets: counter.Packets,
+				Bytes:   counter.Bytes,
+			})
+		}
+	}
+	return samples, nil
+}
+
+// ApplyConfig applies the given nftables config on the system.
+// The nsenter options of the config are used to enter the network namespace.
+// The commands executed are the ones returned by the config Plan.
+// The config is applied in the DefaultApplyMode (ModeMerge, adding the entries to the ruleset present on the system),
+// unless another mode is given by WithMode: see ApplyMode for the effect of each mode on the pre-existing tables.
+// Once applied, a summary of the changed objects is logged at the ApplyLogLevel.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ApplyConfig(c *Config, opts ...ApplyOption) error {
+	options := applyOptions{mode: DefaultApplyMode}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if err := checkTableHashes(c.NetNSPath, options.expectedHash); err != nil {
 		return err
 	}
 
-	if _, err := execCommand(c.NetNSPath, data, cmdJSON, cmdFile, cmdStdin); err != nil {
+	applied := c.withOptions(options)
+	commands, err := applied.Plan()
+	if err != nil {
 		return err
 	}
 
+	c.Warnings = nil
+	for _, command := range commands {
+		_, warnings, err := c.runCommand(command)
+		if err != nil {
+			return err
+		}
+		c.Warnings = append(c.Warnings, warnings...)
+	}
+	logApplySummary(applied)
+
 	return nil
 }
 
-func execCommand(netNSPath string, input []byte, args ...string) (*bytes.Buffer, error) {
-	fullArgs := append([]string{
-		fmt.Sprintf("--net=%s", netNSPath),
-		"--",
-		NFTBinPath,
-	}, args...)
+// withOptions returns the config as applied with the options, the config itself if they do not change it.
+func (c *Config) withOptions(options applyOptions) *Config {
+	applied := c
+	if options.mode == ModeReplace {
+		applied = applied.withReplacedTables()
+	}
+	if options.counters {
+		applied = applied.withCounters()
+	}
+	if options.changeID != "" {
+		applied = applied.withChangeID(options.changeID)
+	}
+	return applied
+}
+
+// checkTableHashes returns a ConflictError if a table hash on the system differs from the expected one.
+func checkTableHashes(netNSPath string, expectedHash map[schema.Table]string) error {
+	for table, expected := range expectedHash {
+		hash, err := ReadTableHash(netNSPath, table.Family, table.Name)
+		if err != nil {
+			return err
+		}
+		if hash != expected {
+			return &ConflictError{Family: table.Family, Table: table.Name, ExpectedHash: expected, ActualHash: hash}
+		}
+	}
+	return nil
+}
+
+// ReplaceTable atomically replaces the content of the given table with the given entries.
+// The table is deleted (if present) and defined again with the entries, in a single nft transaction.
+// The deletion of a missing table is avoided by adding the table before deleting it.
+// The entries are expected to belong to the table, chains and rules of other tables are left as is.
+// The options are handled as by ApplyConfig, e.g. WithExpectedTableHash fails the replacement
+// if the table changed since it was read.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ReplaceTable(netNSPath string, table *schema.Table, nftables []schema.Nftable, opts ...ApplyOption) error {
+	c, err := New(netNSPath)
+	if err != nil {
+		return err
+	}
+
+	c.AddTable(table)
+	c.DeleteTable(table)
+	c.AddTable(table)
+	c.Nftables = append(c.Nftables, nftables...)
+
+	return ApplyConfig(c, opts...)
+}
+
+// ApplyConfigEcho applies the given nftables config on the system and
+// returns the objects created by it, as echoed back by nft.
+// The echoed objects include the handles assigned to them by the kernel.
+// The config is planned and applied as by ApplyConfig, with the same options.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func ApplyConfigEcho(c *Config, opts ...ApplyOption) (*Config, error) {
+	options := applyOptions{mode: DefaultApplyMode}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if err := checkTableHashes(c.NetNSPath, options.expectedHash); err != nil {
+		return nil, err
+	}
+
+	applied := c.withOptions(options)
+	commands, err := applied.plan(cmdEcho)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Warnings = nil
+	stdout := &bytes.Buffer{}
+	for _, command := range commands {
+		out, warnings, err := c.runCommand(command)
+		if err != nil {
+			return nil, err
+		}
+		c.Warnings = append(c.Warnings, warnings...)
+		stdout = out
+	}
+	logApplySummary(applied)
+
+	config, err := New(c.NetNSPath)
+	if err != nil {
+		return nil, err
+	}
+	config.PreserveCredentials = c.PreserveCredentials
+	config.NoFork = c.NoFork
+	config.Warnings = c.Warnings
+	if err = config.FromJSON(stdout.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to parse echoed config: %v", err)
+	}
+
+	return config, nil
+}
+
+// nsenterArgs returns the nsenter arguments which precede the nft command.
+func (c *Config) nsenterArgs() []string {
+	args := []string{fmt.Sprintf("--net=%s", c.NetNSPath)}
+	if c.PreserveCredentials {
+		args = append(args, "--preserve-credentials")
+	}
+	if c.NoFork {
+		args = append(args, "--no-fork")
+	}
+	return append(args, "--", NFTBinPath)
+}
+
+// plannedCommand returns the nft command executed in the network namespace by the command set by SetNetNSCommand.
+func (c *Config) plannedCommand(input []byte, args ...string) PlannedCommand {
+	if netNSCommand == NetNSCommandIPNetNSExec {
+		return PlannedCommand{
+			Path:  IPBinPath,
+			Args:  append(c.ipNetNSExecArgs(), args...),
+			Stdin: input,
+		}
+	}
+	return PlannedCommand{
+		Path:  NSEnterBinPath,
+		Args:  append(c.nsenterArgs(), args...),
+		Stdin: input,
+	}
+}
+
+// execCommand runs the nft command, recording the warnings it reports in the config.
+func (c *Config) execCommand(input []byte, args ...string) (*bytes.Buffer, error) {
+	stdout, warnings, err := c.runCommand(c.plannedCommand(input, args...))
+	c.Warnings = append(c.Warnings, warnings...)
+	return stdout, err
+}
 
-	Logger.Trace().Msgf("Running nsenter command: %v %v", NSEnterBinPath, fullArgs)
-	cmd := exec.Command(NSEnterBinPath, fullArgs...)
+// runCommand runs the command as runCommand, reporting it to the OnExec callback of the config.
+func (c *Config) runCommand(command PlannedCommand) (*bytes.Buffer, []string, error) {
+	stdout, warnings, err := runCommand(command)
+	if c.OnExec != nil {
+		c.OnExec(append([]string{command.Path}, command.Args...), command.Stdin, err)
+	}
+	return stdout, warnings, err
+}
+
+// runCommand runs the command, returning its standard output and
+// the warnings it reported on its standard error output, on success.
+func runCommand(command PlannedCommand) (*bytes.Buffer, []string, error) {
+	Logger.Trace().Msgf("Running nft command: %v %v", command.Path, command.Args)
+
+	stdout, stderr := newLimitedBuffer(MaxStdoutSize), newLimitedBuffer(MaxStderrSize)
+	var stdin io.Reader
+	if command.Stdin != nil {
+		stdin = bytes.NewReader(command.Stdin)
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
+	err := CommandRunner.Run(context.Background(), command.Path, command.Args, stdin, stdout, stderr)
+	if err == nil && stdout.Truncated() {
+		err = fmt.Errorf("%w (%d bytes)", ErrOutputTooLarge, MaxStdoutSize)
+	}
+	if err != nil && strings.Contains(stderr.String(), existsMessage) {
+		err = fmt.Errorf("%w: %v", ErrExists, err)
+	}
+	if err != nil {
+		return nil, nil, &NftError{
+			Path:        command.Path,
+			Args:        append([]string{command.Path}, command.Args...),
+			Stdin:       command.Stdin,
+			Stdout:      stdout.String(),
+			Stderr:      stderr.String(),
+			Err:         err,
+			ExitCode:    exitCode(err),
+			Diagnostics: ParseDiagnostics(stderr.String()),
+		}
+	}
 
-	if input != nil {
-		var stdin bytes.Buffer
-		stdin.Write(input)
-		cmd.Stdin = &stdin
+	warnings := outputWarnings(stderr.String())
+	for _, warning := range warnings {
+		Logger.Warn().Str("command", command.String()).Msg(warning)
 	}
+	return bytes.NewBuffer(stdout.Bytes()), warnings, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf(
-			"failed to execute %s %s: %w stdin:'%s' stdout:'%s' stderr:'%s'",
-			cmd.Path, strings.Join(cmd.Args, " "), err, string(input), stdout.String(), stderr.String(),
-		)
+// streamCommand runs the command, decoding its standard output with decode as it is streamed.
+// The command is stopped once decode fails while it is still writing its output, in which case the decode
+// error is returned. It returns an NftError on the failure of the command otherwise, the warnings reported
+// on the standard error output and the decode error on its success.
+func streamCommand(command PlannedCommand, decode func(io.Reader) error) ([]string, error) {
+	Logger.Trace().Msgf("Running nft command: %v %v", command.Path, command.Args)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr := newLimitedBuffer(MaxStderrSize)
+	runErr := make(chan error, 1)
+	go func() {
+		err := CommandRunner.Run(ctx, command.Path, command.Args, nil, stdoutWriter, stderr)
+		stdoutWriter.Close()
+		runErr <- err
+	}()
+
+	output := &eofReader{reader: stdout}
+	decodeErr := decode(output)
+	stopped := decodeErr != nil && !output.eof
+	if stopped {
+		cancel()
 	}
+	// Drain the output, so the command is not blocked on writing it until it terminates.
+	_, _ = io.Copy(ioutil.Discard, stdout)
 
-	return &stdout, nil
+	err := <-runErr
+	if stopped {
+		// The command failure, if any, is a consequence of stopping it.
+		return nil, decodeErr
+	}
+	if err != nil {
+		return nil, &NftError{
+			Path:        command.Path,
+			Args:        append([]string{command.Path}, command.Args...),
+			Stderr:      stderr.String(),
+			Err:         err,
+			ExitCode:    exitCode(err),
+			Diagnostics: ParseDiagnostics(stderr.String()),
+		}
+	}
+
+	warnings := outputWarnings(stderr.String())
+	for _, warning := range warnings {
+		Logger.Warn().Str("command", command.String()).Msg(warning)
+	}
+	return warnings, decodeErr
+}
+
+// eofReader records whether the end of the reader was reached, i.e. the command closed its output.
+type eofReader struct {
+	reader io.Reader
+	eof    bool
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// decodeNftables decodes the `{"nftables":[...]}` listing of nft, calling add with each entry in turn.
+// Other keys are skipped. An empty output, as listed by some nft versions for an empty ruleset, has no entries.
+func decodeNftables(decoder *json.Decoder, add func(schema.Nftable)) error {
+	if !decoder.More() {
+		return nil
+	}
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key != "nftables" {
+			if err := skipValue(decoder); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for index := 0; decoder.More(); index++ {
+			offset := decoder.InputOffset()
+			var entry json.RawMessage
+			if err := decoder.Decode(&entry); err != nil {
+				// The entry data is not kept: the syntax error offset is already relative to the stream.
+				var syntaxErr *json.SyntaxError
+				if errors.As(err, &syntaxErr) {
+					offset = syntaxErr.Offset
+				}
+				return fmt.Errorf("entry %d: %w (at offset %d)", index, err, offset)
+			}
+			offset = decoder.InputOffset() - int64(len(entry))
+			var nftable schema.Nftable
+			if err := json.Unmarshal(entry, &nftable); err != nil {
+				return withEntryErrorContext(err, index, offset, entry)
+			}
+			add(nftable)
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+// decodeErrorContextSize is the number of bytes of a listed entry shown on each side of a decoding error offset.
+const decodeErrorContextSize = 128
+
+// withEntryErrorContext wraps the decoding error of a listed entry with its index, the stream offset of the
+// failure and the entry data surrounding it.
+func withEntryErrorContext(err error, index int, offset int64, entry []byte) error {
+	var entryOffset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		entryOffset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		entryOffset = typeErr.Offset
+	}
+
+	start := entryOffset - decodeErrorContextSize
+	if start < 0 {
+		start = 0
+	}
+	end := entryOffset + decodeErrorContextSize
+	if end > int64(len(entry)) {
+		end = int64(len(entry))
+	}
+	if start > end {
+		start = end
+	}
+	return fmt.Errorf("entry %d: %w (at offset %d, near: %s)", index, err, offset+entryOffset, entry[start:end])
+}
+
+// expectDelim reads the next token of the streamed JSON, failing if it is not the given delimiter.
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("unexpected token %v, expected %v", token, delim)
+	}
+	return nil
+}
+
+// skipValue reads the next value of the streamed JSON, without decoding it.
+func skipValue(decoder *json.Decoder) error {
+	var value json.RawMessage
+	return decoder.Decode(&value)
+}
+
+// outputWarnings returns the non-empty lines of the standard error output of a successful command.
+func outputWarnings(stderr string) []string {
+	var warnings []string
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			warnings = append(warnings, line)
+		}
+	}
+	return warnings
 }
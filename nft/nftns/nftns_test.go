@@ -0,0 +1,446 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft/nftns"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "nftns")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// fakeNSEnter replaces the nsenter binary with a shell script of the given body,
+// for the duration of the test.
+func fakeNSEnter(t *testing.T, body string) {
+	scriptPath := filepath.Join(tempDir(t), "nsenter")
+	assert.NoError(t, ioutil.WriteFile(scriptPath, []byte("#!/bin/sh\n"+body), 0700))
+
+	nsenter := nftns.NSEnterBinPath
+	nftns.NSEnterBinPath = scriptPath
+	t.Cleanup(func() { nftns.NSEnterBinPath = nsenter })
+}
+
+func TestCheckJSONSupport(t *testing.T) {
+	t.Run("JSON is supported", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"nftables":[{"metainfo":{"version":"1.0.1"}}]}'`)
+		assert.NoError(t, nftns.CheckJSONSupport("/run/netns/test"))
+	})
+
+	t.Run("nft is built without JSON support", func(t *testing.T) {
+		fakeNSEnter(t, "echo 'Error: JSON support not compiled-in' >&2; exit 1")
+
+		err := nftns.CheckJSONSupport("/run/netns/test")
+		assert.True(t, errors.Is(err, nftns.ErrJSONUnsupported), "unexpected error: %v", err)
+	})
+
+	t.Run("nft does not recognize the JSON option", func(t *testing.T) {
+		fakeNSEnter(t, "echo \"nft: invalid option -- 'j'\" >&2; exit 1")
+
+		err := nftns.CheckJSONSupport("/run/netns/test")
+		assert.True(t, errors.Is(err, nftns.ErrJSONUnsupported), "unexpected error: %v", err)
+	})
+
+	t.Run("nft output is not JSON", func(t *testing.T) {
+		fakeNSEnter(t, "echo 'table ip filter'")
+
+		err := nftns.CheckJSONSupport("/run/netns/test")
+		assert.True(t, errors.Is(err, nftns.ErrJSONUnsupported), "unexpected error: %v", err)
+	})
+
+	t.Run("Other failures are not reported as lack of JSON support", func(t *testing.T) {
+		fakeNSEnter(t, "echo 'Error: Operation not permitted' >&2; exit 1")
+
+		err := nftns.CheckJSONSupport("/run/netns/test")
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, nftns.ErrJSONUnsupported))
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr))
+	})
+}
+
+func TestNSEnterOptions(t *testing.T) {
+	argsPath := filepath.Join(tempDir(t), "args")
+	fakeNSEnter(t, `echo "$@" > `+argsPath+"\ncat > /dev/null\n")
+
+	nftBinPath := nftns.NFTBinPath
+	nftns.NFTBinPath = "/usr/sbin/nft"
+	defer func() { nftns.NFTBinPath = nftBinPath }()
+
+	tests := []struct {
+		name                string
+		preserveCredentials bool
+		noFork              bool
+		expectedArgs        string
+	}{
+		{"Apply config with the default options", false, false, "--net=/run/netns/test -- /usr/sbin/nft -j -f -"},
+		{"Apply config preserving credentials", true, false, "--net=/run/netns/test --preserve-credentials -- /usr/sbin/nft -j -f -"},
+		{"Apply config without forking", false, true, "--net=/run/netns/test --no-fork -- /usr/sbin/nft -j -f -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := nftns.New("/run/netns/test")
+			assert.NoError(t, err)
+			c.PreserveCredentials = tt.preserveCredentials
+			c.NoFork = tt.noFork
+
+			assert.NoError(t, nftns.ApplyConfig(c))
+
+			args, err := ioutil.ReadFile(argsPath)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedArgs, strings.TrimSpace(string(args)))
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	nsenter, nftBinPath := nftns.NSEnterBinPath, nftns.NFTBinPath
+	nftns.NSEnterBinPath, nftns.NFTBinPath = "/usr/bin/nsenter", "/usr/sbin/nft"
+	defer func() { nftns.NSEnterBinPath, nftns.NFTBinPath = nsenter, nftBinPath }()
+
+	c, err := nftns.New("/run/netns/test")
+	assert.NoError(t, err)
+	c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+
+	commands, err := c.Plan()
+	assert.NoError(t, err)
+	assert.Equal(t, []nftns.PlannedCommand{{
+		Path:  "/usr/bin/nsenter",
+		Args:  []string{"--net=/run/netns/test", "--", "/usr/sbin/nft", "-j", "-f", "-"},
+		Stdin: []byte(`{"nftables":[{"table":{"family":"ip","name":"filter"}}]}`),
+	}}, commands)
+	assert.Equal(t, "/usr/bin/nsenter --net=/run/netns/test -- /usr/sbin/nft -j -f -", commands[0].String())
+}
+
+func TestDeleteRuleMatching(t *testing.T) {
+	const listChainOutput = `{"nftables":[` +
+		`{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input","handle":1}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":4,"expr":[{"accept":null}],"comment":"allow"}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":5,"expr":[{"drop":null}]}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":6,"expr":[{"counter":{"packets":3,"bytes":180}},{"accept":null}]}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":7,"expr":[{"counter":{"packets":0,"bytes":0}},{"return":null}]}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":8,"expr":[{"counter":{"packets":2,"bytes":120}},{"return":null}]}}]}`
+
+	applyPath := filepath.Join(tempDir(t), "stdin")
+	fakeNSEnter(t, `case "$*" in
+*"list chain"*) echo '`+listChainOutput+`';;
+*) cat > `+applyPath+`;;
+esac
+`)
+
+	t.Run("Delete the rule matching by content", func(t *testing.T) {
+		rule := schema.Rule{Expr: []schema.Statement{{Verdict: schema.Drop()}}}
+		assert.NoError(t, nftns.DeleteRuleMatching("/run/netns/test", "ip", "filter", "input", rule))
+
+		stdin, err := ioutil.ReadFile(applyPath)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			`{"nftables":[{"delete":{"rule":{"family":"ip","table":"filter","chain":"input","handle":5}}}]}`,
+			string(stdin),
+		)
+	})
+
+	t.Run("Delete a rule which differs by comment", func(t *testing.T) {
+		rule := schema.Rule{Expr: []schema.Statement{{Verdict: schema.Accept()}}}
+		assert.Error(t, nftns.DeleteRuleMatching("/run/netns/test", "ip", "filter", "input", rule))
+	})
+
+	t.Run("Delete the rule matching by content, regardless of the counter values", func(t *testing.T) {
+		rule := schema.Rule{Expr: []schema.Statement{{Counter: &schema.Counter{}}, {Verdict: schema.Accept()}}}
+		assert.NoError(t, nftns.DeleteRuleMatching("/run/netns/test", "ip", "filter", "input", rule))
+
+		stdin, err := ioutil.ReadFile(applyPath)
+		assert.NoError(t, err)
+		assert.Contains(t, string(stdin), `"handle":6`)
+	})
+
+	t.Run("Delete a rule with multiple matches", func(t *testing.T) {
+		rule := schema.Rule{Expr: []schema.Statement{{Counter: &schema.Counter{}}, {Verdict: schema.Return()}}}
+
+		err := nftns.DeleteRuleMatching("/run/netns/test", "ip", "filter", "input", rule)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "handles 7, 8")
+	})
+}
+
+func TestOutputSizeLimits(t *testing.T) {
+	stdoutSize, stderrSize := nftns.MaxStdoutSize, nftns.MaxStderrSize
+	defer func() { nftns.MaxStdoutSize, nftns.MaxStderrSize = stdoutSize, stderrSize }()
+
+	t.Run("Fail when the output exceeds the limit", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"nftables":[{"table":{"family":"ip","name":"filter"}}]}'`)
+		nftns.MaxStdoutSize = 16
+
+		_, err := nftns.ReadTable("/run/netns/test", "ip", "filter")
+		assert.True(t, errors.Is(err, nftns.ErrOutputTooLarge), "unexpected error: %v", err)
+	})
+
+	t.Run("Read the output within the limit", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"nftables":[{"table":{"family":"ip","name":"filter"}}]}'`)
+		nftns.MaxStdoutSize = 1024
+
+		config, err := nftns.ReadTable("/run/netns/test", "ip", "filter")
+		assert.NoError(t, err)
+		assert.Len(t, config.Nftables, 1)
+	})
+
+	t.Run("Read the ruleset as streamed, regardless of the limit", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"nftables":[{"table":{"family":"ip","name":"filter"}},{"table":{"family":"ip","name":"nat"}}]}'`)
+		nftns.MaxStdoutSize = 16
+
+		config, err := nftns.ReadConfig("/run/netns/test")
+		assert.NoError(t, err)
+		assert.Len(t, config.Nftables, 2)
+		assert.Equal(t, "nat", config.Nftables[1].Table.Name)
+	})
+
+	t.Run("Fail to read a malformed ruleset", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"nftables":[{"table":{"family":"ip","name":"filter"}},{"table":'`)
+
+		_, err := nftns.ReadConfig("/run/netns/test")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list ruleset")
+		assert.Contains(t, err.Error(), "entry 1")
+		assert.Contains(t, err.Error(), "at offset 54")
+	})
+
+	t.Run("Fail to read a ruleset entry of the wrong type", func(t *testing.T) {
+		fakeNSEnter(t, `echo '{"nftables":[{"table":{"family":"ip","name":"filter"}},{"table":{"family":"ip","name":7}}]}'`)
+
+		_, err := nftns.ReadConfig("/run/netns/test")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list ruleset")
+		assert.Contains(t, err.Error(), "entry 1")
+		assert.Contains(t, err.Error(), "at offset 87")
+		assert.Contains(t, err.Error(), `near: {"table":{"family":"ip","name":7}}`)
+	})
+
+	t.Run("Truncate the error output exceeding the limit", func(t *testing.T) {
+		fakeNSEnter(t, "echo 'Error: Could not process rule: No such file or directory' >&2; exit 1")
+		nftns.MaxStdoutSize, nftns.MaxStderrSize = 0, 14
+
+		_, err := nftns.ReadConfig("/run/netns/test")
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+		assert.Equal(t, "Error: Could n[...truncated 43 bytes]", nftErr.Stderr)
+	})
+}
+
+func TestReadConfigWithRawJSON(t *testing.T) {
+	const output = `{"nftables": [{"table": {"family": "ip", "name": "filter", "handle": 1}}]}`
+	fakeNSEnter(t, `echo '`+output+`'`)
+
+	t.Run("Read config without the raw JSON", func(t *testing.T) {
+		config, err := nftns.ReadConfig("/run/netns/test")
+		assert.NoError(t, err)
+		assert.Nil(t, config.RawJSON)
+	})
+
+	t.Run("Read config with the raw JSON", func(t *testing.T) {
+		config, err := nftns.ReadConfig("/run/netns/test", nftns.WithRawJSON())
+		assert.NoError(t, err)
+		assert.Equal(t, output+"\n", string(config.RawJSON))
+
+		expectedConfig, err := nftns.New("/run/netns/test")
+		assert.NoError(t, err)
+		expectedConfig.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+		assert.Equal(t, expectedConfig.Nftables, config.Nftables)
+	})
+}
+
+func TestApplyConfigSummaryLog(t *testing.T) {
+	fakeNSEnter(t, "cat > /dev/null")
+
+	var logs bytes.Buffer
+	logger := nftns.Logger
+	nftns.Logger = zerolog.New(&logs).Level(zerolog.DebugLevel)
+	defer func() { nftns.Logger = logger }()
+
+	c, err := nftns.New("/run/netns/test")
+	assert.NoError(t, err)
+	table := &schema.Table{Family: schema.FamilyIP, Name: "filter"}
+	chain := &schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"}
+	c.AddTable(table)
+	c.AddChain(chain)
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input"})
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input"})
+	c.DeleteChain(&schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "old"})
+	c.FlushTable(table)
+
+	assert.NoError(t, nftns.ApplyConfig(c))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"level":   "debug",
+		"message": "Applied nftables config",
+		"netns":   "/run/netns/test",
+		"add":     []interface{}{"table ip filter", "chain ip filter input", "2 rule(s) in chain ip filter input"},
+		"delete":  []interface{}{"chain ip filter old"},
+		"flush":   []interface{}{"table ip filter"},
+	}, entry)
+}
+
+func TestApplyConfigSummaryLogWithOptions(t *testing.T) {
+	fakeNSEnter(t, "cat > /dev/null")
+
+	var logs bytes.Buffer
+	logger := nftns.Logger
+	nftns.Logger = zerolog.New(&logs).Level(zerolog.DebugLevel)
+	defer func() { nftns.Logger = logger }()
+
+	c, err := nftns.New("/run/netns/test")
+	assert.NoError(t, err)
+	c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+
+	assert.NoError(t, nftns.ApplyConfig(c, nftns.WithMode(nftns.ModeReplace), nftns.WithChangeID("1234")))
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, []interface{}{
+		"table ip filter", "table ip filter", "table inet go_nft_change_id", "table inet go_nft_change_id",
+	}, entry["add"])
+	assert.Equal(t, []interface{}{"table ip filter", "table inet go_nft_change_id"}, entry["delete"])
+}
+
+func TestReadCountersReset(t *testing.T) {
+	argsPath := filepath.Join(tempDir(t), "args")
+	fakeNSEnter(t, `echo "$@" > `+argsPath+`
+echo '{"nftables":[{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}},`+
+		`{"counter":{"family":"inet","name":"http","table":"filter","handle":2,"packets":10,"bytes":840}},`+
+		`{"counter":{"family":"inet","name":"ssh","table":"filter","handle":3,"packets":0,"bytes":0}}]}'
+`)
+
+	samples, err := nftns.ReadCountersReset("/run/netns/test")
+	assert.NoError(t, err)
+	assert.Equal(t, []nftns.CounterSample{
+		{Family: "inet", Table: "filter", Name: "http", Packets: 10, Bytes: 840},
+		{Family: "inet", Table: "filter", Name: "ssh", Packets: 0, Bytes: 0},
+	}, samples)
+
+	args, err := ioutil.ReadFile(argsPath)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(string(args)), "-j reset counters"), string(args))
+}
+
+func TestReadConfigListFlags(t *testing.T) {
+	argsPath := filepath.Join(tempDir(t), "args")
+	fakeNSEnter(t, `echo "$@" > `+argsPath+"\necho '{\"nftables\":[]}'\n")
+
+	tests := []struct {
+		name         string
+		opts         []nftns.ReadOption
+		expectedArgs string
+	}{
+		{"Read config", nil, "-j list ruleset"},
+		{"Read config with handles", []nftns.ReadOption{nftns.WithHandles()}, "-j -a list ruleset"},
+		{"Read config fully numeric", []nftns.ReadOption{nftns.WithNumeric()}, "-j -nn list ruleset"},
+		{"Read config with handles, fully numeric", []nftns.ReadOption{nftns.WithHandles(), nftns.WithNumeric()}, "-j -a -nn list ruleset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := nftns.ReadConfig("/run/netns/test", tt.opts...)
+			assert.NoError(t, err)
+
+			args, err := ioutil.ReadFile(argsPath)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasSuffix(strings.TrimSpace(string(args)), " "+tt.expectedArgs), string(args))
+		})
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	newConfig := func(t *testing.T, tables ...string) *nftns.Config {
+		c, err := nftns.New("/run/netns/test")
+		assert.NoError(t, err)
+		c.FlushRuleset()
+		for _, table := range tables {
+			c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: table})
+			c.AddChain(&schema.Chain{Family: schema.FamilyIP, Table: table, Name: "input"})
+		}
+		return c
+	}
+	// The fake nft records its arguments and input, and fails the checks of the bad tables.
+	checkingNSEnter := func(t *testing.T) string {
+		logPath := filepath.Join(tempDir(t), "invocations.log")
+		fakeNSEnter(t, "input=$(cat)\n"+
+			"echo \"$@ $input\" >> "+logPath+"\n"+
+			"case \"$input\" in *bad*) echo 'Error: Could not process rule: No such file or directory' >&2; exit 1;; esac\n")
+		return logPath
+	}
+
+	t.Run("Check a config table by table", func(t *testing.T) {
+		logPath := checkingNSEnter(t)
+
+		assert.NoError(t, nftns.CheckConfig(newConfig(t, "a", "b")))
+
+		data, err := ioutil.ReadFile(logPath)
+		assert.NoError(t, err)
+		invocations := strings.Split(strings.TrimSpace(string(data)), "\n")
+		assert.Equal(t, []string{
+			`--net=/run/netns/test -- nft -c -j -f - {"nftables":[{"flush":{"ruleset":null}},` +
+				`{"table":{"family":"ip","name":"a"}},{"chain":{"family":"ip","table":"a","name":"input"}}]}`,
+			`--net=/run/netns/test -- nft -c -j -f - {"nftables":[{"flush":{"ruleset":null}},` +
+				`{"table":{"family":"ip","name":"b"}},{"chain":{"family":"ip","table":"b","name":"input"}}]}`,
+		}, invocations)
+	})
+
+	t.Run("Report the errors of all the failing tables", func(t *testing.T) {
+		logPath := checkingNSEnter(t)
+
+		err := nftns.CheckConfig(newConfig(t, "bad1", "good", "bad2"))
+		assert.Error(t, err)
+		aggregateErr, ok := err.(*nftns.AggregateError)
+		assert.True(t, ok, "unexpected error type: %T", err)
+		assert.Len(t, aggregateErr.Errors, 2)
+		assert.Contains(t, aggregateErr.Errors[0].Error(), "table ip bad1")
+		assert.Contains(t, aggregateErr.Errors[1].Error(), "table ip bad2")
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(aggregateErr.Errors[0], &nftErr))
+
+		data, err := ioutil.ReadFile(logPath)
+		assert.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 3)
+	})
+
+	t.Run("Check a config of no table", func(t *testing.T) {
+		logPath := checkingNSEnter(t)
+
+		assert.NoError(t, nftns.CheckConfig(newConfig(t)))
+		data, err := ioutil.ReadFile(logPath)
+		assert.NoError(t, err)
+		assert.Equal(t, `--net=/run/netns/test -- nft -c -j -f - {"nftables":[{"flush":{"ruleset":null}}]}`+"\n", string(data))
+	})
+}
@@ -0,0 +1,47 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+// Runner executes the nft commands issued by the package, through nsenter or ip.
+// It allows replacing the local execution, e.g. for testing or for remote execution.
+// All the commands of the package are executed through the CommandRunner, nothing is executed locally otherwise,
+// so a runner forwarding the commands to a remote executor (e.g. a privileged helper) serves all the operations.
+// Run returns an error if the command fails to execute or exits with a non-zero status.
+// An error which implements `ExitCode() int` (as *exec.ExitError does) reports the exit code in NftError.
+type Runner interface {
+	Run(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// CommandRunner is the Runner used to execute the commands, executing them locally by default.
+var CommandRunner Runner = localRunner{}
+
+type localRunner struct{}
+
+func (localRunner) Run(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
@@ -0,0 +1,1236 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft/nftns"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+type invocation struct {
+	Path  string
+	Args  []string
+	Stdin string
+}
+
+// fakeRunner records the commands it runs, answering them with the given output (and error output).
+// Queued outputs, when set, answer the commands in turn before the given output.
+type fakeRunner struct {
+	output      string
+	outputs     []string
+	errOutput   string
+	invocations []invocation
+}
+
+func (r *fakeRunner) Run(_ context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var input []byte
+	if stdin != nil {
+		var err error
+		if input, err = ioutil.ReadAll(stdin); err != nil {
+			return err
+		}
+	}
+	r.invocations = append(r.invocations, invocation{Path: path, Args: args, Stdin: string(input)})
+	if _, err := io.WriteString(stderr, r.errOutput); err != nil {
+		return err
+	}
+	output := r.output
+	if len(r.outputs) > 0 {
+		output, r.outputs = r.outputs[0], r.outputs[1:]
+	}
+	_, err := io.WriteString(stdout, output)
+	return err
+}
+
+func useFakeRunner(t *testing.T, output string) *fakeRunner {
+	runner := &fakeRunner{output: output}
+	commandRunner, nsenter, nftBinPath := nftns.CommandRunner, nftns.NSEnterBinPath, nftns.NFTBinPath
+	nftns.CommandRunner, nftns.NSEnterBinPath, nftns.NFTBinPath = runner, "/usr/bin/nsenter", "/usr/sbin/nft"
+	t.Cleanup(func() {
+		nftns.CommandRunner, nftns.NSEnterBinPath, nftns.NFTBinPath = commandRunner, nsenter, nftBinPath
+	})
+	return runner
+}
+
+const netNSPath = "/run/netns/test"
+
+func nftArgs(args ...string) []string {
+	return append([]string{"--net=" + netNSPath, "--", "/usr/sbin/nft"}, args...)
+}
+
+func TestExecContract(t *testing.T) {
+	table := &schema.Table{Family: schema.FamilyIP, Name: "filter"}
+
+	t.Run("Apply config", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(table)
+
+		assert.NoError(t, nftns.ApplyConfig(c))
+		assert.Equal(t, []invocation{{
+			Path:  "/usr/bin/nsenter",
+			Args:  nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[{"table":{"family":"ip","name":"filter"}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Apply config which flushes the ruleset", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.FlushRuleset()
+
+		assert.NoError(t, nftns.ApplyConfig(c))
+		assert.Equal(t, []invocation{{
+			Path:  "/usr/bin/nsenter",
+			Args:  nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[{"flush":{"ruleset":null}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Apply config with echo", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[{"add":{"table":{"family":"ip","name":"filter"}}}]}`)
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(table)
+
+		_, err = nftns.ApplyConfigEcho(c)
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{{
+			Path:  "/usr/bin/nsenter",
+			Args:  nftArgs("-e", "-j", "-f", "-"),
+			Stdin: `{"nftables":[{"table":{"family":"ip","name":"filter"}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Apply config with echo is planned as ApplyConfig", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[{"add":{"table":{"family":"ip","name":"filter"}}}]}`)
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(table)
+		c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input",
+			Expr: []schema.Statement{{Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: "allowed"}}}}})
+		c.AddChain(&schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "allowed"})
+		var executed [][]string
+		c.OnExec = func(args []string, _ []byte, _ error) { executed = append(executed, args) }
+
+		_, err = nftns.ApplyConfigEcho(c, nftns.WithChangeID("rollout-42"))
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-e", "-j", "-f", "-"),
+			Stdin: `{"nftables":[` +
+				`{"table":{"family":"ip","name":"filter"}},` +
+				`{"chain":{"family":"ip","table":"filter","name":"allowed"}},` +
+				`{"rule":{"family":"ip","table":"filter","chain":"input","expr":[{"jump":{"target":"allowed"}}]}},` +
+				`{"table":{"family":"inet","name":"go_nft_change_id"}},` +
+				`{"delete":{"table":{"family":"inet","name":"go_nft_change_id"}}},` +
+				`{"table":{"family":"inet","name":"go_nft_change_id","comment":"rollout-42"}}]}`,
+		}}, runner.invocations)
+		assert.Len(t, executed, 1)
+	})
+
+	t.Run("Flush set", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+
+		assert.NoError(t, nftns.FlushSet(netNSPath, "ip", "filter", "blocklist"))
+		assert.Equal(t, []invocation{{
+			Path:  "/usr/bin/nsenter",
+			Args:  nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[{"flush":{"set":{"family":"ip","table":"filter","name":"blocklist"}}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Flush map", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+
+		assert.NoError(t, nftns.FlushMap(netNSPath, "ip", "filter", "ports"))
+		assert.Equal(t, []invocation{{
+			Path:  "/usr/bin/nsenter",
+			Args:  nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[{"flush":{"map":{"family":"ip","table":"filter","name":"ports"}}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Replace table", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		chain := &schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"}
+
+		assert.NoError(t, nftns.ReplaceTable(netNSPath, table, []schema.Nftable{{Chain: chain}}))
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[` +
+				`{"table":{"family":"ip","name":"filter"}},` +
+				`{"delete":{"table":{"family":"ip","name":"filter"}}},` +
+				`{"table":{"family":"ip","name":"filter"}},` +
+				`{"chain":{"family":"ip","table":"filter","name":"input"}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Read config", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+
+		_, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "ruleset")}}, runner.invocations)
+	})
+
+	t.Run("Read chain", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[{"chain":{"family":"ip","table":"filter","name":"input","handle":1}}]}`)
+
+		_, _, err := nftns.ReadChain(netNSPath, "ip", "filter", "input")
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "-a", "list", "chain", "ip", "filter", "input"),
+		}}, runner.invocations)
+	})
+
+	t.Run("Check JSON support", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+
+		assert.NoError(t, nftns.CheckJSONSupport(netNSPath))
+		assert.Equal(t, []invocation{{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "tables")}}, runner.invocations)
+	})
+}
+
+func TestChangeID(t *testing.T) {
+	t.Run("Apply config with a change ID", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+
+		assert.NoError(t, nftns.ApplyConfig(c, nftns.WithChangeID("rollout-42")))
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[` +
+				`{"table":{"family":"ip","name":"filter"}},` +
+				`{"table":{"family":"inet","name":"go_nft_change_id"}},` +
+				`{"delete":{"table":{"family":"inet","name":"go_nft_change_id"}}},` +
+				`{"table":{"family":"inet","name":"go_nft_change_id","comment":"rollout-42"}}]}`,
+		}}, runner.invocations)
+		assert.Len(t, c.Nftables, 1, "the applied config is not mutated")
+	})
+
+	t.Run("Read the applied change ID", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[`+
+			`{"table":{"family":"ip","name":"filter","handle":1}},`+
+			`{"table":{"family":"inet","name":"go_nft_change_id","handle":2,"comment":"rollout-42"}}]}`)
+
+		id, err := nftns.ReadChangeID(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "rollout-42", id)
+		assert.Equal(t, []invocation{{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "tables")}}, runner.invocations)
+	})
+
+	t.Run("Read the change ID when none is applied", func(t *testing.T) {
+		useFakeRunner(t, `{"nftables":[{"table":{"family":"ip","name":"filter","handle":1}}]}`)
+
+		id, err := nftns.ReadChangeID(netNSPath)
+		assert.NoError(t, err)
+		assert.Empty(t, id)
+	})
+}
+
+func TestDriftDetected(t *testing.T) {
+	liveRuleset := `{"nftables":[` +
+		`{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}},` +
+		`{"table":{"family":"ip","name":"filter","handle":1}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input","handle":1}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":2,` +
+		`"expr":[{"counter":{"packets":3,"bytes":180}},{"accept":null}]}}]}`
+	newDesired := func(t *testing.T) *nftns.Config {
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+		c.AddChain(&schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"})
+		c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input",
+			Expr: []schema.Statement{{Counter: &schema.Counter{}}, {Verdict: schema.Accept()}}})
+		return c
+	}
+
+	t.Run("No drift", func(t *testing.T) {
+		runner := useFakeRunner(t, liveRuleset)
+
+		drift, diff, err := nftns.DriftDetected(newDesired(t))
+		assert.NoError(t, err)
+		assert.False(t, drift)
+		assert.True(t, diff.IsEmpty())
+		assert.Equal(t, []invocation{{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "ruleset")}}, runner.invocations)
+	})
+
+	t.Run("Drift", func(t *testing.T) {
+		useFakeRunner(t, liveRuleset)
+		desired := newDesired(t)
+		desired.Nftables[2].Rule.Expr[1] = schema.Statement{Verdict: schema.Drop()}
+
+		drift, diff, err := nftns.DriftDetected(desired)
+		assert.NoError(t, err)
+		assert.True(t, drift)
+		assert.Len(t, diff.Added, 1)
+		assert.Len(t, diff.Removed, 1)
+		assert.Equal(t, schema.Accept(), diff.Removed[0].Rule.Expr[1].Verdict)
+	})
+}
+
+func TestReplaceTable(t *testing.T) {
+	table := &schema.Table{Family: schema.FamilyIP, Name: "filter", Comment: "managed"}
+	nftables := []schema.Nftable{
+		{Chain: &schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"}},
+		{Rule: &schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input", Expr: []schema.Statement{{Verdict: schema.Accept()}}}},
+	}
+	const replacement = `{"nftables":[` +
+		`{"table":{"family":"ip","name":"filter","comment":"managed"}},` +
+		`{"delete":{"table":{"family":"ip","name":"filter","comment":"managed"}}},` +
+		`{"table":{"family":"ip","name":"filter","comment":"managed"}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input"}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","expr":[{"accept":null}]}}]}`
+
+	t.Run("Replace a table in a single transaction, also when retried", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+
+		assert.NoError(t, nftns.ReplaceTable(netNSPath, table, nftables))
+		assert.NoError(t, nftns.ReplaceTable(netNSPath, table, nftables))
+		assert.Len(t, runner.invocations, 2)
+		for _, inv := range runner.invocations {
+			assert.Equal(t, nftArgs("-j", "-f", "-"), inv.Args)
+			assert.Equal(t, replacement, inv.Stdin)
+		}
+	})
+
+	t.Run("Replace a table which fails", func(t *testing.T) {
+		useFakeRunner(t, "")
+		nftns.CommandRunner = failingRunner{errOutput: "Error: Could not process rule: No such file or directory\n"}
+
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(nftns.ReplaceTable(netNSPath, table, nftables), &nftErr))
+	})
+}
+
+func TestReplaceTableWithExpectedHash(t *testing.T) {
+	table := &schema.Table{Family: schema.FamilyIP, Name: "filter"}
+	liveTable := `{"nftables":[` +
+		`{"table":{"family":"ip","name":"filter","handle":1}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input","handle":1}}]}`
+
+	useFakeRunner(t, liveTable)
+	hash, err := nftns.ReadTableHash(netNSPath, "ip", "filter")
+	assert.NoError(t, err)
+	chain := []schema.Nftable{{Chain: &schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"}}}
+
+	t.Run("Replace an unchanged table", func(t *testing.T) {
+		runner := useFakeRunner(t, liveTable)
+
+		assert.NoError(t, nftns.ReplaceTable(netNSPath, table, chain, nftns.WithExpectedTableHash(table, hash)))
+		assert.Len(t, runner.invocations, 2)
+		assert.Equal(t, nftArgs("-j", "list", "table", "ip", "filter"), runner.invocations[0].Args)
+		assert.Equal(t, nftArgs("-j", "-f", "-"), runner.invocations[1].Args)
+	})
+
+	t.Run("Replace a table which changed since read", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[{"table":{"family":"ip","name":"filter","handle":1}}]}`)
+
+		err := nftns.ReplaceTable(netNSPath, table, chain, nftns.WithExpectedTableHash(table, hash))
+		var conflictErr *nftns.ConflictError
+		assert.True(t, errors.As(err, &conflictErr), "unexpected error: %v", err)
+		assert.Equal(t, hash, conflictErr.ExpectedHash)
+		assert.NotEqual(t, hash, conflictErr.ActualHash)
+		assert.Len(t, runner.invocations, 1, "the table is not expected to be replaced")
+	})
+}
+
+func TestDeleteConfigObjects(t *testing.T) {
+	const liveChain = `{"nftables":[` +
+		`{"chain":{"family":"ip","table":"filter","name":"input","handle":1}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":4,"expr":[{"accept":null}]}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":5,"expr":[{"drop":null}]}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":6,"expr":[{"accept":null}]}}]}`
+	newConfig := func(t *testing.T) *nftns.Config {
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+		c.AddChain(&schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"})
+		c.AddSet(&schema.Set{Family: schema.FamilyIP, Table: "filter", Name: "allowed", Type: schema.SetTypeIPv4Addr})
+		for i := 0; i < 2; i++ {
+			c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input",
+				Expr: []schema.Statement{{Verdict: schema.Accept()}}})
+		}
+		return c
+	}
+
+	t.Run("Delete config objects", func(t *testing.T) {
+		runner := useFakeRunner(t, liveChain)
+
+		assert.NoError(t, nftns.DeleteConfigObjects(newConfig(t)))
+		assert.Equal(t, []invocation{
+			{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "-a", "list", "chain", "ip", "filter", "input")},
+			{
+				Path: "/usr/bin/nsenter",
+				Args: nftArgs("-j", "-f", "-"),
+				Stdin: `{"nftables":[` +
+					`{"delete":{"rule":{"family":"ip","table":"filter","chain":"input","handle":4}}},` +
+					`{"delete":{"rule":{"family":"ip","table":"filter","chain":"input","handle":6}}},` +
+					`{"delete":{"chain":{"family":"ip","table":"filter","name":"input"}}},` +
+					`{"delete":{"set":{"family":"ip","table":"filter","name":"allowed","type":"ipv4_addr"}}},` +
+					`{"delete":{"table":{"family":"ip","name":"filter"}}}]}`,
+			},
+		}, runner.invocations)
+	})
+
+	t.Run("Delete config objects with a rule missing on the system", func(t *testing.T) {
+		runner := useFakeRunner(t, liveChain)
+		c := newConfig(t)
+		c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input",
+			Expr: []schema.Statement{{Verdict: schema.Accept()}}})
+
+		assert.Error(t, nftns.DeleteConfigObjects(c))
+		assert.Len(t, runner.invocations, 1, "no deletion is expected to be applied")
+	})
+}
+
+func TestApplyConfigOrdersChainsBeforeJumps(t *testing.T) {
+	runner := useFakeRunner(t, "")
+	c, err := nftns.New(netNSPath)
+	assert.NoError(t, err)
+	c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input",
+		Expr: []schema.Statement{{Verdict: schema.Verdict{Jump: &schema.ToTarget{Target: "allowed"}}}}})
+	c.AddChain(&schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "allowed"})
+
+	assert.NoError(t, nftns.ApplyConfig(c))
+	assert.Equal(t, `{"nftables":[`+
+		`{"table":{"family":"ip","name":"filter"}},`+
+		`{"chain":{"family":"ip","table":"filter","name":"allowed"}},`+
+		`{"rule":{"family":"ip","table":"filter","chain":"input","expr":[{"jump":{"target":"allowed"}}]}}]}`,
+		runner.invocations[0].Stdin)
+	assert.NotNil(t, c.Nftables[2].Chain, "the applied config is not expected to be reordered")
+}
+
+func TestWarnings(t *testing.T) {
+	const warning = "Warning: deprecated syntax, use ibrname instead"
+
+	t.Run("Read config with warnings", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+		runner.errOutput = warning + "\n\n"
+
+		c, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{warning}, c.Warnings)
+	})
+
+	t.Run("Apply config with warnings", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		runner.errOutput = warning + "\n"
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+
+		assert.NoError(t, nftns.ApplyConfig(c))
+		assert.Equal(t, []string{warning}, c.Warnings)
+
+		runner.errOutput = ""
+		assert.NoError(t, nftns.ApplyConfig(c))
+		assert.Empty(t, c.Warnings, "warnings of a previous apply are not expected to be retained")
+	})
+}
+
+func TestListTables(t *testing.T) {
+	runner := useFakeRunner(t, `{"nftables":[`+
+		`{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}},`+
+		`{"table":{"family":"ip","name":"filter","handle":1}},`+
+		`{"table":{"family":"inet","name":"nat","handle":2}}]}`)
+
+	tables, err := nftns.ListTables(netNSPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []nftns.TableRef{{Family: "ip", Name: "filter"}, {Family: "inet", Name: "nat"}}, tables)
+	assert.Equal(t, []invocation{{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "tables")}}, runner.invocations)
+}
+
+func TestReadChain(t *testing.T) {
+	t.Run("Read a chain and its rules", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[`+
+			`{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}},`+
+			`{"chain":{"family":"ip","table":"filter","name":"input","handle":1,"type":"filter","hook":"input","prio":0,"policy":"drop"}},`+
+			`{"rule":{"family":"ip","table":"filter","chain":"input","handle":2,"expr":[{"accept":null}]}},`+
+			`{"rule":{"family":"ip","table":"filter","chain":"input","handle":3,"expr":[{"drop":null}]}}]}`)
+
+		chain, rules, err := nftns.ReadChain(netNSPath, "ip", "filter", "input")
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "-a", "list", "chain", "ip", "filter", "input"),
+		}}, runner.invocations)
+		assert.Equal(t, "input", chain.Name)
+		assert.Equal(t, schema.PolicyDrop, chain.Policy)
+		assert.Len(t, rules, 2)
+		assert.Equal(t, 2, *rules[0].Handle)
+		assert.Equal(t, 3, *rules[1].Handle)
+		assert.Equal(t, schema.Drop(), rules[1].Expr[0].Verdict)
+	})
+
+	t.Run("Read a chain missing from the output", func(t *testing.T) {
+		useFakeRunner(t, `{"nftables":[]}`)
+
+		_, _, err := nftns.ReadChain(netNSPath, "ip", "filter", "input")
+		assert.EqualError(t, err, "failed to list chain: chain ip filter input not found in output")
+	})
+}
+
+func TestReadConfigFiltered(t *testing.T) {
+	const metainfo = `{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}}`
+	const tables = `{"nftables":[` + metainfo + `,` +
+		`{"table":{"family":"ip","name":"kube-filter","handle":1}},` +
+		`{"table":{"family":"inet","name":"kube-nat","handle":2}},` +
+		`{"table":{"family":"ip","name":"other","handle":3}}]}`
+
+	t.Run("Read the tables matching the family and name", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		runner.outputs = []string{tables, `{"nftables":[` + metainfo + `,` +
+			`{"table":{"family":"ip","name":"kube-filter","handle":1}},` +
+			`{"chain":{"family":"ip","table":"kube-filter","name":"input","handle":1}}]}`}
+
+		config, err := nftns.ReadConfigFiltered(netNSPath, nftns.TableFilter{Family: schema.FamilyIP, Name: "kube-*"})
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{
+			{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "tables")},
+			{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "table", "ip", "kube-filter")},
+		}, runner.invocations)
+		assert.Len(t, config.Nftables, 3)
+		assert.Equal(t, "input", config.Nftables[2].Chain.Name)
+	})
+
+	t.Run("Read the tables of all families, keeping a single metainfo", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		runner.outputs = []string{tables,
+			`{"nftables":[` + metainfo + `,{"table":{"family":"ip","name":"kube-filter","handle":1}}]}`,
+			`{"nftables":[` + metainfo + `,{"table":{"family":"inet","name":"kube-nat","handle":2}}]}`,
+		}
+
+		config, err := nftns.ReadConfigFiltered(netNSPath, nftns.TableFilter{Name: "kube-*"})
+		assert.NoError(t, err)
+		assert.Len(t, runner.invocations, 3)
+		assert.Len(t, config.Nftables, 3)
+		assert.NotNil(t, config.Nftables[0].Metainfo)
+		assert.Equal(t, "kube-nat", config.Nftables[2].Table.Name)
+	})
+
+	t.Run("Read no tables", func(t *testing.T) {
+		runner := useFakeRunner(t, tables)
+
+		config, err := nftns.ReadConfigFiltered(netNSPath, nftns.TableFilter{Family: schema.FamilyIP6})
+		assert.NoError(t, err)
+		assert.Len(t, runner.invocations, 1)
+		assert.True(t, config.IsEmpty())
+	})
+
+	t.Run("Reject a malformed name pattern", func(t *testing.T) {
+		useFakeRunner(t, tables)
+
+		_, err := nftns.ReadConfigFiltered(netNSPath, nftns.TableFilter{Name: "kube-["})
+		assert.Error(t, err)
+	})
+}
+
+func TestApplyConfigWithConfirm(t *testing.T) {
+	const liveRuleset = `{"nftables":[` +
+		`{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}},` +
+		`{"table":{"family":"ip","name":"filter","handle":1}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input","handle":1}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","handle":2,"expr":[{"accept":null}]}}]}`
+	const appliedConfig = `{"nftables":[{"flush":{"ruleset":null}},{"table":{"family":"ip","name":"other"}}]}`
+	const revertConfig = `{"nftables":[{"flush":{"ruleset":null}},` +
+		`{"table":{"family":"ip","name":"filter"}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input"}},` +
+		`{"rule":{"family":"ip","table":"filter","chain":"input","expr":[{"accept":null}]}}]}`
+	newConfig := func(t *testing.T) *nftns.Config {
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.FlushRuleset()
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "other"})
+		return c
+	}
+
+	t.Run("Apply a confirmed config", func(t *testing.T) {
+		runner := useFakeRunner(t, liveRuleset)
+
+		assert.NoError(t, nftns.ApplyConfigWithConfirm(context.Background(), newConfig(t), func() error { return nil }))
+		assert.Len(t, runner.invocations, 2)
+		assert.Equal(t, nftArgs("-j", "list", "ruleset"), runner.invocations[0].Args)
+		assert.Equal(t, appliedConfig, runner.invocations[1].Stdin)
+	})
+
+	t.Run("Apply a config which fails the confirmation", func(t *testing.T) {
+		runner := useFakeRunner(t, liveRuleset)
+		confirmErr := errors.New("no connectivity")
+
+		err := nftns.ApplyConfigWithConfirm(context.Background(), newConfig(t), func() error { return confirmErr })
+		assert.True(t, errors.Is(err, confirmErr), "unexpected error: %v", err)
+		assert.Len(t, runner.invocations, 3)
+		assert.Equal(t, appliedConfig, runner.invocations[1].Stdin)
+		assert.Equal(t, revertConfig, runner.invocations[2].Stdin)
+	})
+
+	t.Run("Apply a config which is not confirmed in time", func(t *testing.T) {
+		runner := useFakeRunner(t, liveRuleset)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		unblock := make(chan struct{})
+		defer close(unblock)
+
+		err := nftns.ApplyConfigWithConfirm(ctx, newConfig(t), func() error {
+			<-unblock
+			return nil
+		})
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+		assert.Len(t, runner.invocations, 3)
+		assert.Equal(t, revertConfig, runner.invocations[2].Stdin)
+	})
+
+	t.Run("Revert a snapshot which does not pass the apply validation", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[`+
+			`{"table":{"family":"ip","name":"filter","handle":1}},`+
+			`{"set":{"family":"ip","table":"filter","name":"blocklist","handle":2,"type":"ipv4_addr",`+
+			`"elem":[{"elem":{"val":"10.0.0.1","timeout":60,"expires":42}}]}}]}`)
+		confirmErr := errors.New("no connectivity")
+
+		err := nftns.ApplyConfigWithConfirm(context.Background(), newConfig(t), func() error { return confirmErr })
+		assert.EqualError(t, err, "ruleset reverted, not confirmed: no connectivity")
+		assert.Len(t, runner.invocations, 3)
+		assert.Equal(t, `{"nftables":[{"flush":{"ruleset":null}},`+
+			`{"table":{"family":"ip","name":"filter"}},`+
+			`{"set":{"family":"ip","table":"filter","name":"blocklist","type":"ipv4_addr",`+
+			`"elem":[{"elem":{"val":"10.0.0.1","timeout":60}}]}}]}`, runner.invocations[2].Stdin)
+	})
+}
+
+// failingRunner fails the commands it runs, with the given error output.
+type failingRunner struct {
+	errOutput string
+}
+
+func (r failingRunner) Run(_ context.Context, _ string, _ []string, _ io.Reader, _, stderr io.Writer) error {
+	_, _ = io.WriteString(stderr, r.errOutput)
+	return errors.New("exit status 1")
+}
+
+// endlessRunner writes the given output, then keeps writing until it is stopped.
+type endlessRunner struct {
+	output string
+}
+
+func (r endlessRunner) Run(ctx context.Context, _ string, _ []string, _ io.Reader, stdout, _ io.Writer) error {
+	if _, err := io.WriteString(stdout, r.output); err != nil {
+		return err
+	}
+	for ctx.Err() == nil {
+		if _, err := io.WriteString(stdout, " "); err != nil {
+			return err
+		}
+	}
+	return errors.New("signal: killed")
+}
+
+func TestReadMalformedOutputStopsTheCommand(t *testing.T) {
+	useFakeRunner(t, "")
+	nftns.CommandRunner = endlessRunner{output: `{"nftables":[{"table":{"family":"ip","name":"filter"}},{"table":]`}
+
+	t.Run("Read config", func(t *testing.T) {
+		_, err := nftns.ReadConfig(netNSPath)
+		var nftErr *nftns.NftError
+		assert.False(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+		assert.Contains(t, err.Error(), "failed to list ruleset")
+	})
+
+	t.Run("Walk set elements", func(t *testing.T) {
+		err := nftns.WalkSetElements(netNSPath, "ip", "filter", "blocklist", func(schema.Expression) error { return nil })
+		var nftErr *nftns.NftError
+		assert.False(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+		assert.Contains(t, err.Error(), "failed to decode set")
+	})
+}
+
+func TestApplyConfigOnExec(t *testing.T) {
+	type execution struct {
+		args  []string
+		stdin string
+		err   error
+	}
+	newConfig := func(t *testing.T, executions *[]execution) *nftns.Config {
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+		c.OnExec = func(args []string, stdin []byte, err error) {
+			*executions = append(*executions, execution{args: args, stdin: string(stdin), err: err})
+		}
+		return c
+	}
+
+	t.Run("Report the applied commands", func(t *testing.T) {
+		useFakeRunner(t, "")
+		var executions []execution
+
+		assert.NoError(t, nftns.ApplyConfig(newConfig(t, &executions)))
+		assert.Equal(t, []execution{{
+			args:  append([]string{"/usr/bin/nsenter"}, nftArgs("-j", "-f", "-")...),
+			stdin: `{"nftables":[{"table":{"family":"ip","name":"filter"}}]}`,
+		}}, executions)
+	})
+
+	t.Run("Report the failed commands", func(t *testing.T) {
+		useFakeRunner(t, "")
+		nftns.CommandRunner = failingRunner{errOutput: "Error: Could not process rule\n"}
+		var executions []execution
+
+		err := nftns.ApplyConfig(newConfig(t, &executions))
+		assert.Error(t, err)
+		assert.Len(t, executions, 1)
+		assert.Equal(t, err, executions[0].err)
+	})
+}
+
+func TestNetNSCommand(t *testing.T) {
+	// useIPBinPath sets the ip executable, restoring it and the nsenter command once the test is done.
+	useIPBinPath := func(t *testing.T, ipBinPath string) {
+		ip := nftns.IPBinPath
+		nftns.IPBinPath = ipBinPath
+		t.Cleanup(func() {
+			// The nsenter executable is not checked with a runner other than the local one.
+			runner := nftns.CommandRunner
+			nftns.CommandRunner = failingRunner{}
+			assert.NoError(t, nftns.SetNetNSCommand(nftns.NetNSCommandNSEnter))
+			nftns.CommandRunner, nftns.IPBinPath = runner, ip
+		})
+	}
+
+	t.Run("Execute nft by ip netns exec", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+		useIPBinPath(t, "/usr/sbin/ip")
+		assert.NoError(t, nftns.SetNetNSCommand(nftns.NetNSCommandIPNetNSExec))
+
+		_, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []invocation{{
+			Path: "/usr/sbin/ip",
+			Args: []string{"netns", "exec", "test", "/usr/sbin/nft", "-j", "list", "ruleset"},
+		}}, runner.invocations)
+	})
+
+	t.Run("Execute nft by ip netns exec with a namespace name", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+		useIPBinPath(t, "/usr/sbin/ip")
+		assert.NoError(t, nftns.SetNetNSCommand(nftns.NetNSCommandIPNetNSExec))
+
+		_, err := nftns.ReadConfig("blue")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"netns", "exec", "blue", "/usr/sbin/nft", "-j", "list", "ruleset"}, runner.invocations[0].Args)
+	})
+
+	t.Run("Set the command when available", func(t *testing.T) {
+		ipBinPath := filepath.Join(tempDir(t), "ip")
+		assert.NoError(t, ioutil.WriteFile(ipBinPath, []byte("#!/bin/sh\n"), 0700))
+		useIPBinPath(t, ipBinPath)
+
+		assert.NoError(t, nftns.SetNetNSCommand(nftns.NetNSCommandIPNetNSExec))
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+		_, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, ipBinPath, runner.invocations[0].Path)
+	})
+
+	t.Run("Reject the command when not available", func(t *testing.T) {
+		useIPBinPath(t, filepath.Join(tempDir(t), "ip"))
+
+		assert.Error(t, nftns.SetNetNSCommand(nftns.NetNSCommandIPNetNSExec))
+		assert.Error(t, nftns.SetNetNSCommand(nftns.NetNSCommand(42)))
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+		_, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, "/usr/bin/nsenter", runner.invocations[0].Path)
+	})
+
+	t.Run("Set the command of a remote runner without checking it", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[]}`)
+		useIPBinPath(t, filepath.Join(tempDir(t), "ip"))
+
+		assert.NoError(t, nftns.SetNetNSCommand(nftns.NetNSCommandIPNetNSExec))
+		_, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.Equal(t, nftns.IPBinPath, runner.invocations[0].Path)
+	})
+}
+
+func TestCreateExistingTable(t *testing.T) {
+	useFakeRunner(t, "")
+	nftns.CommandRunner = failingRunner{errOutput: "Error: Could not process rule: File exists\n"}
+	c, err := nftns.New(netNSPath)
+	assert.NoError(t, err)
+	c.CreateTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+
+	err = nftns.ApplyConfig(c)
+	assert.True(t, errors.Is(err, nftns.ErrExists), "unexpected error: %v", err)
+	var nftErr *nftns.NftError
+	assert.True(t, errors.As(err, &nftErr))
+}
+
+func TestReadSets(t *testing.T) {
+	t.Run("Read sets", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[`+
+			`{"set":{"family":"ip","table":"filter","name":"blocklist","handle":2,"type":"ipv4_addr","timeout":3600}},`+
+			`{"set":{"family":"ip6","table":"filter","name":"blocklist6","handle":3,"type":"ipv6_addr"}}]}`)
+
+		sets, err := nftns.ReadSets(netNSPath)
+		assert.NoError(t, err)
+		assert.Len(t, sets, 2)
+		assert.Equal(t, "blocklist", sets[0].Name)
+		assert.Equal(t, 3600, sets[0].Timeout)
+		assert.Equal(t, "blocklist6", sets[1].Name)
+		assert.Equal(t, []invocation{{Path: "/usr/bin/nsenter", Args: nftArgs("-j", "list", "sets")}}, runner.invocations)
+	})
+
+	t.Run("Read set", func(t *testing.T) {
+		runner := useFakeRunner(t, `{"nftables":[`+
+			`{"set":{"family":"ip","table":"filter","name":"blocklist","handle":2,"type":"ipv4_addr","flags":"timeout",`+
+			`"elem":[{"elem":{"val":"192.0.2.1","timeout":3600,"expires":3500,"comment":"botnet"}},"192.0.2.2"]}}]}`)
+
+		set, err := nftns.ReadSet(netNSPath, "ip", "filter", "blocklist")
+		assert.NoError(t, err)
+		assert.Len(t, set.Elem, 2)
+		assert.Equal(t, &schema.Elem{
+			Val: set.Elem[0].Elem.Val, Timeout: 3600, Expires: 3500, Comment: "botnet",
+		}, set.Elem[0].Elem)
+		assert.Equal(t, "192.0.2.1", *set.Elem[0].Elem.Val.String)
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "list", "set", "ip", "filter", "blocklist"),
+		}}, runner.invocations)
+	})
+
+	t.Run("Read missing set", func(t *testing.T) {
+		useFakeRunner(t, `{"nftables":[]}`)
+
+		_, err := nftns.ReadSet(netNSPath, "ip", "filter", "blocklist")
+		assert.Error(t, err)
+	})
+}
+
+func TestWalkSetElements(t *testing.T) {
+	const output = `{"nftables":[{"metainfo":{"version":"1.0.1","json_schema_version":1}},` +
+		`{"set":{"family":"ip","table":"filter","name":"blocklist","handle":2,"type":"ipv4_addr",` +
+		`"elem":["192.0.2.1",{"elem":{"val":"192.0.2.2","timeout":3600}},"192.0.2.3"],"flags":"timeout"}}]}`
+
+	t.Run("Walk all the elements", func(t *testing.T) {
+		runner := useFakeRunner(t, output)
+
+		var elements []schema.Expression
+		err := nftns.WalkSetElements(netNSPath, "ip", "filter", "blocklist", func(element schema.Expression) error {
+			elements = append(elements, element)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, elements, 3)
+		assert.Equal(t, "192.0.2.1", *elements[0].String)
+		assert.Equal(t, "192.0.2.2", *elements[1].Elem.Val.String)
+		assert.Equal(t, 3600, elements[1].Elem.Timeout)
+		assert.Equal(t, "192.0.2.3", *elements[2].String)
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "list", "set", "ip", "filter", "blocklist"),
+		}}, runner.invocations)
+	})
+
+	t.Run("Stop walking on a walk error", func(t *testing.T) {
+		useFakeRunner(t, output)
+		stop := errors.New("stop")
+
+		var walked int
+		err := nftns.WalkSetElements(netNSPath, "ip", "filter", "blocklist", func(schema.Expression) error {
+			walked++
+			return stop
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 1, walked)
+	})
+
+	t.Run("Walk a missing set", func(t *testing.T) {
+		useFakeRunner(t, `{"nftables":[]}`)
+
+		err := nftns.WalkSetElements(netNSPath, "ip", "filter", "blocklist", func(schema.Expression) error {
+			return nil
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Walk on a command failure", func(t *testing.T) {
+		useFakeRunner(t, "")
+		nftns.CommandRunner = failingRunner{errOutput: "Error: No such file or directory\n"}
+
+		err := nftns.WalkSetElements(netNSPath, "ip", "filter", "blocklist", func(schema.Expression) error {
+			return nil
+		})
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+	})
+}
+
+func TestDeleteElementsMatching(t *testing.T) {
+	const output = `{"nftables":[{"metainfo":{"version":"1.0.1","json_schema_version":1}},` +
+		`{"set":{"family":"ip","table":"filter","name":"blocklist","handle":2,"type":"ipv4_addr",` +
+		`"elem":["192.0.2.1",{"elem":{"val":"192.0.2.2","comment":"expired"}},"192.0.2.3"],"flags":"timeout"}}]}`
+
+	t.Run("Delete the matching elements", func(t *testing.T) {
+		runner := useFakeRunner(t, output)
+
+		err := nftns.DeleteElementsMatching(netNSPath, "ip", "filter", "blocklist", func(element schema.Expression) bool {
+			return element.Elem != nil && element.Elem.Comment == "expired"
+		})
+		assert.NoError(t, err)
+		assert.Len(t, runner.invocations, 2)
+		assert.Equal(t, nftArgs("-j", "list", "set", "ip", "filter", "blocklist"), runner.invocations[0].Args)
+		assert.Equal(t,
+			`{"nftables":[{"delete":{"element":{"family":"ip","table":"filter","name":"blocklist","elem":["192.0.2.2"]}}}]}`,
+			runner.invocations[1].Stdin,
+		)
+	})
+
+	t.Run("Delete no elements when none matches", func(t *testing.T) {
+		runner := useFakeRunner(t, output)
+
+		err := nftns.DeleteElementsMatching(netNSPath, "ip", "filter", "blocklist", func(schema.Expression) bool {
+			return false
+		})
+		assert.NoError(t, err)
+		assert.Len(t, runner.invocations, 1)
+	})
+
+	t.Run("Delete elements of a missing set", func(t *testing.T) {
+		useFakeRunner(t, `{"nftables":[]}`)
+
+		err := nftns.DeleteElementsMatching(netNSPath, "ip", "filter", "blocklist", func(schema.Expression) bool {
+			return true
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestApplyDir(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		dir := tempDir(t)
+		for name, data := range files {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600))
+		}
+		return dir
+	}
+
+	t.Run("Apply the merged config files, ordered by name", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		dir := writeFiles(t, map[string]string{
+			"20-web.json": `{"nftables":[{"metainfo":{"json_schema_version":1}},` +
+				`{"table":{"family":"inet","name":"filter"}},{"chain":{"family":"inet","table":"filter","name":"web"}}]}`,
+			"10-base.json": `{"nftables":[{"table":{"family":"inet","name":"filter"}}]}`,
+			"README.md":    "not a config file",
+		})
+
+		assert.NoError(t, nftns.ApplyDir(netNSPath, dir))
+		assert.Equal(t, []invocation{{
+			Path: "/usr/bin/nsenter",
+			Args: nftArgs("-j", "-f", "-"),
+			Stdin: `{"nftables":[{"table":{"family":"inet","name":"filter"}},` +
+				`{"chain":{"family":"inet","table":"filter","name":"web"}}]}`,
+		}}, runner.invocations)
+	})
+
+	t.Run("Apply conflicting config files", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		dir := writeFiles(t, map[string]string{
+			"a.json": `{"nftables":[{"chain":{"family":"inet","table":"filter","name":"input","type":"filter","hook":"input","prio":0}}]}`,
+			"b.json": `{"nftables":[{"chain":{"family":"inet","table":"filter","name":"input","type":"filter","hook":"output","prio":0}}]}`,
+		})
+
+		assert.Error(t, nftns.ApplyDir(netNSPath, dir))
+		assert.Empty(t, runner.invocations)
+	})
+
+	t.Run("Apply an invalid config file", func(t *testing.T) {
+		useFakeRunner(t, "")
+		dir := writeFiles(t, map[string]string{"a.json": `{"nftables":[`})
+
+		err := nftns.ApplyDir(netNSPath, dir)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "a.json")
+	})
+
+	t.Run("Apply a directory with no config file", func(t *testing.T) {
+		useFakeRunner(t, "")
+		assert.Error(t, nftns.ApplyDir(netNSPath, writeFiles(t, nil)))
+	})
+}
+
+func TestApplyConfigWithInvalidSet(t *testing.T) {
+	runner := useFakeRunner(t, "")
+	c, err := nftns.New(netNSPath)
+	assert.NoError(t, err)
+	c.AddSet(&schema.Set{Family: schema.FamilyIP, Table: "filter", Name: "blocklist", Type: schema.SetTypeIPv4Addr, GcInterval: 60})
+
+	assert.Error(t, nftns.ApplyConfig(c))
+	assert.Empty(t, runner.invocations)
+}
+
+// exitError is a command failure reported by a remote executor, with the exit code of the command.
+type exitError struct {
+	code int
+}
+
+func (e exitError) Error() string { return "remote command failed" }
+func (e exitError) ExitCode() int { return e.code }
+
+// remoteRunner forwards the commands to a remote executor, answering them with the given outputs.
+type remoteRunner struct {
+	fakeRunner
+	exitCode int
+}
+
+func (r *remoteRunner) Run(ctx context.Context, path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if err := r.fakeRunner.Run(ctx, path, args, stdin, stdout, stderr); err != nil {
+		return err
+	}
+	if r.exitCode != 0 {
+		return exitError{r.exitCode}
+	}
+	return nil
+}
+
+func TestRemoteRunner(t *testing.T) {
+	useRemoteRunner := func(t *testing.T, runner *remoteRunner) {
+		useFakeRunner(t, "")
+		nftns.CommandRunner, nftns.NSEnterBinPath, nftns.NFTBinPath = runner, "nsenter", "nft"
+
+		// The executables are not looked up locally.
+		path := os.Getenv("PATH")
+		assert.NoError(t, os.Setenv("PATH", ""))
+		t.Cleanup(func() { os.Setenv("PATH", path) })
+	}
+
+	t.Run("Read and apply configs through a remote runner", func(t *testing.T) {
+		runner := &remoteRunner{fakeRunner: fakeRunner{output: `{"nftables":[{"table":{"family":"ip","name":"filter"}}]}`}}
+		useRemoteRunner(t, runner)
+
+		c, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err)
+		assert.NoError(t, nftns.ApplyConfig(c))
+
+		args := []string{"--net=" + netNSPath, "--", "nft"}
+		assert.Equal(t, []invocation{
+			{Path: "nsenter", Args: append(args, "-j", "list", "ruleset")},
+			{Path: "nsenter", Args: append(args, "-j", "-f", "-"), Stdin: `{"nftables":[{"table":{"family":"ip","name":"filter"}}]}`},
+		}, runner.invocations)
+	})
+
+	t.Run("Report the exit code of a remote command", func(t *testing.T) {
+		useRemoteRunner(t, &remoteRunner{fakeRunner: fakeRunner{errOutput: "Error: Could not process rule\n"}, exitCode: nftns.ExitCodeNoNetlink})
+
+		_, err := nftns.ReadConfig(netNSPath)
+		var nftErr *nftns.NftError
+		assert.True(t, errors.As(err, &nftErr), "unexpected error: %v", err)
+		assert.Equal(t, nftns.ExitCodeNoNetlink, nftErr.ExitCode)
+	})
+}
+
+func TestCoalescingApplier(t *testing.T) {
+	runner := useFakeRunner(t, "")
+	applier := nftns.NewCoalescingApplier(500 * time.Millisecond)
+
+	configWithTable := func(name string) *nftns.Config {
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: name})
+		return c
+	}
+
+	assert.NoError(t, applier.Apply(configWithTable("t0")))
+	assert.Len(t, runner.invocations, 1, "the first request is expected to be applied immediately")
+
+	// The requests made within the interval are coalesced, the latest is applied.
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = applier.Apply(configWithTable(fmt.Sprintf("t%d", i+1)))
+		}(i)
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Len(t, runner.invocations, 2)
+	assert.Equal(t, `{"nftables":[{"table":{"family":"ip","name":"t5"}}]}`, runner.invocations[1].Stdin)
+}
+
+func TestApplyMode(t *testing.T) {
+	table := &schema.Table{Family: schema.FamilyIP, Name: "filter"}
+	chain := &schema.Chain{Family: schema.FamilyIP, Table: "filter", Name: "input"}
+	otherChain := &schema.Chain{Family: schema.FamilyIP, Table: "nat", Name: "postrouting"}
+
+	newConfig := func(t *testing.T) *nftns.Config {
+		c, err := nftns.New(netNSPath)
+		assert.NoError(t, err)
+		c.AddTable(table)
+		c.AddChain(chain)
+		c.AddChain(otherChain)
+		return c
+	}
+	const mergedConfig = `{"table":{"family":"ip","name":"filter"}},` +
+		`{"chain":{"family":"ip","table":"filter","name":"input"}},` +
+		`{"chain":{"family":"ip","table":"nat","name":"postrouting"}}`
+
+	t.Run("Merge by default", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		assert.NoError(t, nftns.ApplyConfig(newConfig(t)))
+		assert.Len(t, runner.invocations, 1)
+		assert.Equal(t, `{"nftables":[`+mergedConfig+`]}`, runner.invocations[0].Stdin)
+	})
+
+	replacedConfig := `{"nftables":[` +
+		`{"table":{"family":"ip","name":"filter"}},` +
+		`{"delete":{"table":{"family":"ip","name":"filter"}}},` +
+		mergedConfig + `]}`
+
+	t.Run("Replace the declared tables", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		assert.NoError(t, nftns.ApplyConfig(newConfig(t), nftns.WithMode(nftns.ModeReplace)))
+		assert.Len(t, runner.invocations, 1)
+		assert.Equal(t, replacedConfig, runner.invocations[0].Stdin)
+	})
+
+	t.Run("Replace by default", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		nftns.DefaultApplyMode = nftns.ModeReplace
+		defer func() { nftns.DefaultApplyMode = nftns.ModeMerge }()
+
+		assert.NoError(t, nftns.ApplyConfig(newConfig(t)))
+		assert.Len(t, runner.invocations, 1)
+		assert.Equal(t, replacedConfig, runner.invocations[0].Stdin)
+
+		assert.NoError(t, nftns.ApplyConfig(newConfig(t), nftns.WithMode(nftns.ModeMerge)))
+		assert.Equal(t, `{"nftables":[`+mergedConfig+`]}`, runner.invocations[1].Stdin)
+	})
+}
+
+func TestReadEmptyRuleset(t *testing.T) {
+	for _, output := range []string{
+		`{"nftables":[{"metainfo":{"version":"1.0.1","release_name":"Fearless Fosdick #3","json_schema_version":1}}]}`,
+		`{"nftables":[]}`,
+		"",
+		"\n",
+	} {
+		useFakeRunner(t, output)
+
+		config, err := nftns.ReadConfig(netNSPath)
+		assert.NoError(t, err, "output %q", output)
+		assert.True(t, config.IsEmpty(), "output %q", output)
+		assert.NotNil(t, config.Nftables)
+	}
+}
+
+func TestApplyConfigWithCountersOnAllRules(t *testing.T) {
+	runner := useFakeRunner(t, "")
+	c, err := nftns.New(netNSPath)
+	assert.NoError(t, err)
+
+	tcp := "tcp"
+	match := schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyL4proto}},
+		Right: schema.Expression{String: &tcp},
+	}}
+	counted := "counted"
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input", Expr: []schema.Statement{
+		match, {Verdict: schema.Accept()},
+	}})
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input", Expr: []schema.Statement{
+		match, {Counter: &schema.Counter{Packets: 1, Bytes: 60}}, {Verdict: schema.Drop()},
+	}})
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input", Expr: []schema.Statement{
+		{ObjectRef: schema.ObjectRef{CounterRef: &schema.Expression{String: &counted}}},
+	}})
+	c.AddRule(&schema.Rule{Family: schema.FamilyIP, Table: "filter", Chain: "input", Expr: []schema.Statement{match}})
+	serializedConfig, err := c.ToJSON()
+	assert.NoError(t, err)
+
+	const rule = `{"rule":{"family":"ip","table":"filter","chain":"input","expr":[`
+	const l4protoMatch = `{"match":{"op":"==","left":{"meta":{"key":"l4proto"}},"right":"tcp"}}`
+	expected := `{"nftables":[` +
+		rule + l4protoMatch + `,{"counter":{"packets":0,"bytes":0}},{"accept":null}]}},` +
+		rule + l4protoMatch + `,{"counter":{"packets":1,"bytes":60}},{"drop":null}]}},` +
+		rule + `{"counter":"counted"}]}},` +
+		rule + l4protoMatch + `,{"counter":{"packets":0,"bytes":0}}]}}]}`
+
+	assert.NoError(t, nftns.ApplyConfig(c, nftns.WithCountersOnAllRules()))
+	assert.Len(t, runner.invocations, 1)
+	assert.Equal(t, expected, runner.invocations[0].Stdin)
+
+	reserializedConfig, err := c.ToJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, string(serializedConfig), string(reserializedConfig), "the config is not expected to change")
+
+	t.Run("Apply the counted config again", func(t *testing.T) {
+		runner := useFakeRunner(t, "")
+		applied := nftns.Config{NetNSPath: netNSPath}
+		assert.NoError(t, applied.FromJSON([]byte(expected)))
+
+		assert.NoError(t, nftns.ApplyConfig(&applied, nftns.WithCountersOnAllRules()))
+		assert.Equal(t, expected, runner.invocations[0].Stdin)
+	})
+}
+
+func TestNewFromFile(t *testing.T) {
+	runner := useFakeRunner(t, "")
+	f, err := os.Open(os.DevNull)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	c, err := nftns.NewFromFile(f)
+	assert.NoError(t, err)
+	netNSFilePath := fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), f.Fd())
+	assert.Equal(t, netNSFilePath, c.NetNSPath)
+	assert.Equal(t, netNSFilePath, nftns.FileNetNSPath(f))
+
+	c.AddTable(&schema.Table{Family: schema.FamilyIP, Name: "filter"})
+	assert.NoError(t, nftns.ApplyConfig(c))
+	assert.Equal(t, []string{"--net=" + netNSFilePath, "--", "/usr/sbin/nft", "-j", "-f", "-"}, runner.invocations[0].Args)
+}
@@ -0,0 +1,165 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// errSetNotFound is returned by the set elements decoding when the output holds no set.
+var errSetNotFound = errors.New("set not found in output")
+
+// WalkSetElements lists the set on the system and calls walk with each of its elements, in the listed order.
+// The elements are decoded as streamed from nft, one at a time, without loading the whole set in memory.
+// Walking stops at the first walk error, which is returned as is.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func WalkSetElements(netNSPath, family, table, set string, walk func(schema.Expression) error) error {
+	c, err := New(netNSPath)
+	if err != nil {
+		return err
+	}
+
+	var stopErr error
+	_, err = streamCommand(c.plannedCommand(nil, cmdJSON, cmdList, cmdSet, family, table, set), func(stdout io.Reader) error {
+		err := decodeSetElements(json.NewDecoder(stdout), func(element schema.Expression) error {
+			stopErr = walk(element)
+			return stopErr
+		})
+		if err != nil && err != stopErr && err != errSetNotFound {
+			return decodeSetError(err)
+		}
+		return err
+	})
+	if stopErr != nil {
+		// The command failure, if any, is a consequence of stopping it.
+		return stopErr
+	}
+	if errors.Is(err, errSetNotFound) {
+		return fmt.Errorf("failed to list set: set %s %s %s not found in output", family, table, set)
+	}
+	return err
+}
+
+// decodeSetElements decodes the `{"nftables":[...]}` listing of a set, calling walk with each set element.
+// The entries other than the set, and the set attributes, are skipped.
+func decodeSetElements(decoder *json.Decoder, walk func(schema.Expression) error) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	found := false
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key != "nftables" {
+			if err := skipValue(decoder); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+		for decoder.More() {
+			isSet, err := decodeSetEntry(decoder, walk)
+			if err != nil {
+				return err
+			}
+			found = found || isSet
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errSetNotFound
+	}
+	return nil
+}
+
+// decodeSetEntry decodes an entry of the listing, calling walk with the elements if it is a set.
+func decodeSetEntry(decoder *json.Decoder, walk func(schema.Expression) error) (bool, error) {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return false, err
+	}
+	isSet := false
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return false, err
+		}
+		if key != cmdSet {
+			if err := skipValue(decoder); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		isSet = true
+		if err := expectDelim(decoder, '{'); err != nil {
+			return false, err
+		}
+		for decoder.More() {
+			attribute, err := decoder.Token()
+			if err != nil {
+				return false, err
+			}
+			if attribute != "elem" {
+				if err := skipValue(decoder); err != nil {
+					return false, err
+				}
+				continue
+			}
+			if err := decodeElements(decoder, walk); err != nil {
+				return false, err
+			}
+		}
+		if err := expectDelim(decoder, '}'); err != nil {
+			return false, err
+		}
+	}
+	return isSet, expectDelim(decoder, '}')
+}
+
+// decodeElements decodes the array of set elements, calling walk with each element.
+func decodeElements(decoder *json.Decoder, walk func(schema.Expression) error) error {
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		var element schema.Expression
+		if err := decoder.Decode(&element); err != nil {
+			return err
+		}
+		if err := walk(element); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+func decodeSetError(err error) error {
+	return fmt.Errorf("failed to decode set: %v", err)
+}
@@ -0,0 +1,150 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// ApplyLogLevel is the level at which a summary of each applied config is logged,
+// listing the added, deleted and flushed objects.
+// Set it to zerolog.Disabled to disable the summary.
+var ApplyLogLevel = zerolog.DebugLevel
+
+const (
+	actionAdd    = "add"
+	actionCreate = "create"
+	actionDelete = "delete"
+	actionFlush  = "flush"
+)
+
+// logApplySummary logs the objects changed by the applied config, per action.
+// Rules are summarized by their count per chain, to keep the summary concise.
+func logApplySummary(c *Config) {
+	if ApplyLogLevel == zerolog.Disabled {
+		return
+	}
+
+	summary := map[string][]string{}
+	ruleCounts := map[string]map[string]int{}
+	ruleChains := map[string][]string{}
+	describe := func(action string, objects schema.Objects) {
+		if r := objects.Rule; r != nil {
+			chain := fmt.Sprintf("%s %s %s", r.Family, r.Table, r.Chain)
+			if ruleCounts[action] == nil {
+				ruleCounts[action] = map[string]int{}
+			}
+			if ruleCounts[action][chain] == 0 {
+				ruleChains[action] = append(ruleChains[action], chain)
+			}
+			ruleCounts[action][chain]++
+			return
+		}
+		if description := describeObjects(objects); description != "" {
+			summary[action] = append(summary[action], description)
+		}
+	}
+
+	for _, nftable := range c.Nftables {
+		switch {
+		case nftable.Add != nil:
+			describe(actionAdd, *nftable.Add)
+		case nftable.Create != nil:
+			describe(actionCreate, *nftable.Create)
+		case nftable.Delete != nil:
+			describe(actionDelete, *nftable.Delete)
+		case nftable.Flush != nil:
+			describe(actionFlush, *nftable.Flush)
+		default:
+			describe(actionAdd, nftableObjects(nftable))
+		}
+	}
+	for action, chains := range ruleChains {
+		for _, chain := range chains {
+			summary[action] = append(summary[action], fmt.Sprintf("%d rule(s) in chain %s", ruleCounts[action][chain], chain))
+		}
+	}
+
+	event := Logger.WithLevel(ApplyLogLevel).Str("netns", c.NetNSPath)
+	for _, action := range []string{actionAdd, actionCreate, actionDelete, actionFlush} {
+		if len(summary[action]) > 0 {
+			event = event.Strs(action, summary[action])
+		}
+	}
+	event.Msg("Applied nftables config")
+}
+
+// nftableObjects returns the objects of a config entry without an explicit action.
+func nftableObjects(nftable schema.Nftable) schema.Objects {
+	return schema.Objects{
+		Table:         nftable.Table,
+		Chain:         nftable.Chain,
+		Rule:          nftable.Rule,
+		Set:           nftable.Set,
+		Map:           nftable.Map,
+		Element:       nftable.Element,
+		Secmark:       nftable.Secmark,
+		CtHelper:      nftable.CtHelper,
+		CtExpectation: nftable.CtExpectation,
+		CtTimeout:     nftable.CtTimeout,
+		Counter:       nftable.Counter,
+		Quota:         nftable.Quota,
+		Limit:         nftable.Limit,
+		Synproxy:      nftable.Synproxy,
+	}
+}
+
+// describeObjects returns a short description of the object, e.g. `table ip filter`.
+// Rules are not described, being summarized separately.
+func describeObjects(o schema.Objects) string {
+	switch {
+	case o.Ruleset:
+		return "ruleset"
+	case o.Table != nil:
+		return fmt.Sprintf("table %s %s", o.Table.Family, o.Table.Name)
+	case o.Chain != nil:
+		return fmt.Sprintf("chain %s %s %s", o.Chain.Family, o.Chain.Table, o.Chain.Name)
+	case o.Set != nil:
+		return fmt.Sprintf("set %s %s %s", o.Set.Family, o.Set.Table, o.Set.Name)
+	case o.Map != nil:
+		return fmt.Sprintf("map %s %s %s", o.Map.Family, o.Map.Table, o.Map.Name)
+	case o.Element != nil:
+		return fmt.Sprintf("%d element(s) of %s %s %s", len(o.Element.Elem), o.Element.Family, o.Element.Table, o.Element.Name)
+	case o.Secmark != nil:
+		return fmt.Sprintf("secmark %s %s %s", o.Secmark.Family, o.Secmark.Table, o.Secmark.Name)
+	case o.CtHelper != nil:
+		return fmt.Sprintf("ct helper %s %s %s", o.CtHelper.Family, o.CtHelper.Table, o.CtHelper.Name)
+	case o.CtExpectation != nil:
+		return fmt.Sprintf("ct expectation %s %s %s", o.CtExpectation.Family, o.CtExpectation.Table, o.CtExpectation.Name)
+	case o.CtTimeout != nil:
+		return fmt.Sprintf("ct timeout %s %s %s", o.CtTimeout.Family, o.CtTimeout.Table, o.CtTimeout.Name)
+	case o.Counter != nil:
+		return fmt.Sprintf("counter %s %s %s", o.Counter.Family, o.Counter.Table, o.Counter.Name)
+	case o.Quota != nil:
+		return fmt.Sprintf("quota %s %s %s", o.Quota.Family, o.Quota.Table, o.Quota.Name)
+	case o.Limit != nil:
+		return fmt.Sprintf("limit %s %s %s", o.Limit.Family, o.Limit.Table, o.Limit.Name)
+	case o.Synproxy != nil:
+		return fmt.Sprintf("synproxy %s %s %s", o.Synproxy.Family, o.Synproxy.Table, o.Synproxy.Name)
+	}
+	return ""
+}
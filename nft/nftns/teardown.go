@@ -0,0 +1,140 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"fmt"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// DeleteConfigObjects deletes from the system the objects defined by the given config,
+// undoing its application while leaving other objects as is.
+// The objects are deleted in a single transaction, in dependency order:
+// rules, set and map elements, chains, sets, maps and named objects, and last the tables.
+// A deleted table takes along all the objects it holds, including ones not defined by the config.
+// Rules are deleted by their handles, discovered by looking up equal rules in their chain on the system
+// (as by DeleteRuleMatching), where each equal rule of the config consumes one rule of the system.
+// Entries with an explicit action (e.g. `flush`) are not considered.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func DeleteConfigObjects(c *Config) error {
+	deleteConfig, err := New(c.NetNSPath)
+	if err != nil {
+		return err
+	}
+	deleteConfig.PreserveCredentials = c.PreserveCredentials
+	deleteConfig.NoFork = c.NoFork
+
+	if err := deleteRulesByHandle(deleteConfig, c.Nftables); err != nil {
+		return err
+	}
+	for _, nftable := range c.Nftables {
+		if nftable.Element != nil {
+			deleteConfig.DeleteElements(nftable.Element)
+		}
+	}
+	for i := len(c.Nftables) - 1; i >= 0; i-- {
+		if chain := c.Nftables[i].Chain; chain != nil {
+			deleteConfig.DeleteChain(&schema.Chain{Family: chain.Family, Table: chain.Table, Name: chain.Name})
+		}
+	}
+	for _, nftable := range c.Nftables {
+		deleteObject(deleteConfig, nftable)
+	}
+	for _, nftable := range c.Nftables {
+		if nftable.Table != nil {
+			deleteConfig.DeleteTable(&schema.Table{Family: nftable.Table.Family, Name: nftable.Table.Name})
+		}
+	}
+
+	if len(deleteConfig.Nftables) == 0 {
+		return nil
+	}
+	return ApplyConfig(deleteConfig)
+}
+
+type chainKey struct {
+	family, table, chain string
+}
+
+// deleteRulesByHandle adds the deletion of the rules, by the handles of their equals on the system.
+func deleteRulesByHandle(deleteConfig *Config, nftables []schema.Nftable) error {
+	liveRules := map[chainKey][]schema.Rule{}
+	for _, nftable := range nftables {
+		r := nftable.Rule
+		if r == nil {
+			continue
+		}
+
+		key := chainKey{r.Family, r.Table, r.Chain}
+		rules, exists := liveRules[key]
+		if !exists {
+			var err error
+			if _, rules, err = ReadChain(deleteConfig.NetNSPath, r.Family, r.Table, r.Chain); err != nil {
+				return err
+			}
+		}
+
+		matches := matchingRules(r.Family, r.Table, r.Chain, rules, *r)
+		if len(matches) == 0 || matches[0].Handle == nil {
+			return fmt.Errorf("failed to delete config objects: no matching rule found in chain %s %s %s",
+				r.Family, r.Table, r.Chain)
+		}
+		handle := matches[0].Handle
+		deleteConfig.DeleteRule(&schema.Rule{Family: r.Family, Table: r.Table, Chain: r.Chain, Handle: handle})
+		liveRules[key] = withoutRuleHandle(rules, *handle)
+	}
+	return nil
+}
+
+// withoutRuleHandle returns the rules, excluding the rule with the given handle.
+func withoutRuleHandle(rules []schema.Rule, handle int) []schema.Rule {
+	remaining := make([]schema.Rule, 0, len(rules))
+	for _, r := range rules {
+		if r.Handle == nil || *r.Handle != handle {
+			remaining = append(remaining, r)
+		}
+	}
+	return remaining
+}
+
+// deleteObject adds the deletion of the set, map or named object entry.
+func deleteObject(deleteConfig *Config, nftable schema.Nftable) {
+	switch {
+	case nftable.Set != nil:
+		deleteConfig.DeleteSet(nftable.Set)
+	case nftable.Map != nil:
+		deleteConfig.DeleteMap(nftable.Map)
+	case nftable.Secmark != nil:
+		deleteConfig.DeleteSecmark(nftable.Secmark)
+	case nftable.CtHelper != nil:
+		deleteConfig.DeleteCtHelper(nftable.CtHelper)
+	case nftable.CtExpectation != nil:
+		deleteConfig.DeleteCtExpectation(nftable.CtExpectation)
+	case nftable.CtTimeout != nil:
+		deleteConfig.DeleteCtTimeout(nftable.CtTimeout)
+	case nftable.Counter != nil:
+		deleteConfig.DeleteCounterObject(nftable.Counter)
+	case nftable.Quota != nil:
+		deleteConfig.DeleteQuotaObject(nftable.Quota)
+	case nftable.Limit != nil:
+		deleteConfig.DeleteLimitObject(nftable.Limit)
+	case nftable.Synproxy != nil:
+		deleteConfig.DeleteSynproxyObject(nftable.Synproxy)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// WaitPollInterval is the interval at which the system is polled by WaitForChain and WaitForRuleMatching.
+var WaitPollInterval = 100 * time.Millisecond
+
+// WaitForChain waits until the given chain is present on the system, polling it at the WaitPollInterval.
+// An error is returned if the context is done before the chain is present, wrapping the context error
+// and describing the last failure to read the chain.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func WaitForChain(ctx context.Context, netNSPath, family, table, chain string) error {
+	return poll(ctx, func() (bool, error) {
+		_, _, err := ReadChain(netNSPath, family, table, chain)
+		return err == nil, err
+	}, fmt.Sprintf("chain %s %s %s", family, table, chain))
+}
+
+// WaitForRuleMatching waits until a rule equal to the given one is present in the chain on the system,
+// polling it at the WaitPollInterval.
+// The rules are compared as by DeleteRuleMatching, not considering the rule handle, index and counter values.
+// An error is returned if the context is done before the rule is present, wrapping the context error.
+// The system is expected to have the `nft` executable deployed and nftables enabled in the kernel.
+func WaitForRuleMatching(ctx context.Context, netNSPath, family, table, chain string, r schema.Rule) error {
+	return poll(ctx, func() (bool, error) {
+		_, rules, err := ReadChain(netNSPath, family, table, chain)
+		if err != nil {
+			return false, err
+		}
+		return len(matchingRules(family, table, chain, rules, r)) > 0, nil
+	}, fmt.Sprintf("rule in chain %s %s %s", family, table, chain))
+}
+
+// poll calls the condition at the WaitPollInterval until it is met or the context is done.
+// The condition error is not final, it is reported only if the context is done.
+func poll(ctx context.Context, condition func() (bool, error), description string) error {
+	ticker := time.NewTicker(WaitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		done, err := condition()
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("failed waiting for %s: %w (last error: %v)", description, ctx.Err(), err)
+			}
+			return fmt.Errorf("failed waiting for %s: %w", description, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
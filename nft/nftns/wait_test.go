@@ -0,0 +1,102 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftns_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+
+	"github.com/networkplumbing/go-nft/nft/nftns"
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// sequenceRunner answers the commands it runs with the given outputs in order, repeating the last one.
+// An empty output fails the command.
+type sequenceRunner struct {
+	outputs []string
+	calls   int
+}
+
+func (r *sequenceRunner) Run(_ context.Context, _ string, _ []string, _ io.Reader, stdout, _ io.Writer) error {
+	output := r.outputs[len(r.outputs)-1]
+	if r.calls < len(r.outputs) {
+		output = r.outputs[r.calls]
+	}
+	r.calls++
+	if output == "" {
+		return errors.New("No such file or directory")
+	}
+	_, err := io.WriteString(stdout, output)
+	return err
+}
+
+func useSequenceRunner(t *testing.T, outputs ...string) *sequenceRunner {
+	runner := &sequenceRunner{outputs: outputs}
+	commandRunner, pollInterval := nftns.CommandRunner, nftns.WaitPollInterval
+	nftns.CommandRunner, nftns.WaitPollInterval = runner, time.Millisecond
+	t.Cleanup(func() {
+		nftns.CommandRunner, nftns.WaitPollInterval = commandRunner, pollInterval
+	})
+	return runner
+}
+
+func TestWait(t *testing.T) {
+	const chain = `{"chain":{"family":"ip","table":"filter","name":"input","handle":1}}`
+	const rule = `{"rule":{"family":"ip","table":"filter","chain":"input","handle":2,` +
+		`"expr":[{"counter":{"packets":1,"bytes":60}},{"accept":null}]}}`
+	toFind := schema.Rule{Expr: []schema.Statement{{Counter: &schema.Counter{}}, {Verdict: schema.Accept()}}}
+
+	t.Run("Wait for a chain which appears", func(t *testing.T) {
+		runner := useSequenceRunner(t, "", "", `{"nftables":[`+chain+`]}`)
+
+		assert.NoError(t, nftns.WaitForChain(context.Background(), netNSPath, "ip", "filter", "input"))
+		assert.Equal(t, 3, runner.calls)
+	})
+
+	t.Run("Wait for a chain which does not appear", func(t *testing.T) {
+		useSequenceRunner(t, "")
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		err := nftns.WaitForChain(ctx, netNSPath, "ip", "filter", "input")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+		assert.Contains(t, err.Error(), "No such file or directory")
+	})
+
+	t.Run("Wait for a rule which appears", func(t *testing.T) {
+		runner := useSequenceRunner(t, `{"nftables":[`+chain+`]}`, `{"nftables":[`+chain+`,`+rule+`]}`)
+
+		assert.NoError(t, nftns.WaitForRuleMatching(context.Background(), netNSPath, "ip", "filter", "input", toFind))
+		assert.Equal(t, 2, runner.calls)
+	})
+
+	t.Run("Wait for a rule which does not appear", func(t *testing.T) {
+		useSequenceRunner(t, `{"nftables":[`+chain+`,`+rule+`]}`)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		drop := schema.Rule{Expr: []schema.Statement{{Verdict: schema.Drop()}}}
+		err := nftns.WaitForRuleMatching(ctx, netNSPath, "ip", "filter", "input", drop)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	})
+}
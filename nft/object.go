@@ -0,0 +1,100 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package nft
+
+import (
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// NewSecmark returns a new schema secmark object structure.
+// The context is the SELinux security context, e.g. `system_u:object_r:ssh_server_packet_t:s0`.
+func NewSecmark(table *schema.Table, name string, context string) *schema.Secmark {
+	return &schema.Secmark{
+		Family:  table.Family,
+		Table:   table.Name,
+		Name:    name,
+		Context: context,
+	}
+}
+
+// SecmarkSet returns a statement which sets the packet secmark from the named secmark object.
+func SecmarkSet(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{Secmark: &schema.Expression{String: &name}}}
+}
+
+// NewCtHelper returns a new schema ct helper object structure.
+// The helper type is the kernel helper name (e.g. `ftp`) and the protocol is the layer 4 protocol (e.g. `tcp`).
+func NewCtHelper(table *schema.Table, name string, helperType string, protocol string) *schema.CtHelper {
+	return &schema.CtHelper{
+		Family:   table.Family,
+		Table:    table.Name,
+		Name:     name,
+		Type:     helperType,
+		Protocol: protocol,
+	}
+}
+
+// CtHelperSet returns a statement which assigns the named ct helper object to the connection.
+func CtHelperSet(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{CtHelper: &schema.Expression{String: &name}}}
+}
+
+// CtExpectationSet returns a statement which assigns the named ct expectation object to the connection.
+func CtExpectationSet(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{CtExpectation: &schema.Expression{String: &name}}}
+}
+
+// NewCtTimeout returns a new schema ct timeout object structure.
+// The protocol is the layer 4 protocol (e.g. `tcp`) and the policy maps its connection states
+// (e.g. `established`) to their timeout, in seconds.
+func NewCtTimeout(table *schema.Table, name string, protocol string, policy map[string]int) *schema.CtTimeout {
+	return &schema.CtTimeout{
+		Family:   table.Family,
+		Table:    table.Name,
+		Name:     name,
+		Protocol: protocol,
+		Policy:   policy,
+	}
+}
+
+// CtTimeoutSet returns a statement which assigns the named ct timeout object to the connection.
+func CtTimeoutSet(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{CtTimeout: &schema.Expression{String: &name}}}
+}
+
+// CounterRef returns a statement which counts packets in the named counter object.
+func CounterRef(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{CounterRef: &schema.Expression{String: &name}}}
+}
+
+// QuotaRef returns a statement which matches packets against the named quota object.
+func QuotaRef(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{QuotaRef: &schema.Expression{String: &name}}}
+}
+
+// LimitRef returns a statement which matches packets against the named limit object.
+func LimitRef(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{LimitRef: &schema.Expression{String: &name}}}
+}
+
+// SynproxyRef returns a statement which applies the named synproxy object.
+func SynproxyRef(name string) schema.Statement {
+	return schema.Statement{ObjectRef: schema.ObjectRef{SynproxyRef: &schema.Expression{String: &name}}}
+}
@@ -20,6 +20,9 @@
 package nft
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/networkplumbing/go-nft/nft/schema"
 )
 
@@ -56,3 +59,59 @@ func (i *RuleIndex) Next() *int {
 	var index = int(*i)
 	return &index
 }
+
+// AppendStatements appends the statements to the rule expression.
+// An error is returned if a statement follows a terminal one, which is never evaluated:
+// the accept, drop, return and goto verdicts, reject, the nat statements (snat, dnat, masquerade and redirect)
+// and queue. The rule is left unchanged on error.
+func AppendStatements(rule *schema.Rule, statements ...schema.Statement) error {
+	expr := rule.Expr
+	for _, statement := range statements {
+		if len(expr) > 0 && isTerminal(expr[len(expr)-1]) {
+			return fmt.Errorf("statement %s follows the terminal %s statement of the rule, it would never be evaluated",
+				statementString(statement), statementString(expr[len(expr)-1]))
+		}
+		expr = append(expr, statement)
+	}
+	rule.Expr = expr
+	return nil
+}
+
+// LogAndVerdict returns the log statement followed by the terminal verdict (`log prefix "dropped: " drop`),
+// to be appended as a unit to a rule, e.g. by AppendStatements, ensuring the logged packets are the ones applied
+// the verdict. The verdict is a drop or reject statement, or another terminal statement (e.g. accept or masquerade).
+// An error is returned if the verdict is not terminal.
+func LogAndVerdict(log schema.Log, verdict schema.Statement) ([]schema.Statement, error) {
+	if !isTerminal(verdict) {
+		return nil, fmt.Errorf("statement %s is not a terminal verdict", statementString(verdict))
+	}
+	return []schema.Statement{{Log: &log}, verdict}, nil
+}
+
+// isTerminal reports whether the statement ends the evaluation of the rule.
+// The queue statement, not part of the schema, is recognized as a RowData statement.
+func isTerminal(statement schema.Statement) bool {
+	return statement.Accept || statement.Drop || statement.Return || statement.Goto != nil || statement.Reject != nil ||
+		statement.Snat != nil || statement.Dnat != nil || statement.Masquerade != nil || statement.Redirect != nil ||
+		isRowDataQueue(statement.RowData)
+}
+
+func isRowDataQueue(data json.RawMessage) bool {
+	if len(data) == 0 {
+		return false
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return false
+	}
+	_, queue := keys["queue"]
+	return queue
+}
+
+func statementString(statement schema.Statement) string {
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Sprintf("%+v", statement)
+	}
+	return string(data)
+}
@@ -19,6 +19,11 @@
 
 package schema
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // Chain Types
 const (
 	TypeFilter = "filter"
@@ -36,6 +41,9 @@ const (
 	HookIngress     = "ingress"
 )
 
+// ChainPolicy is the policy of a base chain, the verdict of the packets reaching its end.
+type ChainPolicy string
+
 // Chain Policies
 const (
 	PolicyAccept = "accept"
@@ -50,4 +58,148 @@ type Chain struct {
 	Hook   string `json:"hook,omitempty"`
 	Prio   *int   `json:"prio,omitempty"`
 	Policy string `json:"policy,omitempty"`
+	// Comment is a free text attached to the chain (requires nft 0.9.7 or newer).
+	Comment string `json:"comment,omitempty"`
+	// PrioName is the named priority the chain was read with (e.g. `filter + 10`), empty for a numeric one.
+	// It is serialized in place of the numeric priority as long as it resolves to it, or as is when
+	// it does not resolve (e.g. a name not valid on the hook of the chain), leaving the numeric priority unset.
+	PrioName string `json:"-"`
+}
+
+// SetPolicy sets the policy of a base chain.
+// A policy is applicable only to base chains, therefore an error is returned
+// if the chain has no hook defined (the kernel ignores a policy set on a regular chain).
+func (c *Chain) SetPolicy(policy ChainPolicy) error {
+	if policy != PolicyAccept && policy != PolicyDrop {
+		return fmt.Errorf("invalid chain policy %q, expected %q or %q", policy, PolicyAccept, PolicyDrop)
+	}
+	if c.Hook == "" {
+		return fmt.Errorf("chain %s %s %s is not a base chain, a policy requires a hook", c.Family, c.Table, c.Name)
+	}
+	c.Policy = string(policy)
+	return nil
+}
+
+// chainTypeHooks lists the hooks each chain type supports, per address family.
+var chainTypeHooks = map[string]map[string][]string{
+	TypeFilter: {
+		FamilyIP:     {HookPreRouting, HookInput, HookForward, HookOutput, HookPostRouting},
+		FamilyIP6:    {HookPreRouting, HookInput, HookForward, HookOutput, HookPostRouting},
+		FamilyINET:   {HookPreRouting, HookInput, HookForward, HookOutput, HookPostRouting, HookIngress},
+		FamilyARP:    {HookInput, HookOutput},
+		FamilyBridge: {HookPreRouting, HookInput, HookForward, HookOutput, HookPostRouting},
+		FamilyNETDEV: {HookIngress},
+	},
+	TypeNAT: {
+		FamilyIP:   {HookPreRouting, HookInput, HookOutput, HookPostRouting},
+		FamilyIP6:  {HookPreRouting, HookInput, HookOutput, HookPostRouting},
+		FamilyINET: {HookPreRouting, HookInput, HookOutput, HookPostRouting},
+	},
+	TypeRoute: {
+		FamilyIP:   {HookOutput},
+		FamilyIP6:  {HookOutput},
+		FamilyINET: {HookOutput},
+	},
+}
+
+// Validate checks that a base chain type is supported by the family and the hook,
+// e.g. a `route` chain is supported only on the output hook of the ip, ip6 and inet families.
+// A regular chain (with no type and hook) is valid, while a base chain requires both.
+func (c *Chain) Validate() error {
+	if c.Type == "" && c.Hook == "" {
+		return nil
+	}
+	if c.Type == "" || c.Hook == "" {
+		return fmt.Errorf("chain %s %s %s is a base chain, both a type and a hook are required", c.Family, c.Table, c.Name)
+	}
+
+	familyHooks, ok := chainTypeHooks[c.Type]
+	if !ok {
+		return fmt.Errorf("chain %s %s %s: invalid chain type %q", c.Family, c.Table, c.Name, c.Type)
+	}
+	hooks, ok := familyHooks[c.Family]
+	if !ok {
+		return fmt.Errorf("chain %s %s %s: chain type %q is not supported by the %s family", c.Family, c.Table, c.Name, c.Type, c.Family)
+	}
+	for _, hook := range hooks {
+		if hook == c.Hook {
+			return nil
+		}
+	}
+	return fmt.Errorf("chain %s %s %s: chain type %q is not supported on the %s hook, supported hooks: %v",
+		c.Family, c.Table, c.Name, c.Type, c.Hook, hooks)
+}
+
+func (c Chain) MarshalJSON() ([]byte, error) {
+	type _Chain Chain
+	name := c.namedPrio()
+	if name == "" {
+		return json.Marshal(_Chain(c))
+	}
+
+	chain := struct {
+		_Chain
+		Prio string `json:"prio"`
+	}{_Chain: _Chain(c), Prio: name}
+
+	return json.Marshal(chain)
+}
+
+func (c *Chain) UnmarshalJSON(data []byte) error {
+	type _Chain Chain
+	chain := struct {
+		*_Chain
+		Prio json.RawMessage `json:"prio,omitempty"`
+	}{_Chain: (*_Chain)(c)}
+
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return err
+	}
+	c.Prio, c.PrioName = nil, ""
+	if chain.Prio == nil || string(chain.Prio) == "null" {
+		return nil
+	}
+
+	// A named priority (e.g. "filter + 10") is resolved by the family and hook of the chain,
+	// and kept as is when it does not resolve.
+	var name string
+	if err := json.Unmarshal(chain.Prio, &name); err == nil {
+		if priority, err := ParseChainPriority(name); err == nil && priority.Name != "" {
+			c.PrioName = name
+			if value, err := priority.Value(c.Family, c.Hook); err == nil {
+				c.Prio = &value
+			}
+			return nil
+		}
+	}
+	var prio number
+	if err := json.Unmarshal(chain.Prio, &prio); err != nil {
+		return err
+	}
+	c.Prio = prio.intPtr()
+
+	return nil
+}
+
+// namedPrio returns the named priority the chain is serialized with, empty if it is serialized
+// with its numeric priority.
+func (c *Chain) namedPrio() string {
+	if c.PrioName == "" {
+		return ""
+	}
+	priority, err := ParseChainPriority(c.PrioName)
+	if err != nil {
+		return ""
+	}
+	value, err := priority.Value(c.Family, c.Hook)
+	if err != nil {
+		if c.Prio == nil {
+			return c.PrioName
+		}
+		return ""
+	}
+	if c.Prio != nil && *c.Prio == value {
+		return c.PrioName
+	}
+	return ""
 }
@@ -0,0 +1,355 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net"
+	"sort"
+)
+
+// intervalKind is the kind of values an interval spans, intervals of different kinds are not comparable.
+type intervalKind int
+
+const (
+	intervalNumber intervalKind = iota
+	intervalIPv4
+	intervalIPv6
+)
+
+// interval is an inclusive range of values, as big-endian 128 bits integers.
+type interval struct {
+	kind intervalKind
+	low  [16]byte
+	high [16]byte
+}
+
+// Deduplicate removes the duplicate elements of the set, keeping the first occurrence of each.
+// For interval sets, the elements which overlap or are adjacent are merged as well, into a single element
+// (an address, a prefix or a range) at the position of the first merged element.
+// The address, prefix, range and numeric elements are merged, other elements (e.g. with attributes) are kept as is.
+// It returns the removed elements, including the ones replaced by a merged element.
+func (s *Set) Deduplicate() []Expression {
+	elements, removed := uniqueElements(s.Elem)
+	if s.Flags != nil && hasFlag(s.Flags.Flags, SetFlagInterval) {
+		var merged []Expression
+		elements, merged = mergeIntervals(elements)
+		removed = append(removed, merged...)
+	}
+	s.Elem = elements
+	return removed
+}
+
+// SortIntervals orders the address, prefix, range and numeric elements by their low value, as nft expects
+// the elements of an interval set to be inserted.
+// Elements with attributes are ordered by their value, other elements are kept after the interval ones, in their order.
+// The elements are sorted in place, the values are not merged.
+func (e *Element) SortIntervals() {
+	intervals := make([]interval, len(e.Elem))
+	isInterval := make([]bool, len(e.Elem))
+	for i, element := range e.Elem {
+		intervals[i], isInterval[i] = elementInterval(elementValue(element))
+	}
+
+	indexes := make([]int, len(e.Elem))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		ia, ib := indexes[a], indexes[b]
+		if isInterval[ia] != isInterval[ib] {
+			return isInterval[ia]
+		}
+		return isInterval[ia] && intervals[ia].less(intervals[ib])
+	})
+
+	sorted := make([]Expression, len(e.Elem))
+	for i, index := range indexes {
+		sorted[i] = e.Elem[index]
+	}
+	copy(e.Elem, sorted)
+}
+
+// IntervalOverlap returns the first two elements found to overlap, which nft rejects from interval sets
+// without auto-merge. Adjacent elements do not overlap.
+// It reports false if no address, prefix, range or numeric elements overlap, other elements being ignored.
+func (e *Element) IntervalOverlap() (Expression, Expression, bool) {
+	var indexes []int
+	intervals := make([]interval, len(e.Elem))
+	for i, element := range e.Elem {
+		if iv, ok := elementInterval(elementValue(element)); ok {
+			intervals[i] = iv
+			indexes = append(indexes, i)
+		}
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return intervals[indexes[a]].less(intervals[indexes[b]])
+	})
+
+	// Sorted by low value, the elements are disjoint as long as each one starts after the previous one ends.
+	for n := 1; n < len(indexes); n++ {
+		previous, next := intervals[indexes[n-1]], intervals[indexes[n]]
+		if previous.kind == next.kind && bytes.Compare(next.low[:], previous.high[:]) <= 0 {
+			return e.Elem[indexes[n-1]], e.Elem[indexes[n]], true
+		}
+	}
+	return Expression{}, Expression{}, false
+}
+
+// elementValue returns the value of an element with attributes, the element itself otherwise.
+func elementValue(e Expression) Expression {
+	if e.Elem != nil {
+		return e.Elem.Val
+	}
+	return e
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueElements returns the elements without their duplicates, along with the removed duplicates.
+func uniqueElements(elements []Expression) ([]Expression, []Expression) {
+	var unique, duplicates []Expression
+	seen := map[string]bool{}
+	for _, element := range elements {
+		data, err := json.Marshal(element)
+		if err == nil && seen[string(data)] {
+			duplicates = append(duplicates, element)
+			continue
+		}
+		seen[string(data)] = true
+		unique = append(unique, element)
+	}
+	return unique, duplicates
+}
+
+// mergeIntervals merges the overlapping and adjacent interval elements, returning the resulting elements
+// along with the elements replaced by a merged element.
+func mergeIntervals(elements []Expression) ([]Expression, []Expression) {
+	var indexes []int
+	intervals := make([]interval, len(elements))
+	for i, element := range elements {
+		if iv, ok := elementInterval(element); ok {
+			intervals[i] = iv
+			indexes = append(indexes, i)
+		}
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return intervals[indexes[a]].less(intervals[indexes[b]])
+	})
+
+	// Each group of merged elements is replaced by the merged element, at the position of its first member.
+	replacement := map[int]*Expression{}
+	skipped := map[int]bool{}
+	var replaced []Expression
+	for start := 0; start < len(indexes); {
+		group := intervals[indexes[start]]
+		end := start + 1
+		for ; end < len(indexes); end++ {
+			next := intervals[indexes[end]]
+			if !group.touches(next) {
+				break
+			}
+			if bytes.Compare(next.high[:], group.high[:]) > 0 {
+				group.high = next.high
+			}
+		}
+
+		if end-start > 1 {
+			members := append([]int(nil), indexes[start:end]...)
+			sort.Ints(members)
+			for _, i := range members {
+				skipped[i] = true
+				replaced = append(replaced, elements[i])
+			}
+			merged := group.expression()
+			replacement[members[0]] = &merged
+		}
+		start = end
+	}
+
+	var result []Expression
+	for i, element := range elements {
+		if merged, exists := replacement[i]; exists {
+			result = append(result, *merged)
+		} else if !skipped[i] {
+			result = append(result, element)
+		}
+	}
+	return result, replaced
+}
+
+// elementInterval returns the interval spanned by an address, prefix, range or numeric element.
+func elementInterval(e Expression) (interval, bool) {
+	switch {
+	case e.Prefix != nil:
+		low, kind, ok := parseIntervalValue(Expression{String: &e.Prefix.Addr})
+		if !ok || kind == intervalNumber || e.Prefix.Len < 0 || e.Prefix.Len > kind.bits() {
+			return interval{}, false
+		}
+		iv := interval{kind: kind}
+		hostBits := kind.bits() - e.Prefix.Len
+		for i := range low {
+			bit := (len(low) - 1 - i) * 8
+			var hostMask byte
+			switch {
+			case hostBits >= bit+8:
+				hostMask = 0xff
+			case hostBits > bit:
+				hostMask = byte(0xff) >> (8 - (hostBits - bit))
+			}
+			iv.low[i] = low[i] &^ hostMask
+			iv.high[i] = low[i] | hostMask
+		}
+		return iv, true
+	case e.Range != nil:
+		low, lowKind, lowOK := parseIntervalValue(e.Range.Low)
+		high, highKind, highOK := parseIntervalValue(e.Range.High)
+		if !lowOK || !highOK || lowKind != highKind || bytes.Compare(low[:], high[:]) > 0 {
+			return interval{}, false
+		}
+		return interval{kind: lowKind, low: low, high: high}, true
+	default:
+		value, kind, ok := parseIntervalValue(e)
+		return interval{kind: kind, low: value, high: value}, ok
+	}
+}
+
+// parseIntervalValue parses an address or a non-negative integer expression as a 128 bits integer.
+func parseIntervalValue(e Expression) ([16]byte, intervalKind, bool) {
+	var value [16]byte
+	switch {
+	case e.String != nil:
+		ip := net.ParseIP(*e.String)
+		if ip == nil {
+			return value, 0, false
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			copy(value[12:], ip4)
+			return value, intervalIPv4, true
+		}
+		copy(value[:], ip.To16())
+		return value, intervalIPv6, true
+	case e.Float64 != nil:
+		f := *e.Float64
+		if f < 0 || f != math.Trunc(f) || f > math.MaxUint32 {
+			return value, 0, false
+		}
+		n := uint32(f)
+		value[12], value[13], value[14], value[15] = byte(n>>24), byte(n>>16), byte(n>>8), byte(n)
+		return value, intervalNumber, true
+	}
+	return value, 0, false
+}
+
+func (k intervalKind) bits() int {
+	switch k {
+	case intervalIPv6:
+		return 128
+	default:
+		return 32
+	}
+}
+
+// less orders the intervals by kind, then by their low value.
+func (iv interval) less(other interval) bool {
+	if iv.kind != other.kind {
+		return iv.kind < other.kind
+	}
+	return bytes.Compare(iv.low[:], other.low[:]) < 0
+}
+
+// touches reports whether the other interval, of a greater or equal low value, overlaps or is adjacent to the interval.
+func (iv interval) touches(other interval) bool {
+	if iv.kind != other.kind {
+		return false
+	}
+	next, overflow := increment(iv.high)
+	return overflow || bytes.Compare(other.low[:], next[:]) <= 0
+}
+
+func increment(value [16]byte) ([16]byte, bool) {
+	for i := len(value) - 1; i >= 0; i-- {
+		value[i]++
+		if value[i] != 0 {
+			return value, false
+		}
+	}
+	return value, true
+}
+
+// expression returns the element expression of the interval:
+// a single value, a prefix if the interval spans one exactly, or a range.
+func (iv interval) expression() Expression {
+	if iv.low == iv.high {
+		return iv.valueExpression(iv.low)
+	}
+	if iv.kind != intervalNumber {
+		if length, ok := iv.prefixLen(); ok {
+			return Expression{Prefix: &Prefix{Addr: *iv.valueExpression(iv.low).String, Len: length}}
+		}
+	}
+	return Expression{Range: &Range{Low: iv.valueExpression(iv.low), High: iv.valueExpression(iv.high)}}
+}
+
+// prefixLen returns the prefix length of the interval, if it spans a prefix exactly:
+// the low and high values differ by their host bits only, which are all zeros and all ones respectively.
+func (iv interval) prefixLen() (int, bool) {
+	hostBits, inHostBits := 0, true
+	for i := len(iv.low) - 1; i >= 0; i-- {
+		diff := iv.low[i] ^ iv.high[i]
+		switch {
+		case iv.low[i]&diff != 0:
+			return 0, false
+		case inHostBits && diff == 0xff:
+			hostBits += 8
+		case inHostBits && diff&(diff+1) == 0:
+			for ; diff != 0; diff >>= 1 {
+				hostBits++
+			}
+			inHostBits = false
+		case diff != 0:
+			return 0, false
+		}
+	}
+	return iv.kind.bits() - hostBits, true
+}
+
+func (iv interval) valueExpression(value [16]byte) Expression {
+	switch iv.kind {
+	case intervalIPv4:
+		s := net.IP(value[12:]).String()
+		return Expression{String: &s}
+	case intervalIPv6:
+		s := net.IP(value[:]).String()
+		return Expression{String: &s}
+	default:
+		n := float64(uint32(value[12])<<24 | uint32(value[13])<<16 | uint32(value[14])<<8 | uint32(value[15]))
+		return Expression{Float64: &n}
+	}
+}
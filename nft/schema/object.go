@@ -0,0 +1,249 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package schema
+
+import (
+	"encoding/json"
+)
+
+// Secmark is a named secmark object, holding an SELinux security context
+// which is attached to packets by rules referencing the object.
+type Secmark struct {
+	Family  string `json:"family"`
+	Table   string `json:"table"`
+	Name    string `json:"name"`
+	Handle  *int   `json:"handle,omitempty"`
+	Context string `json:"context"`
+}
+
+// CtHelper is a named conntrack helper object (e.g. for FTP),
+// assigned to connections by rules referencing the object.
+type CtHelper struct {
+	Family   string `json:"family"`
+	Table    string `json:"table"`
+	Name     string `json:"name"`
+	Handle   *int   `json:"handle,omitempty"`
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+	L3Proto  string `json:"l3proto,omitempty"`
+}
+
+// CtExpectation is a named conntrack expectation object,
+// assigned to connections by rules referencing the object.
+// The timeout is in milliseconds.
+type CtExpectation struct {
+	Family   string `json:"family"`
+	Table    string `json:"table"`
+	Name     string `json:"name"`
+	Handle   *int   `json:"handle,omitempty"`
+	L3Proto  string `json:"l3proto,omitempty"`
+	Protocol string `json:"protocol"`
+	Dport    int    `json:"dport"`
+	Timeout  int    `json:"timeout"`
+	Size     int    `json:"size"`
+}
+
+// CtTimeout is a named conntrack timeout policy object,
+// assigned to connections by rules referencing the object.
+// The policy maps the connection states of the protocol (e.g. `established`, `close`) to their timeout, in seconds.
+type CtTimeout struct {
+	Family   string         `json:"family"`
+	Table    string         `json:"table"`
+	Name     string         `json:"name"`
+	Handle   *int           `json:"handle,omitempty"`
+	Protocol string         `json:"protocol"`
+	L3Proto  string         `json:"l3proto,omitempty"`
+	Policy   map[string]int `json:"policy,omitempty"`
+}
+
+// CounterObject is a named counter object, counting the packets of rules referencing it.
+type CounterObject struct {
+	Family  string `json:"family"`
+	Table   string `json:"table"`
+	Name    string `json:"name"`
+	Handle  *int   `json:"handle,omitempty"`
+	Packets int    `json:"packets"`
+	Bytes   int    `json:"bytes"`
+}
+
+// QuotaObject is a named quota object, matching until the number of bytes of rules referencing it
+// reaches (or, inverted, exceeds) the quota.
+type QuotaObject struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Handle *int   `json:"handle,omitempty"`
+	Bytes  int    `json:"bytes"`
+	Used   int    `json:"used,omitempty"`
+	Inv    bool   `json:"inv,omitempty"`
+}
+
+// LimitObject is a named limit object, shared by the rules referencing it.
+// The unit is either `packets` (default) or `bytes`.
+type LimitObject struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Handle *int   `json:"handle,omitempty"`
+	Rate   int    `json:"rate"`
+	Per    string `json:"per,omitempty"`
+	Burst  int    `json:"burst,omitempty"`
+	Unit   string `json:"unit,omitempty"`
+	Inv    bool   `json:"inv,omitempty"`
+}
+
+// SynproxyObject is a named synproxy object, shared by the rules referencing it.
+type SynproxyObject struct {
+	Family string `json:"family"`
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Handle *int   `json:"handle,omitempty"`
+	Mss    int    `json:"mss,omitempty"`
+	Wscale int    `json:"wscale,omitempty"`
+	Flags  *Flags `json:"flags,omitempty"`
+}
+
+func (s *Secmark) UnmarshalJSON(data []byte) error {
+	type _Secmark Secmark
+	secmark := struct {
+		*_Secmark
+		Handle *number `json:"handle,omitempty"`
+	}{_Secmark: (*_Secmark)(s)}
+
+	if err := json.Unmarshal(data, &secmark); err != nil {
+		return err
+	}
+	s.Handle = secmark.Handle.intPtr()
+
+	return nil
+}
+
+func (h *CtHelper) UnmarshalJSON(data []byte) error {
+	type _CtHelper CtHelper
+	helper := struct {
+		*_CtHelper
+		Handle *number `json:"handle,omitempty"`
+	}{_CtHelper: (*_CtHelper)(h)}
+
+	if err := json.Unmarshal(data, &helper); err != nil {
+		return err
+	}
+	h.Handle = helper.Handle.intPtr()
+
+	return nil
+}
+
+func (e *CtExpectation) UnmarshalJSON(data []byte) error {
+	type _CtExpectation CtExpectation
+	expectation := struct {
+		*_CtExpectation
+		Handle *number `json:"handle,omitempty"`
+	}{_CtExpectation: (*_CtExpectation)(e)}
+
+	if err := json.Unmarshal(data, &expectation); err != nil {
+		return err
+	}
+	e.Handle = expectation.Handle.intPtr()
+
+	return nil
+}
+
+func (t *CtTimeout) UnmarshalJSON(data []byte) error {
+	type _CtTimeout CtTimeout
+	timeout := struct {
+		*_CtTimeout
+		Handle *number `json:"handle,omitempty"`
+	}{_CtTimeout: (*_CtTimeout)(t)}
+
+	if err := json.Unmarshal(data, &timeout); err != nil {
+		return err
+	}
+	t.Handle = timeout.Handle.intPtr()
+
+	return nil
+}
+
+func (c *CounterObject) UnmarshalJSON(data []byte) error {
+	type _CounterObject CounterObject
+	counter := struct {
+		*_CounterObject
+		Handle  *number `json:"handle,omitempty"`
+		Packets number  `json:"packets"`
+		Bytes   number  `json:"bytes"`
+	}{_CounterObject: (*_CounterObject)(c)}
+
+	if err := json.Unmarshal(data, &counter); err != nil {
+		return err
+	}
+	c.Handle = counter.Handle.intPtr()
+	c.Packets = int(counter.Packets)
+	c.Bytes = int(counter.Bytes)
+
+	return nil
+}
+
+func (q *QuotaObject) UnmarshalJSON(data []byte) error {
+	type _QuotaObject QuotaObject
+	quota := struct {
+		*_QuotaObject
+		Handle *number `json:"handle,omitempty"`
+		Bytes  number  `json:"bytes"`
+		Used   number  `json:"used,omitempty"`
+	}{_QuotaObject: (*_QuotaObject)(q)}
+
+	if err := json.Unmarshal(data, &quota); err != nil {
+		return err
+	}
+	q.Handle = quota.Handle.intPtr()
+	q.Bytes = int(quota.Bytes)
+	q.Used = int(quota.Used)
+
+	return nil
+}
+
+func (l *LimitObject) UnmarshalJSON(data []byte) error {
+	type _LimitObject LimitObject
+	limit := struct {
+		*_LimitObject
+		Handle *number `json:"handle,omitempty"`
+	}{_LimitObject: (*_LimitObject)(l)}
+
+	if err := json.Unmarshal(data, &limit); err != nil {
+		return err
+	}
+	l.Handle = limit.Handle.intPtr()
+
+	return nil
+}
+
+func (s *SynproxyObject) UnmarshalJSON(data []byte) error {
+	type _SynproxyObject SynproxyObject
+	synproxy := struct {
+		*_SynproxyObject
+		Handle *number `json:"handle,omitempty"`
+	}{_SynproxyObject: (*_SynproxyObject)(s)}
+
+	if err := json.Unmarshal(data, &synproxy); err != nil {
+		return err
+	}
+	s.Handle = synproxy.Handle.intPtr()
+
+	return nil
+}
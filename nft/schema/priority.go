@@ -0,0 +1,218 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChainPriority is the priority of a base chain, either numeric or given by name
+// with an optional offset (e.g. `filter`, `dstnat - 5` or `filter + 10`).
+// The numeric priority of a name depends on the family, and the hooks the name is valid on.
+type ChainPriority struct {
+	// Name is the standard priority name (e.g. `filter`), empty for a numeric priority.
+	Name string
+	// Offset is the priority relative to the named one, or the priority itself when there is no name.
+	Offset int
+}
+
+// Standard Chain Priority Names
+const (
+	PriorityRaw      = "raw"
+	PriorityMangle   = "mangle"
+	PriorityDstNAT   = "dstnat"
+	PriorityFilter   = "filter"
+	PrioritySecurity = "security"
+	PrioritySrcNAT   = "srcnat"
+	PriorityOut      = "out" // bridge family only
+)
+
+// standardPriority is a standard priority name, with its value and the hooks it is valid on (all if none).
+type standardPriority struct {
+	name  string
+	value int
+	hooks []string
+}
+
+// standardPriorities lists the standard priorities by family, as resolved by nft.
+var standardPriorities = map[string][]standardPriority{
+	FamilyIP:     inetStandardPriorities,
+	FamilyIP6:    inetStandardPriorities,
+	FamilyINET:   inetStandardPriorities,
+	FamilyARP:    {{name: PriorityFilter, value: 0}},
+	FamilyNETDEV: {{name: PriorityFilter, value: 0}},
+	FamilyBridge: {
+		{name: PriorityDstNAT, value: -300, hooks: []string{HookPreRouting}},
+		{name: PriorityFilter, value: -200},
+		{name: PriorityOut, value: 100, hooks: []string{HookOutput}},
+		{name: PrioritySrcNAT, value: 300, hooks: []string{HookPostRouting}},
+	},
+}
+
+var inetStandardPriorities = []standardPriority{
+	{name: PriorityRaw, value: -300},
+	{name: PriorityMangle, value: -150},
+	{name: PriorityDstNAT, value: -100, hooks: []string{HookPreRouting}},
+	{name: PriorityFilter, value: 0},
+	{name: PrioritySecurity, value: 50},
+	{name: PrioritySrcNAT, value: 100, hooks: []string{HookPostRouting}},
+}
+
+// namedPriorityMaxOffset is the largest offset a numeric priority is described with relative to a name, as by nft.
+const namedPriorityMaxOffset = 10
+
+// ParseChainPriority parses a numeric (e.g. `-10`) or named (e.g. `filter + 10`) chain priority.
+// The name is not checked against the family and hook of a chain, see Value.
+func ParseChainPriority(s string) (ChainPriority, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 1 {
+		if value, err := strconv.Atoi(fields[0]); err == nil {
+			return ChainPriority{Offset: value}, nil
+		}
+		if isPriorityName(fields[0]) {
+			return ChainPriority{Name: fields[0]}, nil
+		}
+	}
+	if len(fields) == 3 && isPriorityName(fields[0]) && (fields[1] == "+" || fields[1] == "-") {
+		offset, err := strconv.Atoi(fields[2])
+		if err == nil && offset >= 0 {
+			if fields[1] == "-" {
+				offset = -offset
+			}
+			return ChainPriority{Name: fields[0], Offset: offset}, nil
+		}
+	}
+	return ChainPriority{}, fmt.Errorf("invalid chain priority %q, expected a number or a name with an optional offset", s)
+}
+
+// String returns the priority formatted as parsed by ParseChainPriority, e.g. `filter + 10`.
+func (p ChainPriority) String() string {
+	switch {
+	case p.Name == "":
+		return strconv.Itoa(p.Offset)
+	case p.Offset > 0:
+		return fmt.Sprintf("%s + %d", p.Name, p.Offset)
+	case p.Offset < 0:
+		return fmt.Sprintf("%s - %d", p.Name, -p.Offset)
+	}
+	return p.Name
+}
+
+func (p ChainPriority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *ChainPriority) UnmarshalText(text []byte) error {
+	priority, err := ParseChainPriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = priority
+	return nil
+}
+
+// Value returns the numeric priority, resolving the name by the family and the hook.
+// An error is returned if the name is not a standard priority of the family, or is not valid on the hook.
+func (p ChainPriority) Value(family, hook string) (int, error) {
+	if p.Name == "" {
+		return p.Offset, nil
+	}
+	for _, standard := range standardPriorities[family] {
+		if standard.name == p.Name {
+			if !standard.validOn(hook) {
+				return 0, fmt.Errorf("chain priority %q is not valid on the %s hook", p.Name, hook)
+			}
+			return standard.value + p.Offset, nil
+		}
+	}
+	return 0, fmt.Errorf("chain priority %q is not supported by the %s family", p.Name, family)
+}
+
+// Priority returns the structured priority of a base chain, false if the chain has no priority.
+// The named priority the chain was read with is returned as is, see the chain PrioName.
+// Otherwise, the priority is described relative to the closest standard name valid for the family and hook
+// of the chain, within an offset of 10 (e.g. `filter + 10` for a priority of 10 in the ip family),
+// otherwise it is numeric.
+func (c *Chain) Priority() (ChainPriority, bool) {
+	if name := c.namedPrio(); name != "" {
+		if priority, err := ParseChainPriority(name); err == nil {
+			return priority, true
+		}
+	}
+	if c.Prio == nil {
+		return ChainPriority{}, false
+	}
+
+	priority := ChainPriority{Offset: *c.Prio}
+	for _, standard := range standardPriorities[c.Family] {
+		offset := *c.Prio - standard.value
+		if !standard.validOn(c.Hook) || offset < -namedPriorityMaxOffset || offset > namedPriorityMaxOffset {
+			continue
+		}
+		if priority.Name == "" || abs(offset) < abs(priority.Offset) {
+			priority = ChainPriority{Name: standard.name, Offset: offset}
+		}
+	}
+	return priority, true
+}
+
+// SetPriority sets the priority of a base chain, resolved by the family and hook of the chain.
+// An error is returned if the priority name is not valid for them.
+// The chain is serialized with the resolved numeric priority.
+func (c *Chain) SetPriority(priority ChainPriority) error {
+	value, err := priority.Value(c.Family, c.Hook)
+	if err != nil {
+		return fmt.Errorf("chain %s %s %s: %v", c.Family, c.Table, c.Name, err)
+	}
+	c.Prio, c.PrioName = &value, ""
+	return nil
+}
+
+func (s standardPriority) validOn(hook string) bool {
+	if len(s.hooks) == 0 {
+		return true
+	}
+	for _, h := range s.hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+func isPriorityName(name string) bool {
+	for _, priorities := range standardPriorities {
+		for _, standard := range priorities {
+			if standard.name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -20,8 +20,10 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type Rule struct {
@@ -37,15 +39,188 @@ type Rule struct {
 type Statement struct {
 	Counter *Counter `json:"counter,omitempty"`
 	Match   *Match   `json:"match,omitempty"`
+	Vmap    *Vmap    `json:"vmap,omitempty"`
+	Limit   *Limit   `json:"limit,omitempty"`
+	Log     *Log     `json:"log,omitempty"`
+	Mangle  *Mangle  `json:"mangle,omitempty"`
+	Reject  *Reject  `json:"reject,omitempty"`
+	Last    *Last    `json:"last,omitempty"`
+	CtCount *CtCount `json:"ct count,omitempty"`
+	// Set is a set statement, updating a named set from the packet path.
+	Set *SetStatement `json:"set,omitempty"`
+
+	Quota    *Quota    `json:"quota,omitempty"`
+	Synproxy *Synproxy `json:"synproxy,omitempty"`
 	Verdict
 	Nat
+	ObjectRef
+
+	// RowData accepts an arbitrary statement which cannot be composed from the existing schema
+	// (e.g. `{"notrack":null}`), serialized as given.
+	// Statements read without any key known to the schema are kept as RowData, preserving them on a round-trip.
+	RowData json.RawMessage `json:"-"`
 }
 
+// ObjectRef holds the statements which reference named objects, by name or through a map lookup.
+// The counter, quota, limit and synproxy references share their JSON key with the inline statements
+// (e.g. `{"counter":"name"}` versus `{"counter":{"packets":0,"bytes":0}}`), and are serialized by the Statement.
+type ObjectRef struct {
+	Secmark       *Expression `json:"secmark,omitempty"`        // meta secmark set "name"
+	CtHelper      *Expression `json:"ct helper,omitempty"`      // ct helper set "name"
+	CtExpectation *Expression `json:"ct expectation,omitempty"` // ct expectation set "name"
+	CtTimeout     *Expression `json:"ct timeout,omitempty"`     // ct timeout set "name"
+
+	CounterRef  *Expression `json:"-"` // counter name "name"
+	QuotaRef    *Expression `json:"-"` // quota name "name"
+	LimitRef    *Expression `json:"-"` // limit name "name"
+	SynproxyRef *Expression `json:"-"` // synproxy name "name"
+}
+
+// Named object reference keys, shared with the inline statements.
+const (
+	counterKey  = "counter"
+	quotaKey    = "quota"
+	limitKey    = "limit"
+	synproxyKey = "synproxy"
+)
+
+var objectRefKeys = []string{counterKey, quotaKey, limitKey, synproxyKey}
+
 type Counter struct {
 	Packets int `json:"packets"`
 	Bytes   int `json:"bytes"`
 }
 
+// Quota is an inline quota statement, matching until the value is reached (or, inverted, exceeded).
+// The units are byte units, e.g. `mbytes`.
+type Quota struct {
+	Val      int    `json:"val"`
+	ValUnit  string `json:"val_unit,omitempty"`
+	Used     int    `json:"used,omitempty"`
+	UsedUnit string `json:"used_unit,omitempty"`
+	Inv      bool   `json:"inv,omitempty"`
+}
+
+// Synproxy is an inline synproxy statement, with the TCP options to announce.
+type Synproxy struct {
+	Mss    int    `json:"mss,omitempty"`
+	Wscale int    `json:"wscale,omitempty"`
+	Flags  *Flags `json:"flags,omitempty"`
+}
+
+type Limit struct {
+	Rate      int    `json:"rate"`
+	RateUnit  string `json:"rate_unit,omitempty"`
+	Per       string `json:"per,omitempty"`
+	Burst     int    `json:"burst,omitempty"`
+	BurstUnit string `json:"burst_unit,omitempty"`
+	Inv       bool   `json:"inv,omitempty"`
+}
+
+// Limit Time Units
+const (
+	LimitPerSecond = "second"
+	LimitPerMinute = "minute"
+	LimitPerHour   = "hour"
+	LimitPerDay    = "day"
+	LimitPerWeek   = "week"
+)
+
+const log = "log"
+
+// Log is a log statement, all fields are optional.
+type Log struct {
+	Prefix         string `json:"prefix,omitempty"`
+	Group          *int   `json:"group,omitempty"`
+	Snaplen        *int   `json:"snaplen,omitempty"`
+	QueueThreshold *int   `json:"queue-threshold,omitempty"`
+	Level          string `json:"level,omitempty"`
+	Flags          *Flags `json:"flags,omitempty"`
+}
+
+// Log Levels
+const (
+	LogLevelEmerg  = "emerg"
+	LogLevelAlert  = "alert"
+	LogLevelCrit   = "crit"
+	LogLevelErr    = "err"
+	LogLevelWarn   = "warn"
+	LogLevelNotice = "notice"
+	LogLevelInfo   = "info"
+	LogLevelDebug  = "debug"
+	LogLevelAudit  = "audit"
+)
+
+const reject = "reject"
+
+// Reject is a reject statement, all fields are optional.
+// The type is one of the RejectType* types, the expression is the ICMP code to reply with (e.g. `admin-prohibited`).
+type Reject struct {
+	Type string `json:"type,omitempty"`
+	Expr string `json:"expr,omitempty"`
+}
+
+// Reject Types
+const (
+	RejectTypeICMP     = "icmp"
+	RejectTypeICMPv6   = "icmpv6"
+	RejectTypeICMPx    = "icmpx"
+	RejectTypeTCPReset = "tcp reset"
+)
+
+const last = "last"
+
+// Last is a last statement, recording when the rule last matched.
+// The used time is the elapsed time since the last match, in milliseconds, and is nil if the rule never matched
+// (`last used never`), as well as when adding the statement.
+type Last struct {
+	Used *int `json:"used,omitempty"`
+}
+
+// UsedDuration returns the elapsed time since the rule last matched.
+// The second return value reports whether the rule matched at all.
+func (l Last) UsedDuration() (time.Duration, bool) {
+	if l.Used == nil {
+		return 0, false
+	}
+	return time.Duration(*l.Used) * time.Millisecond, true
+}
+
+// CtCount is the conntrack count statement, matching while the number of connections is at most the value
+// (or, inverted, over the value).
+// Counting the connections per key (e.g. the source address) requires it to be used in a SetStatement,
+// the set holding a count per element.
+// Example: `ct count over 10`
+type CtCount struct {
+	Val int  `json:"val"`
+	Inv bool `json:"inv,omitempty"`
+}
+
+// SetStatement adds or updates the element in the referenced set (e.g. `@name`), or deletes it from the set.
+// The statements are attached to the element (e.g. a CtCount or a Limit), with their state kept per element.
+// The set is expected to be declared with the dynamic flag.
+// Example: `add @meter { ip saddr ct count over 10 }`
+type SetStatement struct {
+	Op   string      `json:"op"`
+	Elem Expression  `json:"elem"`
+	Set  string      `json:"set"`
+	Stmt []Statement `json:"stmt,omitempty"`
+}
+
+// Set Statement Operations
+const (
+	SetOpAdd    = "add"
+	SetOpUpdate = "update"
+	SetOpDelete = "delete"
+)
+
+// Mangle changes the packet data or meta info, setting the key to the value.
+// Example: `tcp option maxseg size set rt mtu`
+type Mangle struct {
+	Key   Expression `json:"key"`
+	Value Expression `json:"value"`
+}
+
 type Nat struct {
 	Snat       *Snat       `json:"snat,omitempty"`
 	Dnat       *Dnat       `json:"dnat,omitempty"`
@@ -118,10 +293,29 @@ type Match struct {
 }
 
 type Expression struct {
-	String  *string  `json:"-"`
-	Bool    *bool    `json:"-"`
-	Float64 *float64 `json:"-"`
-	Payload *Payload `json:"payload,omitempty"`
+	String    *string    `json:"-"`
+	Bool      *bool      `json:"-"`
+	Float64   *float64   `json:"-"`
+	Payload   *Payload   `json:"payload,omitempty"`
+	Meta      *Meta      `json:"meta,omitempty"`
+	Osf       *Osf       `json:"osf,omitempty"`
+	Rt        *Rt        `json:"rt,omitempty"`
+	Socket    *Socket    `json:"socket,omitempty"`
+	Numgen    *Numgen    `json:"numgen,omitempty"`
+	Jhash     *Jhash     `json:"jhash,omitempty"`
+	TcpOption *TcpOption `json:"tcp option,omitempty"`
+	Range     *Range     `json:"range,omitempty"`
+	Prefix    *Prefix    `json:"prefix,omitempty"`
+	Elem      *Elem      `json:"elem,omitempty"`
+	Ct        *Ct        `json:"ct,omitempty"`
+	// Set is an anonymous set expression, of the set elements (e.g. `{ 22, 80 }`).
+	Set []Expression `json:"set,omitempty"`
+	Map *MapLookup   `json:"map,omitempty"`
+	// Concat is a concatenation of expressions (e.g. `ip saddr . ip daddr`), as a key of concatenated types.
+	// The elements of a concatenated set or map are concatenations of values, prefixes or ranges.
+	Concat []Expression `json:"concat,omitempty"`
+	// Binary is a binary operation expression, serialized by its operator (e.g. `{"&":[left,right]}`).
+	Binary *BinaryOperation `json:"-"`
 	// RowData accepts arbitrary data which cannot be composed from the existing schema.
 	// Use `json.RawMessage()` or `[]byte()` for the value.
 	// Example:
@@ -134,6 +328,168 @@ type Payload struct {
 	Field    string `json:"field"`
 }
 
+type Meta struct {
+	Key string `json:"key"`
+}
+
+// Osf is the passive OS fingerprint expression, matched against the OS name or version.
+type Osf struct {
+	Key string `json:"key"`
+	Ttl string `json:"ttl,omitempty"`
+}
+
+// Rt is the routing data expression, of the route chosen for the packet.
+// The family is optional, required for `nexthop` in the inet family.
+type Rt struct {
+	Key    string `json:"key"`
+	Family string `json:"family,omitempty"`
+}
+
+// Socket is the socket expression, of the socket associated with the packet.
+// The level is the cgroup v2 ancestor level to match, used with the `cgroupv2` key only.
+type Socket struct {
+	Key   string `json:"key"`
+	Level int    `json:"level,omitempty"`
+}
+
+// Numgen is the number generator expression, generating numbers from the offset up to the offset plus the modulus (excluded).
+type Numgen struct {
+	Mode   string `json:"mode"`
+	Mod    int    `json:"mod"`
+	Offset int    `json:"offset,omitempty"`
+}
+
+// Jhash is the Jenkins hash expression, hashing the value of the expression into the numbers from the offset
+// up to the offset plus the modulus (excluded).
+// The same value is always hashed to the same number, given the same seed.
+type Jhash struct {
+	Mod    int        `json:"mod"`
+	Offset int        `json:"offset,omitempty"`
+	Expr   Expression `json:"expr"`
+	Seed   int        `json:"seed,omitempty"`
+}
+
+// TcpOption is the TCP option expression, of a field in the named option.
+// A missing field tests the existence of the option.
+type TcpOption struct {
+	Name  string `json:"name"`
+	Field string `json:"field,omitempty"`
+}
+
+// Range is an inclusive range of values, e.g. `"17:00"-"19:00"` or `1024-65535`.
+type Range struct {
+	Low  Expression
+	High Expression
+}
+
+func (r Range) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]Expression{r.Low, r.High})
+}
+
+func (r *Range) UnmarshalJSON(data []byte) error {
+	var values [2]Expression
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	r.Low, r.High = values[0], values[1]
+	return nil
+}
+
+// Prefix is an address prefix expression, of the address and its prefix length (e.g. `192.168.0.0/24`).
+type Prefix struct {
+	Addr string `json:"addr"`
+	Len  int    `json:"len"`
+}
+
+// Elem is a set element expression, of the element value along with its attributes.
+// It is needed only to set element attributes, e.g. a comment for elements added from a blocklist source.
+// The timeout and expiration are in seconds.
+type Elem struct {
+	Val     Expression `json:"val"`
+	Timeout int        `json:"timeout,omitempty"`
+	Expires int        `json:"expires,omitempty"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+// Ct is the conntrack expression, of the connection the packet belongs to.
+// The direction is optional, for keys specific to the original or reply direction.
+type Ct struct {
+	Key    string `json:"key"`
+	Family string `json:"family,omitempty"`
+	Dir    string `json:"dir,omitempty"`
+}
+
+// MapLookup is a map lookup expression, evaluating to the data mapped to the key value.
+// The map is either referenced by name (e.g. `@mymap`) or defined anonymously through an anonymous set
+// of key and data pairs, see AnonymousMap.
+// It is used as a value, e.g. of a mangle statement (`meta priority set ip dscp map { cs1 : 1:10 }`).
+type MapLookup struct {
+	Key  Expression `json:"key"`
+	Data Expression `json:"data"`
+}
+
+// AnonymousMap returns the anonymous set expression of the key and data pairs, as the data of a MapLookup.
+func AnonymousMap(pairs ...[2]Expression) (Expression, error) {
+	elements := make([]Expression, 0, len(pairs))
+	for _, pair := range pairs {
+		data, err := json.Marshal(pair)
+		if err != nil {
+			return Expression{}, err
+		}
+		elements = append(elements, Expression{RowData: data})
+	}
+	return Expression{Set: elements}, nil
+}
+
+// BinaryOperation is a binary operation on two expressions, with one of the
+// OperAND, OperOR, OperXOR, OperLSH and OperRSH operators.
+// Example: `ct status & dnat`
+type BinaryOperation struct {
+	Op    string
+	Left  Expression
+	Right Expression
+}
+
+// Conntrack Expressions
+const (
+	CtKeyState      = "state"
+	CtKeyStatus     = "status"
+	CtKeyMark       = "mark"
+	CtKeyDirection  = "direction"
+	CtKeyExpiration = "expiration"
+	CtKeyHelper     = "helper"
+	CtKeyL3proto    = "l3proto"
+	CtKeyProtocol   = "protocol"
+	CtKeySaddr      = "saddr"
+	CtKeyDaddr      = "daddr"
+	CtKeyProtoSrc   = "proto-src"
+	CtKeyProtoDst   = "proto-dst"
+	CtKeyZone       = "zone"
+
+	CtDirOriginal = "original"
+	CtDirReply    = "reply"
+)
+
+// Conntrack States
+const (
+	CtStateNew         = "new"
+	CtStateEstablished = "established"
+	CtStateRelated     = "related"
+	CtStateInvalid     = "invalid"
+	CtStateUntracked   = "untracked"
+)
+
+// Conntrack Status Flags
+const (
+	CtStatusExpected  = "expected"
+	CtStatusSeenReply = "seen-reply"
+	CtStatusAssured   = "assured"
+	CtStatusConfirmed = "confirmed"
+	CtStatusSnat      = "snat"
+	CtStatusDnat      = "dnat"
+	CtStatusDying     = "dying"
+)
+
 // Verdict Operations
 const (
 	VerdictAccept   = "accept"
@@ -189,9 +545,236 @@ const (
 	PayloadFieldIP6FlowLabel = "flowlabel"
 	PayloadFieldIP6NextHdr   = "nexthdr"
 	PayloadFieldIP6HopLimit  = "hoplimit"
+
+	// Transport protocols, with the same port fields
+	PayloadProtocolTCP  = "tcp"
+	PayloadProtocolUDP  = "udp"
+	PayloadProtocolSCTP = "sctp"
+	PayloadFieldSPort   = "sport"
+	PayloadFieldDPort   = "dport"
+
+	// VLAN (bridge and netdev families)
+	PayloadProtocolVlan  = "vlan"
+	PayloadFieldVlanID   = "id"
+	PayloadFieldVlanDei  = "dei"
+	PayloadFieldVlanPcp  = "pcp"
+	PayloadFieldVlanType = "type"
+
+	// ARP (arp, bridge and netdev families)
+	PayloadProtocolARP        = "arp"
+	PayloadFieldARPHType      = "htype"
+	PayloadFieldARPPType      = "ptype"
+	PayloadFieldARPHLen       = "hlen"
+	PayloadFieldARPPLen       = "plen"
+	PayloadFieldARPOperation  = "operation"
+	PayloadFieldARPSAddrIP    = "saddr ip"
+	PayloadFieldARPDAddrIP    = "daddr ip"
+	PayloadFieldARPSAddrEther = "saddr ether"
+	PayloadFieldARPDAddrEther = "daddr ether"
+)
+
+// IPv4 Fragment Offset Field Bits, of the frag-off payload field (flags and offset).
+const (
+	IPFragOffsetMask    = 0x1fff // Fragment offset
+	IPFragMoreFragments = 0x2000 // More fragments (MF) flag
+	IPFragDontFragment  = 0x4000 // Don't fragment (DF) flag
+)
+
+// ARP Operations
+const (
+	ARPOperationRequest   = "request"
+	ARPOperationReply     = "reply"
+	ARPOperationRRequest  = "rrequest"
+	ARPOperationRReply    = "rreply"
+	ARPOperationInRequest = "inrequest"
+	ARPOperationInReply   = "inreply"
+	ARPOperationNak       = "nak"
+)
+
+// TCP Option Expressions
+const (
+	TcpOptionMaxseg    = "maxseg"
+	TcpOptionWindow    = "window"
+	TcpOptionSackPerm  = "sack-perm"
+	TcpOptionSack      = "sack"
+	TcpOptionTimestamp = "timestamp"
+
+	TcpOptionFieldKind   = "kind"
+	TcpOptionFieldLength = "length"
+	TcpOptionFieldSize   = "size"  // maxseg
+	TcpOptionFieldCount  = "count" // window
+)
+
+// DSCP Classes, as accepted for the dscp payload field (numeric values are accepted as well).
+const (
+	DSCPCS0  = "cs0"
+	DSCPCS1  = "cs1"
+	DSCPCS2  = "cs2"
+	DSCPCS3  = "cs3"
+	DSCPCS4  = "cs4"
+	DSCPCS5  = "cs5"
+	DSCPCS6  = "cs6"
+	DSCPCS7  = "cs7"
+	DSCPAF11 = "af11"
+	DSCPAF12 = "af12"
+	DSCPAF13 = "af13"
+	DSCPAF21 = "af21"
+	DSCPAF22 = "af22"
+	DSCPAF23 = "af23"
+	DSCPAF31 = "af31"
+	DSCPAF32 = "af32"
+	DSCPAF33 = "af33"
+	DSCPAF41 = "af41"
+	DSCPAF42 = "af42"
+	DSCPAF43 = "af43"
+	DSCPEF   = "ef"
+	DSCPVA   = "va"
+	DSCPLE   = "le"
+)
+
+// ECN Codepoints, as accepted for the ecn payload field.
+const (
+	ECNNotECT = "not-ect"
+	ECNECT1   = "ect1"
+	ECNECT0   = "ect0"
+	ECNCE     = "ce"
+)
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type _Rule Rule
+	rule := struct {
+		*_Rule
+		Handle *number `json:"handle,omitempty"`
+		Index  *number `json:"index,omitempty"`
+	}{_Rule: (*_Rule)(r)}
+
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return err
+	}
+	r.Handle = rule.Handle.intPtr()
+	r.Index = rule.Index.intPtr()
+
+	return nil
+}
+
+func (c *Counter) UnmarshalJSON(data []byte) error {
+	type _Counter Counter
+	counter := struct {
+		*_Counter
+		Packets number `json:"packets"`
+		Bytes   number `json:"bytes"`
+	}{_Counter: (*_Counter)(c)}
+
+	if err := json.Unmarshal(data, &counter); err != nil {
+		return err
+	}
+	c.Packets = int(counter.Packets)
+	c.Bytes = int(counter.Bytes)
+
+	return nil
+}
+
+// Meta Expressions
+const (
+	MetaKey = "meta"
+
+	MetaKeyMark     = "mark"
+	MetaKeyNfproto  = "nfproto"
+	MetaKeyL4proto  = "l4proto"
+	MetaKeyPriority = "priority" // Traffic control class, e.g. "1:10"
+
+	// Packet
+	MetaKeyLength   = "length"   // Packet length in bytes
+	MetaKeyProtocol = "protocol" // EtherType protocol, e.g. "ip" or "ip6"
+	MetaKeyPkttype  = "pkttype"  // Packet type, one of the PktType* values
+
+	// Socket
+	MetaKeyCgroup = "cgroup" // Control group (v1) ID of the originating socket
+	MetaKeySkuid  = "skuid"  // User owning the originating socket, by name or ID
+	MetaKeySkgid  = "skgid"  // Group owning the originating socket, by name or ID
+
+	// Interfaces
+	MetaKeyIif      = "iif"
+	MetaKeyIifname  = "iifname"
+	MetaKeyIiftype  = "iiftype"
+	MetaKeyIifgroup = "iifgroup" // Input interface device group
+	MetaKeyOif      = "oif"
+	MetaKeyOifname  = "oifname"
+	MetaKeyOiftype  = "oiftype"
+	MetaKeyOifgroup = "oifgroup" // Output interface device group
+
+	// Bridge ports, in the bridge family
+	MetaKeyIbrname   = "ibrname"   // Name of the bridge of the input port
+	MetaKeyObrname   = "obrname"   // Name of the bridge of the output port
+	MetaKeyIbrpvid   = "ibrpvid"   // Port VLAN ID of the bridge of the input port
+	MetaKeyIbrvproto = "ibrvproto" // VLAN protocol of the bridge of the input port, e.g. "8021q"
+	// The bridge name keys were formerly named after the bridge port, accepted by nft as aliases.
+	// nft reports the matches with the current names.
+	MetaKeyIbriport = "ibriport"
+	MetaKeyObriport = "obriport"
+
+	// Time
+	MetaKeyTime = "time" // Date and time, e.g. "2021-06-01 12:00:00"
+	MetaKeyDay  = "day"  // Day of the week, by name
+	MetaKeyHour = "hour" // Time of day, e.g. "17:00" or "17:00:30"
+)
+
+// Packet Types, as matched by the meta pkttype key.
+const (
+	PktTypeHost      = "host"
+	PktTypeUnicast   = "unicast" // Alias of host
+	PktTypeBroadcast = "broadcast"
+	PktTypeMulticast = "multicast"
+	PktTypeOther     = "other"
+)
+
+// Days of the week, as matched by the meta day key.
+const (
+	DaySunday    = "Sunday"
+	DayMonday    = "Monday"
+	DayTuesday   = "Tuesday"
+	DayWednesday = "Wednesday"
+	DayThursday  = "Thursday"
+	DayFriday    = "Friday"
+	DaySaturday  = "Saturday"
+)
+
+// OS Fingerprint Expressions
+const (
+	OsfKeyName    = "name"
+	OsfKeyVersion = "version"
+
+	OsfTtlLoose = "loose" // Check the TTL is less than the fingerprint one.
+	OsfTtlSkip  = "skip"  // Do not check the TTL.
+)
+
+// Routing Expressions
+const (
+	RtKeyClassid = "classid"
+	RtKeyNexthop = "nexthop"
+	RtKeyMtu     = "mtu"
+	RtKeyIpsec   = "ipsec"
+)
+
+// Number Generator Modes
+const (
+	NumgenModeRandom = "random" // Random numbers
+	NumgenModeInc    = "inc"    // Incremental numbers, wrapping around the modulus
+)
+
+// Socket Expressions
+const (
+	SocketKeyTransparent = "transparent" // Whether the socket is transparent (IP_TRANSPARENT)
+	SocketKeyMark        = "mark"        // The socket mark (SO_MARK)
+	SocketKeyWildcard    = "wildcard"    // Whether the socket is bound to the wildcard address
+	SocketKeyCgroupv2    = "cgroupv2"    // The cgroup v2 path, at the given level
 )
 
 func (s Statement) MarshalJSON() ([]byte, error) {
+	if s.RowData != nil {
+		return s.RowData, nil
+	}
+
 	type _Statement Statement
 	statement := _Statement(s)
 
@@ -219,6 +802,24 @@ func (s Statement) MarshalJSON() ([]byte, error) {
 	case s.Redirect != nil && s.Redirect.Enabled && s.Redirect.Port == nil && s.Redirect.Flags == nil:
 		dynamicStructure[redirect] = nil
 	}
+	if s.Log != nil && *s.Log == (Log{}) {
+		dynamicStructure[log] = nil
+	}
+	if s.Reject != nil && *s.Reject == (Reject{}) {
+		dynamicStructure[reject] = nil
+	}
+	if s.Last != nil && s.Last.Used == nil {
+		dynamicStructure[last] = nil
+	}
+	for _, key := range objectRefKeys {
+		ref := *s.objectRef(key)
+		if ref == nil {
+			continue
+		}
+		if dynamicStructure[key], err = json.Marshal(ref); err != nil {
+			return nil, err
+		}
+	}
 
 	data, err = json.Marshal(dynamicStructure)
 	if err != nil {
@@ -228,34 +829,158 @@ func (s Statement) MarshalJSON() ([]byte, error) {
 }
 
 func (s *Statement) UnmarshalJSON(data []byte) error {
-	type _Statement Statement
-	statement := _Statement{}
-
-	if err := json.Unmarshal(data, &statement); err != nil {
+	// The statement is told by its keys, each value being decoded once into the field of the key.
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
 		return err
 	}
-	*s = Statement(statement)
 
-	dynamicStructure := make(map[string]json.RawMessage)
-	if err := json.Unmarshal(data, &dynamicStructure); err != nil {
-		return err
+	*s = Statement{}
+	defined := false
+	for key, value := range values {
+		switch key {
+		case VerdictAccept:
+			s.Accept = true
+		case VerdictContinue:
+			s.Continue = true
+		case VerdictDrop:
+			s.Drop = true
+		case VerdictReturn:
+			s.Return = true
+		default:
+			field := s.field(key)
+			if ref := s.objectRef(key); ref != nil && isObjectRef(value) {
+				field = ref
+			}
+			if field == nil {
+				continue
+			}
+			if err := json.Unmarshal(value, field); err != nil {
+				return err
+			}
+		}
+		defined = true
+	}
+
+	if _, counterDefined := values[counterKey]; s.Counter == nil && s.CounterRef == nil && counterDefined {
+		s.Counter = &Counter{}
 	}
-	_, s.Accept = dynamicStructure[VerdictAccept]
-	_, s.Continue = dynamicStructure[VerdictContinue]
-	_, s.Drop = dynamicStructure[VerdictDrop]
-	_, s.Return = dynamicStructure[VerdictReturn]
 
-	if _, masqueradeDefined := dynamicStructure[masquerade]; s.Masquerade == nil && masqueradeDefined {
+	if _, masqueradeDefined := values[masquerade]; s.Masquerade == nil && masqueradeDefined {
 		s.Masquerade = &Masquerade{Enabled: true}
 	}
 
-	if _, redirectDefined := dynamicStructure[redirect]; s.Redirect == nil && redirectDefined {
+	if _, redirectDefined := values[redirect]; s.Redirect == nil && redirectDefined {
 		s.Redirect = &Redirect{Enabled: true}
 	}
 
+	if _, logDefined := values[log]; s.Log == nil && logDefined {
+		s.Log = &Log{}
+	}
+
+	if _, rejectDefined := values[reject]; s.Reject == nil && rejectDefined {
+		s.Reject = &Reject{}
+	}
+
+	if _, lastDefined := values[last]; s.Last == nil && lastDefined {
+		s.Last = &Last{}
+	}
+
+	if !defined {
+		s.RowData = data
+	}
+
 	return nil
 }
 
+// field returns a pointer to the statement field holding the value of the JSON key,
+// nil if the key is not a statement of the schema.
+// The verdicts without a value and the named object references are not included.
+func (s *Statement) field(key string) interface{} {
+	switch key {
+	case counterKey:
+		return &s.Counter
+	case "match":
+		return &s.Match
+	case "vmap":
+		return &s.Vmap
+	case limitKey:
+		return &s.Limit
+	case log:
+		return &s.Log
+	case "mangle":
+		return &s.Mangle
+	case reject:
+		return &s.Reject
+	case last:
+		return &s.Last
+	case "ct count":
+		return &s.CtCount
+	case "set":
+		return &s.Set
+	case quotaKey:
+		return &s.Quota
+	case synproxyKey:
+		return &s.Synproxy
+	case "jump":
+		return &s.Jump
+	case "goto":
+		return &s.Goto
+	case "snat":
+		return &s.Snat
+	case "dnat":
+		return &s.Dnat
+	case masquerade:
+		return &s.Masquerade
+	case redirect:
+		return &s.Redirect
+	case "secmark":
+		return &s.Secmark
+	case "ct helper":
+		return &s.CtHelper
+	case "ct expectation":
+		return &s.CtExpectation
+	case "ct timeout":
+		return &s.CtTimeout
+	}
+	return nil
+}
+
+// objectRef returns a pointer to the named object reference of the statement sharing the JSON key
+// with an inline statement, nil if there is none.
+func (s *Statement) objectRef(key string) **Expression {
+	switch key {
+	case counterKey:
+		return &s.CounterRef
+	case quotaKey:
+		return &s.QuotaRef
+	case limitKey:
+		return &s.LimitRef
+	case synproxyKey:
+		return &s.SynproxyRef
+	}
+	return nil
+}
+
+// isObjectRef reports whether the statement value is a named object reference,
+// either by name or through a map lookup, and not an inline statement.
+func isObjectRef(value json.RawMessage) bool {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || value[0] != '{' {
+		return len(value) > 0 && value[0] == '"'
+	}
+	// Inline statements are the common case, told apart without decoding them.
+	if !bytes.Contains(value, []byte(`"map"`)) {
+		return false
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err != nil {
+		return false
+	}
+	_, isMap := object["map"]
+	return isMap && len(object) == 1
+}
+
 func (e Expression) MarshalJSON() ([]byte, error) {
 	var dynamicStruct interface{}
 
@@ -268,6 +993,8 @@ func (e Expression) MarshalJSON() ([]byte, error) {
 		dynamicStruct = *e.Float64
 	case e.Bool != nil:
 		dynamicStruct = *e.Bool
+	case e.Binary != nil:
+		dynamicStruct = map[string][2]Expression{e.Binary.Op: {e.Binary.Left, e.Binary.Right}}
 	default:
 		type _Expression Expression
 		dynamicStruct = _Expression(e)
@@ -277,41 +1004,101 @@ func (e Expression) MarshalJSON() ([]byte, error) {
 }
 
 func (e *Expression) UnmarshalJSON(data []byte) error {
-	var dynamicStruct interface{}
-	if err := json.Unmarshal(data, &dynamicStruct); err != nil {
-		return err
-	}
-
-	switch dynamicStruct.(type) {
-	case string:
-		d := dynamicStruct.(string)
+	// The expression kind is told by the first byte of its value, sparing the decoding of
+	// the value into a dynamic structure, which is costly with the deeply nested expressions.
+	switch value := bytes.TrimSpace(data); {
+	case len(value) > 0 && value[0] == '"':
+		var d string
+		if err := json.Unmarshal(value, &d); err != nil {
+			return err
+		}
 		e.String = &d
-	case float64:
-		d := dynamicStruct.(float64)
+	case len(value) > 0 && (value[0] == '-' || value[0] >= '0' && value[0] <= '9'):
+		var d float64
+		if err := json.Unmarshal(value, &d); err != nil {
+			return err
+		}
 		e.Float64 = &d
-	case bool:
-		d := dynamicStruct.(bool)
+	case len(value) > 0 && (value[0] == 't' || value[0] == 'f'):
+		var d bool
+		if err := json.Unmarshal(value, &d); err != nil {
+			return err
+		}
 		e.Bool = &d
-	case []interface{}:
+	case len(value) > 0 && value[0] == '[':
 		e.RowData = data
-	case map[string]interface{}:
+	case len(value) > 0 && value[0] == '{':
 		type _Expression Expression
 		expression := _Expression(*e)
 		if err := json.Unmarshal(data, &expression); err != nil {
 			return err
 		}
 		*e = Expression(expression)
+		if !e.isDefined() {
+			binary, err := unmarshalBinaryOperation(data)
+			if err != nil {
+				return err
+			}
+			e.Binary = binary
+		}
 	default:
+		var dynamicStruct interface{}
+		if err := json.Unmarshal(data, &dynamicStruct); err != nil {
+			return err
+		}
 		return fmt.Errorf("unsupported field type in expression: %T(%v)", dynamicStruct, dynamicStruct)
 	}
 
-	if e.String == nil && e.Float64 == nil && e.Bool == nil && e.Payload == nil {
+	if !e.isDefined() {
 		e.RowData = data
 	}
 
 	return nil
 }
 
+// unmarshalBinaryOperation decodes a binary operation expression,
+// returning nil if the data is not a binary operation.
+func unmarshalBinaryOperation(data []byte) (*BinaryOperation, error) {
+	var operation map[string]json.RawMessage
+	if err := json.Unmarshal(data, &operation); err != nil || len(operation) != 1 {
+		return nil, nil
+	}
+	for op, operands := range operation {
+		switch op {
+		case OperAND, OperOR, OperXOR, OperLSH, OperRSH:
+		default:
+			return nil, nil
+		}
+		var values [2]Expression
+		if err := json.Unmarshal(operands, &values); err != nil {
+			return nil, err
+		}
+		return &BinaryOperation{Op: op, Left: values[0], Right: values[1]}, nil
+	}
+	return nil, nil
+}
+
+// isDefined reports whether the expression content is represented by the schema structures.
+func (e *Expression) isDefined() bool {
+	return e.String != nil || e.Float64 != nil || e.Bool != nil ||
+		e.Payload != nil ||
+		e.Meta != nil ||
+		e.Osf != nil ||
+		e.Rt != nil ||
+		e.Socket != nil ||
+		e.Numgen != nil ||
+		e.Jhash != nil ||
+		e.TcpOption != nil ||
+		e.Range != nil ||
+		e.Prefix != nil ||
+		e.Elem != nil ||
+		e.Ct != nil ||
+		e.Set != nil ||
+		e.Map != nil ||
+		e.Concat != nil ||
+		e.Binary != nil
+}
+
 func (f Flags) MarshalJSON() ([]byte, error) {
 	var dynamicStruct interface{}
 
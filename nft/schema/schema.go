@@ -30,10 +30,24 @@ type Root struct {
 const ruleSetKey = "ruleset"
 
 type Objects struct {
-	Table   *Table `json:"table,omitempty"`
-	Chain   *Chain `json:"chain,omitempty"`
-	Rule    *Rule  `json:"rule,omitempty"`
-	Ruleset bool   `json:"-"`
+	Table   *Table   `json:"table,omitempty"`
+	Chain   *Chain   `json:"chain,omitempty"`
+	Rule    *Rule    `json:"rule,omitempty"`
+	Secmark *Secmark `json:"secmark,omitempty"`
+	Set     *Set     `json:"set,omitempty"`
+	Map     *Map     `json:"map,omitempty"`
+	Element *Element `json:"element,omitempty"`
+
+	CtHelper      *CtHelper      `json:"ct helper,omitempty"`
+	CtExpectation *CtExpectation `json:"ct expectation,omitempty"`
+	CtTimeout     *CtTimeout     `json:"ct timeout,omitempty"`
+
+	Counter  *CounterObject  `json:"counter,omitempty"`
+	Quota    *QuotaObject    `json:"quota,omitempty"`
+	Limit    *LimitObject    `json:"limit,omitempty"`
+	Synproxy *SynproxyObject `json:"synproxy,omitempty"`
+
+	Ruleset bool `json:"-"`
 }
 
 func (o Objects) MarshalJSON() ([]byte, error) {
@@ -62,19 +76,56 @@ func (o Objects) MarshalJSON() ([]byte, error) {
 }
 
 type Nftable struct {
-	Table *Table `json:"table,omitempty"`
-	Chain *Chain `json:"chain,omitempty"`
-	Rule  *Rule  `json:"rule,omitempty"`
+	Table   *Table   `json:"table,omitempty"`
+	Chain   *Chain   `json:"chain,omitempty"`
+	Rule    *Rule    `json:"rule,omitempty"`
+	Secmark *Secmark `json:"secmark,omitempty"`
+	Set     *Set     `json:"set,omitempty"`
+	Map     *Map     `json:"map,omitempty"`
+	Element *Element `json:"element,omitempty"`
+
+	CtHelper      *CtHelper      `json:"ct helper,omitempty"`
+	CtExpectation *CtExpectation `json:"ct expectation,omitempty"`
+	CtTimeout     *CtTimeout     `json:"ct timeout,omitempty"`
+
+	Counter  *CounterObject  `json:"counter,omitempty"`
+	Quota    *QuotaObject    `json:"quota,omitempty"`
+	Limit    *LimitObject    `json:"limit,omitempty"`
+	Synproxy *SynproxyObject `json:"synproxy,omitempty"`
 
 	Add    *Objects `json:"add,omitempty"`
+	Create *Objects `json:"create,omitempty"`
 	Delete *Objects `json:"delete,omitempty"`
 	Flush  *Objects `json:"flush,omitempty"`
 
 	Metainfo *Metainfo `json:"metainfo,omitempty"`
 }
 
+// JSONSchemaVersion is the libnftables-json schema version this package implements.
+const JSONSchemaVersion = 1
+
 type Metainfo struct {
 	Version           string `json:"version"`
 	ReleaseName       string `json:"release_name"`
 	JsonSchemaVersion int    `json:"json_schema_version"`
+	// Genid is the generation ID of the listed ruleset, which the kernel increments on each ruleset change.
+	// It is nil unless reported by nft, which only some versions include in the metainfo.
+	Genid *int `json:"genid,omitempty"`
+}
+
+func (m *Metainfo) UnmarshalJSON(data []byte) error {
+	type _Metainfo Metainfo
+	metainfo := struct {
+		*_Metainfo
+		JsonSchemaVersion number  `json:"json_schema_version"`
+		Genid             *number `json:"genid,omitempty"`
+	}{_Metainfo: (*_Metainfo)(m)}
+
+	if err := json.Unmarshal(data, &metainfo); err != nil {
+		return err
+	}
+	m.JsonSchemaVersion = int(metainfo.JsonSchemaVersion)
+	m.Genid = metainfo.Genid.intPtr()
+
+	return nil
 }
@@ -0,0 +1,256 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Set is a named set object, holding elements of the given type.
+// A concatenated type is expressed as in the nft syntax, e.g. `ipv4_addr . inet_service`.
+// The timeout and the garbage collection interval are in seconds.
+type Set struct {
+	Family     string       `json:"family"`
+	Table      string       `json:"table"`
+	Name       string       `json:"name"`
+	Handle     *int         `json:"handle,omitempty"`
+	Type       string       `json:"type,omitempty"`
+	Policy     string       `json:"policy,omitempty"`
+	Flags      *Flags       `json:"flags,omitempty"`
+	Elem       []Expression `json:"elem,omitempty"`
+	Timeout    int          `json:"timeout,omitempty"`
+	GcInterval int          `json:"gc-interval,omitempty"`
+	Size       int          `json:"size,omitempty"`
+	// AutoMerge lets nft merge the overlapping and adjacent elements of an interval set on insertion,
+	// instead of rejecting the overlapping ones.
+	AutoMerge bool `json:"auto-merge,omitempty"`
+}
+
+// Map is a named map object, mapping elements of the given type to data of the map type.
+// Each map element is an array expression of the key and the value.
+type Map struct {
+	Family     string       `json:"family"`
+	Table      string       `json:"table"`
+	Name       string       `json:"name"`
+	Handle     *int         `json:"handle,omitempty"`
+	Type       string       `json:"type,omitempty"`
+	Map        string       `json:"map,omitempty"`
+	Policy     string       `json:"policy,omitempty"`
+	Flags      *Flags       `json:"flags,omitempty"`
+	Elem       []Expression `json:"elem,omitempty"`
+	Timeout    int          `json:"timeout,omitempty"`
+	GcInterval int          `json:"gc-interval,omitempty"`
+	Size       int          `json:"size,omitempty"`
+	// AutoMerge lets nft merge the overlapping and adjacent elements of an interval map on insertion,
+	// instead of rejecting the overlapping ones.
+	AutoMerge bool `json:"auto-merge,omitempty"`
+}
+
+// Element holds elements of the named set or map, to be added to or deleted from it.
+type Element struct {
+	Family string       `json:"family"`
+	Table  string       `json:"table"`
+	Name   string       `json:"name"`
+	Elem   []Expression `json:"elem"`
+}
+
+// Set Types
+const (
+	SetTypeIPv4Addr     = "ipv4_addr"
+	SetTypeIPv6Addr     = "ipv6_addr"
+	SetTypeEtherAddr    = "ether_addr"
+	SetTypeInetProto    = "inet_proto"
+	SetTypeInetService  = "inet_service"
+	SetTypeMark         = "mark"
+	SetTypeIfname       = "ifname"
+	SetTypeVerdict      = "verdict" // Map data type only.
+	setTypeConcatSymbol = " . "
+)
+
+// Set Flags
+const (
+	SetFlagConstant = "constant"
+	SetFlagInterval = "interval"
+	SetFlagTimeout  = "timeout"
+	SetFlagDynamic  = "dynamic"
+)
+
+// Set Policies
+const (
+	SetPolicyPerformance = "performance"
+	SetPolicyMemory      = "memory"
+)
+
+// Validate checks the coherence of the set attributes, returning an error describing the first violation.
+// It catches set definitions nft would reject, or accept while behaving differently than intended:
+//   - The family, table, name and type are set.
+//   - The timeout, gc-interval and size are not negative.
+//   - The gc-interval and element timeouts are used with the timeout flag or a set timeout,
+//     elements expire only in sets supporting timeouts.
+//   - The constant flag is not used with the dynamic or timeout flags, nor a timeout,
+//     a constant set not being updated once created.
+//   - The number of elements does not exceed the size, when set.
+//   - Auto-merge is used with the interval flag, nft merging intervals only.
+//
+// Whether a dynamic set is updated by a rule is not checked, see the config Lint.
+func (s *Set) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("invalid set %s %s %s: %s", s.Family, s.Table, s.Name, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case s.Family == "" || s.Table == "" || s.Name == "":
+		return invalid("the family, table and name are required")
+	case s.Type == "":
+		return invalid("the type is required")
+	case s.Timeout < 0 || s.GcInterval < 0 || s.Size < 0:
+		return invalid("the timeout, gc-interval and size must not be negative")
+	}
+
+	var flags []string
+	if s.Flags != nil {
+		flags = s.Flags.Flags
+	}
+	timeouts := hasFlag(flags, SetFlagTimeout) || s.Timeout > 0
+	if s.GcInterval > 0 && !timeouts {
+		return invalid("gc-interval requires the %s flag or a timeout", SetFlagTimeout)
+	}
+	if hasFlag(flags, SetFlagConstant) {
+		for _, flag := range []string{SetFlagDynamic, SetFlagTimeout} {
+			if hasFlag(flags, flag) {
+				return invalid("the %s flag conflicts with the %s flag", SetFlagConstant, flag)
+			}
+		}
+		if s.Timeout > 0 {
+			return invalid("the %s flag conflicts with a timeout", SetFlagConstant)
+		}
+	}
+	for _, element := range s.Elem {
+		if element.Elem != nil && (element.Elem.Timeout > 0 || element.Elem.Expires > 0) && !timeouts {
+			return invalid("element timeouts require the %s flag or a timeout", SetFlagTimeout)
+		}
+	}
+	if s.AutoMerge && !hasFlag(flags, SetFlagInterval) {
+		return invalid("auto-merge requires the %s flag", SetFlagInterval)
+	}
+	if s.Size > 0 && len(s.Elem) > s.Size {
+		return invalid("%d elements exceed the size of %d", len(s.Elem), s.Size)
+	}
+	return nil
+}
+
+// dataType is a set or map data type, which nft encodes as an array of types when concatenated.
+type dataType string
+
+func isConcatType(t string) bool {
+	return strings.Contains(t, setTypeConcatSymbol)
+}
+
+func (t dataType) MarshalJSON() ([]byte, error) {
+	if isConcatType(string(t)) {
+		return json.Marshal(strings.Split(string(t), setTypeConcatSymbol))
+	}
+	return json.Marshal(string(t))
+}
+
+func (t *dataType) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		var types []string
+		if err := json.Unmarshal(data, &types); err != nil {
+			return err
+		}
+		*t = dataType(strings.Join(types, setTypeConcatSymbol))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*t = dataType(s)
+	return nil
+}
+
+func (s Set) MarshalJSON() ([]byte, error) {
+	type _Set Set
+	if !isConcatType(s.Type) {
+		return json.Marshal(_Set(s))
+	}
+
+	set := struct {
+		_Set
+		Type dataType `json:"type,omitempty"`
+	}{_Set: _Set(s), Type: dataType(s.Type)}
+
+	return json.Marshal(set)
+}
+
+func (s *Set) UnmarshalJSON(data []byte) error {
+	type _Set Set
+	set := struct {
+		*_Set
+		Handle *number  `json:"handle,omitempty"`
+		Type   dataType `json:"type,omitempty"`
+	}{_Set: (*_Set)(s)}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	s.Handle = set.Handle.intPtr()
+	s.Type = string(set.Type)
+
+	return nil
+}
+
+func (m Map) MarshalJSON() ([]byte, error) {
+	type _Map Map
+	if !isConcatType(m.Type) && !isConcatType(m.Map) {
+		return json.Marshal(_Map(m))
+	}
+
+	mapObject := struct {
+		_Map
+		Type dataType `json:"type,omitempty"`
+		Map  dataType `json:"map,omitempty"`
+	}{_Map: _Map(m), Type: dataType(m.Type), Map: dataType(m.Map)}
+
+	return json.Marshal(mapObject)
+}
+
+func (m *Map) UnmarshalJSON(data []byte) error {
+	type _Map Map
+	mapObject := struct {
+		*_Map
+		Handle *number  `json:"handle,omitempty"`
+		Type   dataType `json:"type,omitempty"`
+		Map    dataType `json:"map,omitempty"`
+	}{_Map: (*_Map)(m)}
+
+	if err := json.Unmarshal(data, &mapObject); err != nil {
+		return err
+	}
+	m.Handle = mapObject.Handle.intPtr()
+	m.Type = string(mapObject.Type)
+	m.Map = string(mapObject.Map)
+
+	return nil
+}
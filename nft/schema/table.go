@@ -30,6 +30,7 @@ const (
 )
 
 type Table struct {
-	Family string `json:"family"`
-	Name   string `json:"name"`
+	Family  string `json:"family"`
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
 }
@@ -0,0 +1,135 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+const anonymousSetKey = "set"
+
+// Vmap is a verdict map statement, applying the verdict mapped to the key value.
+// The map is either referenced by name through Data (e.g. `@mymap`)
+// or defined anonymously (inline) through Elements.
+// Elements are serialized in their given order, use SortElements for a canonical order.
+type Vmap struct {
+	Key      Expression    `json:"key"`
+	Data     Expression    `json:"data"`
+	Elements []VmapElement `json:"-"`
+}
+
+// VmapElement maps a key value to a verdict, in an anonymous verdict map.
+type VmapElement struct {
+	Key     Expression
+	Verdict Verdict
+}
+
+// SortElements sorts the anonymous verdict map elements by their keys.
+// Numerical keys are sorted by value, other keys by their JSON encoding.
+func (v *Vmap) SortElements() {
+	sort.SliceStable(v.Elements, func(i, j int) bool {
+		return isExpressionLess(v.Elements[i].Key, v.Elements[j].Key)
+	})
+}
+
+func (v Vmap) MarshalJSON() ([]byte, error) {
+	type _Vmap Vmap
+	vmap := _Vmap(v)
+
+	if v.Elements != nil {
+		elements := make([][2]json.RawMessage, 0, len(v.Elements))
+		for _, element := range v.Elements {
+			key, err := json.Marshal(element.Key)
+			if err != nil {
+				return nil, err
+			}
+			verdict, err := json.Marshal(Statement{Verdict: element.Verdict})
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, [2]json.RawMessage{key, verdict})
+		}
+
+		data, err := json.Marshal(map[string]interface{}{anonymousSetKey: elements})
+		if err != nil {
+			return nil, err
+		}
+		vmap.Data = Expression{RowData: data}
+	}
+
+	return json.Marshal(vmap)
+}
+
+func (v *Vmap) UnmarshalJSON(data []byte) error {
+	type _Vmap Vmap
+	vmap := _Vmap{}
+
+	if err := json.Unmarshal(data, &vmap); err != nil {
+		return err
+	}
+	*v = Vmap(vmap)
+
+	if elements, isAnonymous := anonymousMapElements(v.Data); isAnonymous {
+		v.Elements = make([]VmapElement, 0, len(elements))
+		for _, element := range elements {
+			var key Expression
+			if err := json.Unmarshal(element[0], &key); err != nil {
+				return err
+			}
+			var verdict Statement
+			if err := json.Unmarshal(element[1], &verdict); err != nil {
+				return err
+			}
+			v.Elements = append(v.Elements, VmapElement{Key: key, Verdict: verdict.Verdict})
+		}
+		v.Data = Expression{}
+	}
+
+	return nil
+}
+
+// anonymousMapElements returns the key-value pairs of an anonymous map expression.
+// The second return value reports whether the expression is an anonymous map.
+func anonymousMapElements(e Expression) ([][2]json.RawMessage, bool) {
+	if e.Set == nil {
+		return nil, false
+	}
+
+	elements := make([][2]json.RawMessage, 0, len(e.Set))
+	for _, element := range e.Set {
+		var pair [2]json.RawMessage
+		if err := json.Unmarshal(element.RowData, &pair); err != nil {
+			return nil, false
+		}
+		elements = append(elements, pair)
+	}
+	return elements, true
+}
+
+func isExpressionLess(a, b Expression) bool {
+	if a.Float64 != nil && b.Float64 != nil {
+		return *a.Float64 < *b.Float64
+	}
+	aData, _ := json.Marshal(a)
+	bData, _ := json.Marshal(b)
+	return bytes.Compare(aData, bData) < 0
+}
@@ -0,0 +1,422 @@
+/*
+ * This file is part of the go-nft project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2021 Red Hat, Inc.
+ *
+ */
+
+package nft
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/networkplumbing/go-nft/nft/schema"
+)
+
+// Rate defines a packet rate, e.g. 10 packets per second.
+// The burst is optional, allowing packets to exceed the rate up to the given amount.
+type Rate struct {
+	Value int
+	Per   string // One of the schema.LimitPer* time units.
+	Burst int
+}
+
+// LogThenDrop returns the statements of a rate-limited log and drop pattern.
+// Two statements lists are returned, each intended to a separate rule in the given order:
+// The first logs packets with the given prefix, at most at the given rate.
+// The second drops all packets.
+// Having the limit, log and drop in a single rule would skip the drop of packets exceeding the rate.
+func LogThenDrop(prefix string, rate Rate) [][]schema.Statement {
+	limit := schema.Statement{Limit: &schema.Limit{
+		Rate:  rate.Value,
+		Per:   rate.Per,
+		Burst: rate.Burst,
+	}}
+	logStatement := schema.Statement{Log: &schema.Log{Prefix: prefix}}
+	drop := schema.Statement{Verdict: schema.Drop()}
+
+	return [][]schema.Statement{
+		{limit, logStatement},
+		{drop},
+	}
+}
+
+// MarkSet returns a statement which sets the packet mark (`meta mark set`).
+// Setting the mark in a `route` chain on the output hook triggers a new route lookup with the mark.
+func MarkSet(mark int) schema.Statement {
+	value := float64(mark)
+	return schema.Statement{Mangle: &schema.Mangle{
+		Key:   schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyMark}},
+		Value: schema.Expression{Float64: &value},
+	}}
+}
+
+// L4ProtoIs returns a statement which matches the layer 4 protocol (`meta l4proto tcp`).
+// Unlike `ip protocol` and `ip6 nexthdr`, it matches both IPv4 and IPv6 packets, as needed in the inet family.
+// The IPv6 extension headers are skipped, matching the actual transport protocol.
+func L4ProtoIs(protocol string) schema.Statement {
+	return schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyL4proto}},
+		Right: schema.Expression{String: &protocol},
+	}}
+}
+
+// DportIs returns a statement which matches the destination port of the transport protocol (`tcp dport 22`),
+// the protocol being one of `tcp`, `udp` or `sctp`.
+func DportIs(protocol string, port uint16) schema.Statement {
+	return portMatch(protocol, schema.PayloadFieldDPort, schema.OperEQ, portValue(port))
+}
+
+// DportRange returns a statement which matches destination ports in the inclusive range (`tcp dport 1024-65535`).
+// An error is returned if the low port is greater than the high one, nft rejecting the range.
+func DportRange(protocol string, low, high uint16) (schema.Statement, error) {
+	return portRangeMatch(protocol, schema.PayloadFieldDPort, low, high)
+}
+
+// DportIn returns a statement which matches any of the destination ports (`tcp dport { 80, 443 }`).
+func DportIn(protocol string, ports ...uint16) schema.Statement {
+	return portMatch(protocol, schema.PayloadFieldDPort, schema.OperIN, portValues(ports))
+}
+
+// SportIs returns a statement which matches the source port of the transport protocol (`udp sport 53`),
+// the protocol being one of `tcp`, `udp` or `sctp`.
+func SportIs(protocol string, port uint16) schema.Statement {
+	return portMatch(protocol, schema.PayloadFieldSPort, schema.OperEQ, portValue(port))
+}
+
+// SportRange returns a statement which matches source ports in the inclusive range, as DportRange.
+func SportRange(protocol string, low, high uint16) (schema.Statement, error) {
+	return portRangeMatch(protocol, schema.PayloadFieldSPort, low, high)
+}
+
+// SportIn returns a statement which matches any of the source ports, as DportIn.
+func SportIn(protocol string, ports ...uint16) schema.Statement {
+	return portMatch(protocol, schema.PayloadFieldSPort, schema.OperIN, portValues(ports))
+}
+
+func portRangeMatch(protocol, field string, low, high uint16) (schema.Statement, error) {
+	if low > high {
+		return schema.Statement{}, fmt.Errorf("invalid %s %s range %d-%d, the low port exceeds the high one", protocol, field, low, high)
+	}
+	portRange := schema.Range{Low: portValue(low), High: portValue(high)}
+	return portMatch(protocol, field, schema.OperEQ, schema.Expression{Range: &portRange}), nil
+}
+
+func portMatch(protocol, field, op string, right schema.Expression) schema.Statement {
+	return schema.Statement{Match: &schema.Match{
+		Op:    op,
+		Left:  schema.Expression{Payload: &schema.Payload{Protocol: protocol, Field: field}},
+		Right: right,
+	}}
+}
+
+func portValue(port uint16) schema.Expression {
+	value := float64(port)
+	return schema.Expression{Float64: &value}
+}
+
+func portValues(ports []uint16) schema.Expression {
+	set := make([]schema.Expression, 0, len(ports))
+	for _, port := range ports {
+		set = append(set, portValue(port))
+	}
+	return schema.Expression{Set: set}
+}
+
+// SkuidIs returns a statement which matches packets of sockets owned by the user (`meta skuid 1000`).
+// The user is given by name or by numerical ID, serialized as a number.
+// It is only meaningful for locally generated packets, e.g. in the output hook.
+func SkuidIs(user string) schema.Statement {
+	return socketOwnerIs(schema.MetaKeySkuid, user)
+}
+
+// SkgidIs returns a statement which matches packets of sockets owned by the group (`meta skgid wheel`).
+// The group is given by name or by numerical ID, serialized as a number.
+// It is only meaningful for locally generated packets, e.g. in the output hook.
+func SkgidIs(group string) schema.Statement {
+	return socketOwnerIs(schema.MetaKeySkgid, group)
+}
+
+func socketOwnerIs(key string, owner string) schema.Statement {
+	right := schema.Expression{String: &owner}
+	if id, err := strconv.ParseUint(owner, 10, 32); err == nil {
+		value := float64(id)
+		right = schema.Expression{Float64: &value}
+	}
+	return schema.Statement{Match: &schema.Match{
+		Op:    schema.OperEQ,
+		Left:  schema.Expression{Meta: &schema.Meta{Key: key}},
+		Right: right,
+	}}
+}
+
+// EtherSAddrSet returns a statement which rewrites the source MAC address of the packets (`ether saddr set`),
+// e.g. in bridge chains, for L2 address translation. The address is parsed by MACAddress.
+func EtherSAddrSet(address string) (schema.Statement, error) {
+	return etherAddrSet(schema.PayloadFieldEtherSAddr, address)
+}
+
+// EtherDAddrSet returns a statement which rewrites the destination MAC address of the packets (`ether daddr set`),
+// as EtherSAddrSet.
+func EtherDAddrSet(address string) (schema.Statement, error) {
+	return etherAddrSet(schema.PayloadFieldEtherDAddr, address)
+}
+
+func etherAddrSet(field, address string) (schema.Statement, error) {
+	mac, err := MACAddress(address)
+	if err != nil {
+		return schema.Statement{}, err
+	}
+	return schema.Statement{Mangle: &schema.Mangle{
+		Key:   schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolEther, Field: field}},
+		Value: mac,
+	}}, nil
+}
+
+// CtMarkSave returns a statement which saves the packet mark in the connection mark (`ct mark set meta mark`),
+// commonly on the first packet of a connection.
+func CtMarkSave() schema.Statement {
+	return schema.Statement{Mangle: &schema.Mangle{
+		Key:   schema.Expression{Ct: &schema.Ct{Key: schema.CtKeyMark}},
+		Value: schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyMark}},
+	}}
+}
+
+// CtMarkRestore returns a statement which restores the packet mark from the connection mark (`meta mark set ct mark`),
+// commonly on the following packets of a connection, e.g. for policy routing by the mark.
+func CtMarkRestore() schema.Statement {
+	return schema.Statement{Mangle: &schema.Mangle{
+		Key:   schema.Expression{Meta: &schema.Meta{Key: schema.MetaKeyMark}},
+		Value: schema.Expression{Ct: &schema.Ct{Key: schema.CtKeyMark}},
+	}}
+}
+
+// CtStateIn returns a statement which matches connections in any of the given states (`ct state new,established`).
+// An error is returned if no state is given.
+func CtStateIn(states ...string) (schema.Statement, error) {
+	if len(states) == 0 {
+		return schema.Statement{}, fmt.Errorf("ct state match requires at least one state")
+	}
+	return schema.Statement{Match: &schema.Match{
+		Op:    schema.OperIN,
+		Left:  schema.Expression{Ct: &schema.Ct{Key: schema.CtKeyState}},
+		Right: flagsExpression(states),
+	}}, nil
+}
+
+// CtStatusAny returns a statement which matches connections with any of the given status flags set
+// (membership, `ct status snat,dnat`).
+// An error is returned if no flag is given.
+func CtStatusAny(flags ...string) (schema.Statement, error) {
+	if len(flags) == 0 {
+		return schema.Statement{}, fmt.Errorf("ct status match requires at least one status flag")
+	}
+	return schema.Statement{Match: &schema.Match{
+		Op:    schema.OperIN,
+		Left:  schema.Expression{Ct: &schema.Ct{Key: schema.CtKeyStatus}},
+		Right: flagsExpression(flags),
+	}}, nil
+}
+
+// CtStatusAll returns a statement which matches connections with all of the given status flags set
+// (equality of the masked status, `ct status & (snat|assured) == snat|assured`).
+// An error is returned if no flag is given.
+func CtStatusAll(flags ...string) (schema.Statement, error) {
+	if len(flags) == 0 {
+		return schema.Statement{}, fmt.Errorf("ct status match requires at least one status flag")
+	}
+	mask := orExpression(flags)
+	return schema.Statement{Match: &schema.Match{
+		Op: schema.OperEQ,
+		Left: schema.Expression{Binary: &schema.BinaryOperation{
+			Op:    schema.OperAND,
+			Left:  schema.Expression{Ct: &schema.Ct{Key: schema.CtKeyStatus}},
+			Right: mask,
+		}},
+		Right: mask,
+	}}, nil
+}
+
+// flagsExpression returns the expression of a single flag or a list of flags, of at least one flag.
+func flagsExpression(flags []string) schema.Expression {
+	if len(flags) == 1 {
+		return schema.Expression{String: &flags[0]}
+	}
+	data, _ := json.Marshal(flags)
+	return schema.Expression{RowData: data}
+}
+
+// orExpression returns the binary OR expression of the flags, or the flag itself if only one is given.
+// At least one flag is expected.
+func orExpression(flags []string) schema.Expression {
+	expression := schema.Expression{String: &flags[0]}
+	for i := range flags[1:] {
+		expression = schema.Expression{Binary: &schema.BinaryOperation{
+			Op:    schema.OperOR,
+			Left:  expression,
+			Right: schema.Expression{String: &flags[i+1]},
+		}}
+	}
+	return expression
+}
+
+// IPIsFragment returns a statement which matches IPv4 fragments (`ip frag-off & 0x3fff != 0`),
+// i.e. packets with the more fragments flag set or a non-zero fragment offset.
+// The first fragment is matched as well, having the more fragments flag set.
+func IPIsFragment() schema.Statement {
+	mask, zero := float64(schema.IPFragMoreFragments|schema.IPFragOffsetMask), float64(0)
+	return schema.Statement{Match: &schema.Match{
+		Op: schema.OperNEQ,
+		Left: schema.Expression{Binary: &schema.BinaryOperation{
+			Op:    schema.OperAND,
+			Left:  schema.Expression{Payload: &schema.Payload{Protocol: schema.PayloadProtocolIP4, Field: schema.PayloadFieldIP4FragOff}},
+			Right: schema.Expression{Float64: &mask},
+		}},
+		Right: schema.Expression{Float64: &zero},
+	}}
+}
+
+// SampleModulus is the modulus of the random numbers generated to sample packets by SampleProbability.
+// It is the resolution of the sampling probability.
+const SampleModulus = 10000
+
+// SampleProbability returns a statement which matches packets with the given probability
+// (`numgen random mod 10000 < 100` for a probability of 0.01).
+// The probability is rounded to the resolution of the SampleModulus, to no less than its minimum.
+// An error is returned if the probability is not in the (0,1) range.
+func SampleProbability(p float64) (schema.Statement, error) {
+	if !(p > 0 && p < 1) {
+		return schema.Statement{}, fmt.Errorf("invalid sampling probability %v, expected a value between 0 and 1 (excluded)", p)
+	}
+
+	threshold := math.Round(p * SampleModulus)
+	if threshold < 1 {
+		threshold = 1
+	}
+	return schema.Statement{Match: &schema.Match{
+		Op:    schema.OperLS,
+		Left:  schema.Expression{Numgen: &schema.Numgen{Mode: schema.NumgenModeRandom, Mod: SampleModulus}},
+		Right: schema.Expression{Float64: &threshold},
+	}}, nil
+}
+
+// Reject returns a reject statement valid in a chain of the given family.
+// The unset reject type defaults by the family: `icmp` for ip, `icmpv6` for ip6 and `icmpx` for the others,
+// which handle both IPv4 and IPv6 packets.
+// An explicit reject type is kept, returning an error if the family does not support it.
+// An error is returned for the arp family, which does not support rejecting packets.
+func Reject(family AddressFamily, reject schema.Reject) (schema.Statement, error) {
+	var types []string
+	switch family {
+	case FamilyIP:
+		types = []string{schema.RejectTypeICMP, schema.RejectTypeTCPReset}
+	case FamilyIP6:
+		types = []string{schema.RejectTypeICMPv6, schema.RejectTypeTCPReset}
+	case FamilyINET, FamilyBridge, FamilyNETDEV:
+		types = []string{schema.RejectTypeICMPx, schema.RejectTypeICMP, schema.RejectTypeICMPv6, schema.RejectTypeTCPReset}
+	default:
+		return schema.Statement{}, fmt.Errorf("reject is not supported in the %q family", family)
+	}
+
+	if reject.Type == "" {
+		reject.Type = types[0]
+		return schema.Statement{Reject: &reject}, nil
+	}
+	for _, t := range types {
+		if reject.Type == t {
+			return schema.Statement{Reject: &reject}, nil
+		}
+	}
+	return schema.Statement{}, fmt.Errorf("reject type %q is not supported in the %q family", reject.Type, family)
+}
+
+// ConnLimitOver returns a statement which matches packets of the flows whose key (e.g. `ip saddr`)
+// has more than the given number of connections (`add @set { ip saddr ct count over 10 }`).
+// The connections are counted per key element in the named set, which is expected to be declared
+// with the dynamic flag and the type of the key (e.g. ipv4_addr).
+func ConnLimitOver(set string, key schema.Expression, count int) schema.Statement {
+	return schema.Statement{Set: &schema.SetStatement{
+		Op:   schema.SetOpAdd,
+		Elem: key,
+		Set:  "@" + set,
+		Stmt: []schema.Statement{{CtCount: &schema.CtCount{Val: count, Inv: true}}},
+	}}
+}
+
+// LoadBalanceTo returns a statement which applies one of the backend verdicts (e.g. jumps to the backend chains),
+// chosen by the hash of the key (`jhash ip saddr mod 2 vmap { 0 : jump b0, 1 : jump b1 }`).
+// Packets of the same key value are consistently handed to the same backend, as long as the backends are unchanged.
+// A key which is a jhash expression is used as is, returning an error if its modulus does not match
+// the number of backends. Otherwise, the key is hashed modulo the number of backends.
+// An error is returned if there are no backends.
+func LoadBalanceTo(key schema.Expression, backends []schema.Verdict) (schema.Statement, error) {
+	if len(backends) == 0 {
+		return schema.Statement{}, fmt.Errorf("no backends to load balance to")
+	}
+
+	hash := key.Jhash
+	if hash == nil {
+		hash = &schema.Jhash{Mod: len(backends), Expr: key}
+	} else if hash.Mod != len(backends) {
+		return schema.Statement{}, fmt.Errorf("jhash modulus %d does not match the %d backends", hash.Mod, len(backends))
+	}
+
+	elements := make([]schema.VmapElement, 0, len(backends))
+	for i, backend := range backends {
+		value := float64(hash.Offset + i)
+		elements = append(elements, schema.VmapElement{Key: schema.Expression{Float64: &value}, Verdict: backend})
+	}
+	return schema.Statement{Vmap: &schema.Vmap{Key: schema.Expression{Jhash: hash}, Elements: elements}}, nil
+}
+
+// VmapLookup returns a statement which applies the verdict mapped to the key value (e.g. `meta mark`)
+// in the named verdict map (`meta mark vmap @dispatch`), as defined by NewVerdictMap.
+// The verdict map can then be updated without changing the rules looking it up.
+func VmapLookup(key schema.Expression, name string) schema.Statement {
+	data := "@" + name
+	return schema.Statement{Vmap: &schema.Vmap{Key: key, Data: schema.Expression{String: &data}}}
+}
+
+// Concat returns the concatenation of the expressions (`ip saddr . ip daddr`),
+// used as the key of a set or map lookup, or as an element of a set or map of the concatenated type
+// (e.g. `ipv4_addr . ipv4_addr`), the element concatenating values, prefixes or ranges.
+// Interval elements require the set or map to be declared with the interval flag.
+func Concat(expressions ...schema.Expression) schema.Expression {
+	return schema.Expression{Concat: expressions}
+}
+
+// NewVerdictMap returns a new schema map structure, of a named map from keys of the given type
+// (e.g. schema.SetTypeMark) to the verdicts of the elements, looked up by VmapLookup.
+func NewVerdictMap(table *schema.Table, name string, keyType string, elements ...schema.VmapElement) (*schema.Map, error) {
+	m := &schema.Map{
+		Family: table.Family,
+		Table:  table.Name,
+		Name:   name,
+		Type:   keyType,
+		Map:    schema.SetTypeVerdict,
+	}
+	for _, element := range elements {
+		data, err := json.Marshal([2]interface{}{element.Key, schema.Statement{Verdict: element.Verdict}})
+		if err != nil {
+			return nil, err
+		}
+		m.Elem = append(m.Elem, schema.Expression{RowData: data})
+	}
+	return m, nil
+}
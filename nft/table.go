@@ -38,6 +38,7 @@ type TableAction string
 // Table Actions
 const (
 	TableADD    TableAction = "add"
+	TableCREATE TableAction = "create"
 	TableDELETE TableAction = "delete"
 	TableFLUSH  TableAction = "flush"
 )